@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+// ghostUsername is the name of the reserved user which takes over entries and audit records of deleted accounts.
+// New accounts cannot use it; the ghost itself is marked by the ghost column, so existing accounts named ghost
+// are never mistaken for it
+const ghostUsername = "ghost"
+
+const (
+	// entriesReassign hands public and team entries of a deleted account over to the ghost user
+	entriesReassign = "reassign"
+	// entriesDelete deletes all entries of a deleted account
+	entriesDelete = "delete"
+)
+
+var (
+	// ErrInvalidEntriesPolicy is returned when an account should be deleted without deciding what happens to its entries
+	ErrInvalidEntriesPolicy = newAPIError(http.StatusUnprocessableEntity, "invalid_entries_policy", "Invalid parameter: entries. Must either be reassign or delete")
+	// ErrDeleteGhostUser is returned when the ghost user holding entries of deleted accounts should be deleted
+	ErrDeleteGhostUser = newAPIError(http.StatusForbidden, "delete_ghost_user", "The ghost user cannot be deleted")
+	// ErrSuspendAdmin is returned when an admin should be suspended
+	ErrSuspendAdmin = newAPIError(http.StatusForbidden, "suspend_admin", "Admins cannot be suspended")
+)
+
+// findOrCreateGhostUser returns the id of the ghost user. The ghost has no password and is disabled, so nobody can login as ghost.
+// If an account registered before the name was reserved is called ghost, the ghost is created under a numbered name
+func findOrCreateGhostUser(tx *sql.Tx) (int, error) {
+	var ghostID = 0
+	if err := tx.QueryRow(`SELECT id FROM users WHERE ghost = ? ORDER BY id LIMIT 1`, true).Scan(&ghostID); err == nil {
+		return ghostID, nil
+	} else if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	var username = ghostUsername
+	for i := 1; ; i++ {
+		var taken = 0
+		if err := tx.QueryRow(`SELECT count(*) FROM users WHERE username = ?`, username).Scan(&taken); err != nil {
+			return 0, err
+		}
+		if taken == 0 {
+			break
+		}
+		username = fmt.Sprintf("%s-%d", ghostUsername, i)
+	}
+
+	var res, err = tx.Exec(`INSERT INTO users (username, password, disabled, ghost, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`, username, "", true, true, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	id, err = res.LastInsertId()
+	return int(id), err
+}
+
+// queryIDs returns the first column of all rows as ids
+func queryIDs(tx *sql.Tx, query string, params ...interface{}) ([]interface{}, error) {
+	var rows, err = tx.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids = make([]interface{}, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// handOverOwnedTeams makes the longest standing moderator, or member, the owner of every team owned by the user.
+// Teams without other members are deleted
+func handOverOwnedTeams(tx *sql.Tx, user dash.User) error {
+	var teamIDs, err = queryIDs(tx, `SELECT team_id FROM team_user WHERE user_id = ? AND role = ?`, user.ID, "owner")
+	if err != nil {
+		return err
+	}
+
+	for _, teamID := range teamIDs {
+		var successorID = 0
+		tx.QueryRow(`SELECT user_id FROM team_user WHERE team_id = ? AND user_id != ? ORDER BY CASE role WHEN ? THEN 0 ELSE 1 END, id LIMIT 1`, teamID, user.ID, "moderator").Scan(&successorID)
+		if successorID == 0 {
+			if err := deleteTeam(tx, teamID.(int)); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE team_user SET role = ? WHERE team_id = ? AND user_id = ?`, "owner", teamID, successorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteUserAccount removes the user in a single transaction. Private entries and drafts are always deleted,
+// public and team entries are either handed over to the ghost user or deleted. Votes are removed and scores
+// updated, owned teams are handed over and audit records are kept with the ghost user as actor
+func deleteUserAccount(db *sql.DB, user dash.User, entriesPolicy string) error {
+	if entriesPolicy != entriesReassign && entriesPolicy != entriesDelete {
+		return ErrInvalidEntriesPolicy
+	}
+	if user.Ghost {
+		return ErrDeleteGhostUser
+	}
+
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := deleteUserAccountTx(tx, user, entriesPolicy); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteUserAccountTx(tx *sql.Tx, user dash.User, entriesPolicy string) error {
+	var ghostID, err = findOrCreateGhostUser(tx)
+	if err != nil {
+		return err
+	}
+
+	var votedEntryIDs []interface{}
+	if votedEntryIDs, err = queryIDs(tx, `SELECT entry_id FROM votes WHERE user_id = ?`, user.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM votes WHERE user_id = ?`, user.ID); err != nil {
+		return err
+	}
+	if len(votedEntryIDs) > 0 {
+		var placeholders = strings.Join(strings.Split(strings.Repeat("?", len(votedEntryIDs)), ""), ",")
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE entries SET score = (SELECT COALESCE(SUM(type), 0) FROM votes WHERE votes.entry_id = entries.id) WHERE id IN (%s)`, placeholders), votedEntryIDs...); err != nil {
+			return err
+		}
+	}
+
+	var entryIDs []interface{}
+	if entriesPolicy == entriesDelete {
+		entryIDs, err = queryIDs(tx, `SELECT id FROM entries WHERE user_id = ?`, user.ID)
+	} else {
+		entryIDs, err = queryIDs(tx, `SELECT id FROM entries WHERE user_id = ? AND (draft = ? OR (public = ? AND id NOT IN (SELECT entry_id FROM entry_team)))`, user.ID, true, false)
+	}
+	if err != nil {
+		return err
+	}
+	if err := deleteEntries(tx, entryIDs); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE entries SET user_id = ? WHERE user_id = ?`, ghostID, user.ID); err != nil {
+		return err
+	}
+
+	if err := handOverOwnedTeams(tx, user); err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		`DELETE FROM team_user WHERE user_id = ?`,
+		`DELETE FROM notifications WHERE user_id = ?`,
+		`DELETE FROM subscriptions WHERE user_id = ?`,
+		`DELETE FROM team_join_requests WHERE user_id = ?`,
+		`DELETE FROM organization_admins WHERE user_id = ?`,
+		`DELETE FROM quota_overrides WHERE user_id = ?`,
+	} {
+		if _, err := tx.Exec(query, user.ID); err != nil {
+			return err
+		}
+	}
+	for _, query := range []string{
+		`UPDATE notifications SET actor_id = ? WHERE actor_id = ?`,
+		`UPDATE events SET actor_id = ? WHERE actor_id = ?`,
+		`UPDATE events SET target_user_id = ? WHERE target_user_id = ?`,
+		`UPDATE flags SET user_id = ? WHERE user_id = ?`,
+		`UPDATE flags SET resolved_by = ? WHERE resolved_by = ?`,
+		`UPDATE moderation_actions SET actor_id = ? WHERE actor_id = ?`,
+		`UPDATE admin_actions SET actor_id = ? WHERE actor_id = ?`,
+		`UPDATE admin_actions SET target_user_id = ? WHERE target_user_id = ?`,
+		`UPDATE banned_docsets SET user_id = ? WHERE user_id = ?`,
+		`UPDATE team_invitations SET created_by = ? WHERE created_by = ?`,
+		`UPDATE team_join_requests SET decided_by = ? WHERE decided_by = ?`,
+	} {
+		if _, err := tx.Exec(query, ghostID, user.ID); err != nil {
+			return err
+		}
+	}
+	if err := removeExports(tx, user.ID); err != nil {
+		return err
+	}
+	if user.Email.String != "" {
+		if _, err := tx.Exec(`DELETE FROM password_reminders WHERE email = ?`, user.Email.String); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM users WHERE id = ?`, user.ID)
+	return err
+}
+
+type userDeleteRequest struct {
+	Password string `json:"password"`
+	Entries  string `json:"entries"`
+}
+
+// UserDelete deletes the account of the current user. The password must be confirmed
+func UserDelete(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var payload userDeleteRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.Password == "" {
+		return ErrMissingPassword
+	}
+	if !user.PasswordsMatch(payload.Password) {
+		return ErrInvalidLogin
+	}
+
+	if err := deleteUserAccount(db, *user, payload.Entries); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   "laravel_session",
+		Value:  "",
+		MaxAge: -1,
+	})
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// setSuspended suspends or reinstates the user and records the change. Suspension also ends all sessions
+func setSuspended(db *sql.DB, username string, suspended bool, source string, actorID int) error {
+	var target, err = findUserByUsername(db, username)
+	if err != nil {
+		return ErrUnknownUser
+	}
+	if suspended && target.Admin {
+		return ErrSuspendAdmin
+	}
+	if target.Disabled == suspended {
+		return nil
+	}
+
+	if _, err := db.Exec(`UPDATE users SET disabled = ?, remember_token = NULL, updated_at = ? WHERE id = ?`, suspended, time.Now(), target.ID); err != nil {
+		return err
+	}
+	var action = dash.AdminSuspendUser
+	if !suspended {
+		action = dash.AdminUnsuspendUser
+	}
+	return recordAdminAction(db, action, source, actorID, target.ID)
+}
+
+type adminUserRequest struct {
+	Username string `json:"username"`
+}
+
+// AdminUserSuspend prevents a user from logging in and ends all sessions
+func AdminUserSuspend(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Admin {
+		return ErrNotAdmin
+	}
+
+	var payload adminUserRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if err := setSuspended(db, payload.Username, true, dash.SourceAPI, user.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// AdminUserUnsuspend allows a suspended user to login again
+func AdminUserUnsuspend(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Admin {
+		return ErrNotAdmin
+	}
+
+	var payload adminUserRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if err := setSuspended(db, payload.Username, false, dash.SourceAPI, user.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
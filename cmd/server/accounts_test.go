@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestUserDelete_Reassign(t *testing.T) {
+	var leaverID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "delete-leaver", encryptPassword("secret"))
+	var memberID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "delete-member", "b")
+	var moderatorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "delete-moderator", "b")
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "delete-team")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, leaverID, "owner")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, memberID, "member")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, moderatorID, "moderator")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Delete", "Delete", "c", "d", "e", "f", "g", "h", false)
+	var insertEntry = func(userID int, public bool) int {
+		return exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "a", "b", "b", "comment", identifierID, "c", userID, public, false, 0)
+	}
+	var publicID = insertEntry(leaverID, true)
+	var privateID = insertEntry(leaverID, false)
+	var teamEntryID = insertEntry(leaverID, false)
+	exec(`INSERT INTO entry_team (entry_id, team_id) VALUES (?, ?)`, teamEntryID, teamID)
+	var votedID = insertEntry(memberID, true)
+	exec(`INSERT INTO votes (type, entry_id, user_id) VALUES (?, ?, ?)`, dash.VoteUp, votedID, leaverID)
+	exec(`UPDATE entries SET score = ? WHERE id = ?`, 1, votedID)
+
+	var leaver, _ = findUserByUsername(db, "delete-leaver")
+	var ctx = context.WithValue(rootCtx, UserKey, &leaver)
+	var call = func(body string) error {
+		req, _ := http.NewRequest("POST", "/users/delete", strings.NewReader(body))
+		return UserDelete(ctx, httptest.NewRecorder(), req)
+	}
+	if err := call(`{"password":"wrong","entries":"reassign"}`); err != ErrInvalidLogin {
+		t.Fatalf("Expected a wrong password to return %q, got %q", ErrInvalidLogin, err)
+	}
+	if err := call(`{"password":"secret"}`); err != ErrInvalidEntriesPolicy {
+		t.Fatalf("Expected a missing entries policy to return %q, got %q", ErrInvalidEntriesPolicy, err)
+	}
+	if err := call(`{"password":"secret","entries":"reassign"}`); err != nil {
+		t.Fatalf("UserDelete errored with: %#v", err)
+	}
+
+	if _, err := findUserByUsername(db, "delete-leaver"); err == nil {
+		t.Errorf("Expected the user to be deleted")
+	}
+	var ghostID = 0
+	db.QueryRow(`SELECT id FROM users WHERE ghost = ?`, true).Scan(&ghostID)
+	for _, entryID := range []int{publicID, teamEntryID} {
+		if entry, err := findEntryByID(db, entryID); err != nil || entry.UserID != ghostID {
+			t.Errorf("Expected entry %d to be reassigned to the ghost, got %#v", entryID, entry)
+		}
+	}
+	if _, err := findEntryByID(db, privateID); err == nil {
+		t.Errorf("Expected the private entry to be deleted")
+	}
+	if voted, _ := findEntryByID(db, votedID); voted.Score != 0 {
+		t.Errorf("Expected the vote to be removed, got a score of %d", voted.Score)
+	}
+	var role string
+	db.QueryRow(`SELECT role FROM team_user WHERE team_id = ? AND user_id = ?`, teamID, moderatorID).Scan(&role)
+	if role != "owner" {
+		t.Errorf("Expected the moderator to take over the team, got %q", role)
+	}
+}
+
+func TestFindOrCreateGhostUser_NameTaken(t *testing.T) {
+	var tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to start a transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// an account registered as ghost before the name was reserved must not take over entries of deleted accounts
+	tx.Exec(`UPDATE users SET ghost = ?`, false)
+	tx.Exec(`DELETE FROM users WHERE username = ?`, ghostUsername)
+	var res, _ = tx.Exec(`INSERT INTO users (username, password) VALUES (?, ?)`, ghostUsername, "")
+	var realID, _ = res.LastInsertId()
+
+	var ghostID int
+	if ghostID, err = findOrCreateGhostUser(tx); err != nil {
+		t.Fatalf("findOrCreateGhostUser errored with: %#v", err)
+	}
+	var username string
+	tx.QueryRow(`SELECT username FROM users WHERE id = ?`, ghostID).Scan(&username)
+	if ghostID == int(realID) || username != ghostUsername+"-1" {
+		t.Errorf("Expected the ghost to be created as %s-1, got user %d named %q", ghostUsername, ghostID, username)
+	}
+}
+
+func TestAdminUserSuspend(t *testing.T) {
+	var adminID = exec(`INSERT INTO users (username, password, moderator, admin) VALUES (?, ?, ?, ?)`, "suspend-admin", "b", true, true)
+	exec(`INSERT INTO users (username, password, remember_token) VALUES (?, ?, ?)`, "suspend-target", "b", "token")
+
+	var admin = dash.User{ID: adminID, Username: "suspend-admin", Moderator: true, Admin: true}
+	var ctx = context.WithValue(rootCtx, UserKey, &admin)
+	req, _ := http.NewRequest("POST", "/admin/users/suspend", strings.NewReader(`{"username":"suspend-admin"}`))
+	if err := AdminUserSuspend(ctx, httptest.NewRecorder(), req); err != ErrSuspendAdmin {
+		t.Fatalf("Expected suspending admins to return %q, got %q", ErrSuspendAdmin, err)
+	}
+
+	req, _ = http.NewRequest("POST", "/admin/users/suspend", strings.NewReader(`{"username":"suspend-target"}`))
+	if err := AdminUserSuspend(ctx, httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("AdminUserSuspend errored with: %#v", err)
+	}
+	if _, err := findUserByRememberToken(db, "token"); err == nil {
+		t.Errorf("Expected the sessions of the suspended user to end")
+	}
+	if target, _ := findUserByUsername(db, "suspend-target"); !target.Disabled {
+		t.Errorf("Expected the user to be suspended")
+	}
+
+	req, _ = http.NewRequest("POST", "/admin/users/unsuspend", strings.NewReader(`{"username":"suspend-target"}`))
+	if err := AdminUserUnsuspend(ctx, httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("AdminUserUnsuspend errored with: %#v", err)
+	}
+	if target, _ := findUserByUsername(db, "suspend-target"); target.Disabled {
+		t.Errorf("Expected the user to be reinstated")
+	}
+}
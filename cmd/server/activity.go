@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrNotInTeam is returned when an action requires you to be a member of the team
+	ErrNotInTeam = newAPIError(http.StatusForbidden, "not_in_team", "You need to be a member of the team")
+	// ErrInvalidFeedToken is returned when a feed is requested with an unknown feed token
+	ErrInvalidFeedToken = newAPIError(http.StatusUnauthorized, "invalid_feed_token", "Invalid feed token")
+)
+
+const (
+	// teamActivityPageSize is the number of events returned per page of the team activity feed
+	teamActivityPageSize = 50
+	// teamActivityMaxPageSize is the maximum number of events clients can request per page
+	teamActivityMaxPageSize = 100
+)
+
+// teamAdministrativeEvents are only listed to members allowed to view the members of the team
+var teamAdministrativeEvents = []string{
+	dash.EventMemberRemoved,
+	dash.EventRoleChanged,
+	dash.EventInvitationCreated,
+	dash.EventInvitationRevoked,
+	dash.EventJoinRequestApproved,
+	dash.EventJoinRequestRejected,
+}
+
+// findTeamActivity returns a page of events of the team, newest first, starting before the given event id.
+// Events on entries are listed while the entry is shared with the team, and only if they were caused by a
+// current member, so activity of outsiders on public entries stays hidden
+func findTeamActivity(db *sql.DB, teamID int, administrative bool, before, limit int) ([]dash.Activity, error) {
+	var conds = []string{`((ev.entry_id IS NULL AND ev.team_id = ?) OR (
+		ev.entry_id IN (SELECT entry_id FROM entry_team WHERE team_id = ? AND removed_from_team = ? AND approved = ?)
+		AND ev.actor_id IN (SELECT user_id FROM team_user WHERE team_id = ?)))`}
+	var params = []interface{}{teamID, teamID, false, true, teamID}
+	if before > 0 {
+		conds = append(conds, `ev.id < ?`)
+		params = append(params, before)
+	}
+	if !administrative {
+		conds = append(conds, fmt.Sprintf(`ev.kind NOT IN (%s)`, strings.Join(strings.Split(strings.Repeat("?", len(teamAdministrativeEvents)), ""), ",")))
+		for _, kind := range teamAdministrativeEvents {
+			params = append(params, kind)
+		}
+	}
+	params = append(params, limit)
+
+	var rows, err = db.Query(`SELECT ev.id, ev.kind, actor.username, COALESCE(target.username, ''), ev.entry_id, COALESCE(e.title, ''), ev.detail, ev.created_at
+		FROM events ev
+		INNER JOIN users actor ON actor.id = ev.actor_id
+		LEFT JOIN users target ON target.id = ev.target_user_id
+		LEFT JOIN entries e ON e.id = ev.entry_id
+		WHERE `+strings.Join(conds, " AND ")+`
+		ORDER BY ev.id DESC
+		LIMIT ?`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities = make([]dash.Activity, 0)
+	for rows.Next() {
+		var activity dash.Activity
+		var entryID sql.NullInt64
+		var createdAt nullTime
+		if err := rows.Scan(&activity.ID, &activity.Kind, &activity.Actor, &activity.Target, &entryID, &activity.EntryTitle, &activity.Detail, &createdAt); err != nil {
+			return nil, err
+		}
+		activity.EntryID = int(entryID.Int64)
+		activity.CreatedAt = createdAt.Time
+		activities = append(activities, activity)
+	}
+	return activities, nil
+}
+
+type teamActivityRequest struct {
+	Before int `json:"before"`
+	Limit  int `json:"limit"`
+}
+
+type teamActivityResponse struct {
+	Status     string          `json:"status"`
+	Activities []dash.Activity `json:"activities"`
+	NextBefore int             `json:"next_before,omitempty"`
+}
+
+// TeamActivity returns a page of the activity feed of a team to its members: new entries, edits, votes, joins
+// and leaves. Members allowed to view the members of the team also see removals, role changes, invitations and
+// join request decisions. Pass next_before as before to fetch the next page
+func TeamActivity(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if !isTeamMemberOf(*user, *team) {
+		return ErrNotInTeam
+	}
+
+	var payload teamActivityRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.Limit <= 0 {
+		payload.Limit = teamActivityPageSize
+	}
+	if payload.Limit > teamActivityMaxPageSize {
+		payload.Limit = teamActivityMaxPageSize
+	}
+
+	var activities, err = findTeamActivity(db, team.ID, teamCan(*user, *team, dash.CapabilityViewMembers), payload.Before, payload.Limit)
+	if err != nil {
+		return err
+	}
+
+	var response = teamActivityResponse{
+		Status:     "success",
+		Activities: activities,
+	}
+	if len(activities) == payload.Limit {
+		response.NextBefore = activities[len(activities)-1].ID
+	}
+	json.NewEncoder(w).Encode(response)
+	return nil
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Author  atomAuthor `xml:"author"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// activityTitle describes the activity in a single line
+func activityTitle(activity dash.Activity) string {
+	switch activity.Kind {
+	case dash.EventEntryCreated:
+		return fmt.Sprintf("%s annotated %q", activity.Actor, activity.EntryTitle)
+	case dash.EventEntryUpdated:
+		return fmt.Sprintf("%s edited %q", activity.Actor, activity.EntryTitle)
+	case dash.EventEntryPublished:
+		return fmt.Sprintf("%s published %q", activity.Actor, activity.EntryTitle)
+	case dash.EventEntryVoted:
+		return fmt.Sprintf("%s voted on %q", activity.Actor, activity.EntryTitle)
+	case dash.EventMemberJoined:
+		return fmt.Sprintf("%s joined the team", activity.Actor)
+	case dash.EventMemberLeft:
+		return fmt.Sprintf("%s left the team", activity.Actor)
+	case dash.EventMemberRemoved:
+		return fmt.Sprintf("%s removed %s from the team", activity.Actor, activity.Target)
+	case dash.EventRoleChanged:
+		return fmt.Sprintf("%s made %s %s", activity.Actor, activity.Target, activity.Detail)
+	case dash.EventOwnershipTransferred:
+		return fmt.Sprintf("%s handed the team over to %s", activity.Actor, activity.Target)
+	case dash.EventInvitationCreated:
+		return fmt.Sprintf("%s created an invitation", activity.Actor)
+	case dash.EventInvitationRevoked:
+		return fmt.Sprintf("%s revoked an invitation", activity.Actor)
+	case dash.EventJoinRequestApproved:
+		return fmt.Sprintf("%s approved the join request of %s", activity.Actor, activity.Target)
+	case dash.EventJoinRequestRejected:
+		return fmt.Sprintf("%s rejected the join request of %s", activity.Actor, activity.Target)
+	}
+	return fmt.Sprintf("%s: %s", activity.Actor, activity.Kind)
+}
+
+// TeamActivityFeed serves the latest page of the activity feed of a team as Atom feed. It requires no session;
+// the user is identified by the feed token passed as token, the team by its name passed as team
+func TeamActivityFeed(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+
+	var query = req.URL.Query()
+	if query.Get("token") == "" {
+		return ErrInvalidFeedToken
+	}
+	var user, err = findUserByFeedToken(db, query.Get("token"))
+	if err != nil || user.Disabled {
+		return ErrInvalidFeedToken
+	}
+	var team dash.Team
+	if team, err = findTeamByName(db, query.Get("team")); err != nil {
+		return ErrTeamUnknown
+	}
+	if !isTeamMemberOf(user, team) {
+		return ErrNotInTeam
+	}
+
+	var activities []dash.Activity
+	if activities, err = findTeamActivity(db, team.ID, teamCan(user, team, dash.CapabilityViewMembers), 0, teamActivityPageSize); err != nil {
+		return err
+	}
+
+	var feed = atomFeed{
+		ID:      fmt.Sprintf("urn:dash-annotations:team:%d", team.ID),
+		Title:   fmt.Sprintf("Activity of %s", team.Name),
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Entries: make([]atomEntry, 0, len(activities)),
+	}
+	if len(activities) > 0 {
+		feed.Updated = activities[0].CreatedAt.UTC().Format(time.RFC3339)
+	}
+	for _, activity := range activities {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      fmt.Sprintf("urn:dash-annotations:event:%d", activity.ID),
+			Title:   activityTitle(activity),
+			Updated: activity.CreatedAt.UTC().Format(time.RFC3339),
+			Author:  atomAuthor{Name: activity.Actor},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	return xml.NewEncoder(w).Encode(feed)
+}
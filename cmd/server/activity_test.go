@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestTeamActivityFeed(t *testing.T) {
+	var ownerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "feed-owner", "b")
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "feed-author", "b")
+	var readerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "feed-reader", "b")
+	var outsiderID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "feed-outsider", "b")
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "feed-team")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, ownerID, "owner")
+
+	for _, userID := range []int{authorID, readerID} {
+		if _, err := call(userID, WithTeam(ContextHandlerFunc(TeamJoin)), `{"name":"feed-team"}`); err != nil {
+			t.Fatalf("TeamJoin errored with: %#v", err)
+		}
+	}
+	var w, err = call(authorID, ContextHandlerFunc(EntryCreate), `{"title":"team note","body":"b","anchor":"a","public":true,"teams":["feed-team"],"identifier":{"docset_filename":"Feed","page_path":"index.html"}}`)
+	if err != nil {
+		t.Fatalf("EntryCreate errored with: %#v", err)
+	}
+	var created entrySaveResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	// only events by members of the team are listed, votes of outsiders on public team entries are not
+	for _, userID := range []int{ownerID, outsiderID} {
+		if _, err := call(userID, WithEntry(ContextHandlerFunc(EntryVote)), fmt.Sprintf(`{"entry_id":%d,"vote_type":1}`, created.Entry.ID)); err != nil {
+			t.Fatalf("EntryVote errored with: %#v", err)
+		}
+	}
+	if _, err := call(authorID, ContextHandlerFunc(EntryCreate), `{"title":"private note","body":"b","anchor":"a","identifier":{"docset_filename":"Feed","page_path":"index.html"}}`); err != nil {
+		t.Fatalf("EntryCreate errored with: %#v", err)
+	}
+	if _, err := call(ownerID, WithTeam(ContextHandlerFunc(TeamSetRole)), `{"name":"feed-team","username":"feed-author","role":"moderator"}`); err != nil {
+		t.Fatalf("TeamSetRole errored with: %#v", err)
+	}
+	if _, err := call(readerID, WithTeam(ContextHandlerFunc(TeamLeave)), `{"name":"feed-team"}`); err != nil {
+		t.Fatalf("TeamLeave errored with: %#v", err)
+	}
+
+	if _, err := call(outsiderID, WithTeam(ContextHandlerFunc(TeamActivity)), `{"name":"feed-team"}`); err != ErrNotInTeam {
+		t.Fatalf("Expected outsiders not to see the feed, got %q", err)
+	}
+
+	var kinds = make([]string, 0)
+	var before = 0
+	for page := 0; page < 5; page++ {
+		w, err = call(authorID, WithTeam(ContextHandlerFunc(TeamActivity)), fmt.Sprintf(`{"name":"feed-team","limit":2,"before":%d}`, before))
+		if err != nil {
+			t.Fatalf("TeamActivity errored with: %#v", err)
+		}
+		var feed teamActivityResponse
+		json.NewDecoder(w.Body).Decode(&feed)
+		for _, activity := range feed.Activities {
+			kinds = append(kinds, activity.Kind)
+		}
+		if before = feed.NextBefore; before == 0 {
+			break
+		}
+	}
+	var expected = []string{dash.EventMemberLeft, dash.EventRoleChanged, dash.EventEntryVoted, dash.EventEntryCreated, dash.EventMemberJoined, dash.EventMemberJoined}
+	if strings.Join(kinds, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected the feed to list %v, got %v", expected, kinds)
+	}
+
+	w, err = call(ownerID, ContextHandlerFunc(UserFeedToken), `{}`)
+	if err != nil {
+		t.Fatalf("UserFeedToken errored with: %#v", err)
+	}
+	var token userFeedTokenResponse
+	json.NewDecoder(w.Body).Decode(&token)
+
+	var feed = func(team, token string) (atomFeed, error) {
+		var w = httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/teams/activity.atom?team="+team+"&token="+token, nil)
+		var feed atomFeed
+		if err := TeamActivityFeed(rootCtx, w, req); err != nil {
+			return feed, err
+		}
+		return feed, xml.NewDecoder(w.Body).Decode(&feed)
+	}
+	if _, err := feed("feed-team", "wrong"); err != ErrInvalidFeedToken {
+		t.Fatalf("Expected unknown feed tokens to return %q, got %q", ErrInvalidFeedToken, err)
+	}
+	var atom, atomErr = feed("feed-team", token.FeedToken)
+	if atomErr != nil {
+		t.Fatalf("TeamActivityFeed errored with: %#v", atomErr)
+	}
+	if len(atom.Entries) != len(expected) || atom.Entries[2].Title != `feed-owner voted on "team note"` {
+		t.Errorf("Unexpected atom feed: %#v", atom)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrNotAdmin is returned when a user without admin role tries to manage moderators
+	ErrNotAdmin = newAPIError(http.StatusForbidden, "not_admin", "You need to be an admin for this")
+	// ErrDemoteAdmin is returned when an admin should be demoted, who always has moderator rights
+	ErrDemoteAdmin = newAPIError(http.StatusForbidden, "demote_admin", "Admins cannot be demoted")
+)
+
+// recordAdminAction adds a role change to the admin audit log. actorID is 0 for changes outside of the api
+func recordAdminAction(db *sql.DB, action, source string, actorID, targetID int) error {
+	_, err := db.Exec(`INSERT INTO admin_actions (actor_id, action, source, target_user_id, created_at) VALUES (?, ?, ?, ?, ?)`,
+		nullableID(actorID), action, source, targetID, time.Now())
+	return err
+}
+
+// setModerator grants or revokes global moderation rights and records the change
+func setModerator(db *sql.DB, username string, moderator bool, source string, actorID int) error {
+	var target, err = findUserByUsername(db, username)
+	if err != nil {
+		return ErrUnknownUser
+	}
+	if !moderator && target.Admin {
+		return ErrDemoteAdmin
+	}
+	if target.Moderator == moderator {
+		return nil
+	}
+
+	if _, err := db.Exec(`UPDATE users SET moderator = ?, updated_at = ? WHERE id = ?`, moderator, time.Now(), target.ID); err != nil {
+		return err
+	}
+	var action = dash.AdminPromoteModerator
+	if !moderator {
+		action = dash.AdminDemoteModerator
+	}
+	return recordAdminAction(db, action, source, actorID, target.ID)
+}
+
+// bootstrapAdmin grants the admin role to the given user unless the user is an admin already
+func bootstrapAdmin(db *sql.DB, username string) error {
+	var user, err = findUserByUsername(db, username)
+	if err != nil {
+		return ErrUnknownUser
+	}
+	if user.Admin {
+		return nil
+	}
+
+	if _, err := db.Exec(`UPDATE users SET admin = ?, updated_at = ? WHERE id = ?`, true, time.Now(), user.ID); err != nil {
+		return err
+	}
+	return recordAdminAction(db, dash.AdminGrantAdmin, dash.SourceBootstrap, 0, user.ID)
+}
+
+type moderator struct {
+	Username string `json:"username"`
+	Admin    bool   `json:"admin"`
+}
+
+// listModerators returns all users with global moderation rights, including admins
+func listModerators(db *sql.DB) ([]moderator, error) {
+	var rows, err = db.Query(`SELECT username, admin FROM users WHERE moderator = ? OR admin = ? ORDER BY username`, true, true)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var moderators = make([]moderator, 0)
+	for rows.Next() {
+		var m moderator
+		if err := rows.Scan(&m.Username, &m.Admin); err != nil {
+			return nil, err
+		}
+		moderators = append(moderators, m)
+	}
+	return moderators, nil
+}
+
+type adminModeratorsResponse struct {
+	Status     string      `json:"status"`
+	Moderators []moderator `json:"moderators"`
+}
+
+// AdminModeratorList lists all global moderators
+func AdminModeratorList(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Admin {
+		return ErrNotAdmin
+	}
+
+	var moderators, err = listModerators(db)
+	if err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(adminModeratorsResponse{
+		Status:     "success",
+		Moderators: moderators,
+	})
+	return nil
+}
+
+type adminModeratorRequest struct {
+	Username string `json:"username"`
+}
+
+// AdminModeratorPromote grants global moderation rights to a user
+func AdminModeratorPromote(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Admin {
+		return ErrNotAdmin
+	}
+
+	var payload adminModeratorRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if err := setModerator(db, payload.Username, true, dash.SourceAPI, user.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// AdminModeratorDemote revokes global moderation rights of a user
+func AdminModeratorDemote(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Admin {
+		return ErrNotAdmin
+	}
+
+	var payload adminModeratorRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if err := setModerator(db, payload.Username, false, dash.SourceAPI, user.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type adminLogResponse struct {
+	Status  string             `json:"status"`
+	Actions []dash.AdminAction `json:"actions"`
+}
+
+// AdminLog lists all recorded role changes, newest first
+func AdminLog(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Admin {
+		return ErrNotAdmin
+	}
+
+	var rows, err = db.Query(`SELECT aa.id, aa.action, aa.source, a.username, t.username, aa.created_at
+		FROM admin_actions aa
+		INNER JOIN users t ON t.id = aa.target_user_id
+		LEFT JOIN users a ON a.id = aa.actor_id
+		ORDER BY aa.id DESC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var actions = make([]dash.AdminAction, 0)
+	for rows.Next() {
+		var action dash.AdminAction
+		var actor sql.NullString
+		var createdAt nullTime
+		if err := rows.Scan(&action.ID, &action.Action, &action.Source, &actor, &action.TargetUsername, &createdAt); err != nil {
+			return err
+		}
+		action.ActorUsername = actor.String
+		action.CreatedAt = createdAt.Time
+		actions = append(actions, action)
+	}
+
+	json.NewEncoder(w).Encode(adminLogResponse{
+		Status:  "success",
+		Actions: actions,
+	})
+	return nil
+}
+
+// runModeratorsCommand implements the moderators subcommand: list, promote <username> and demote <username>
+func runModeratorsCommand(env commandEnv, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing moderators command. must either be list, promote or demote")
+	}
+
+	switch args[0] {
+	case "list":
+		var moderators, err = listModerators(env.db)
+		if err != nil {
+			return err
+		}
+		for _, m := range moderators {
+			if m.Admin {
+				fmt.Fprintf(env.out, "%s (admin)\n", m.Username)
+			} else {
+				fmt.Fprintln(env.out, m.Username)
+			}
+		}
+		return nil
+	case "promote", "demote":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: moderators %s <username>", args[0])
+		}
+		if err := setModerator(env.db, args[1], args[0] == "promote", dash.SourceCLI, 0); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "%sd %s\n", args[0], args[1])
+		return nil
+	default:
+		return fmt.Errorf("unknown moderators command %q. must either be list, promote or demote", args[0])
+	}
+}
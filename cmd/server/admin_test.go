@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestAdminModeratorPromote(t *testing.T) {
+	exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "admin-admin", "b")
+	var candidateID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "admin-candidate", "b")
+
+	if err := bootstrapAdmin(db, "admin-admin"); err != nil {
+		t.Fatalf("bootstrapAdmin errored with: %#v", err)
+	}
+	var admin, _ = findUserByUsername(db, "admin-admin")
+	if !admin.Admin || !admin.Moderator {
+		t.Fatalf("Expected the bootstrapped admin to be admin and moderator, got %#v", admin)
+	}
+
+	var candidate = dash.User{ID: candidateID, Username: "admin-candidate"}
+	req, _ := http.NewRequest("POST", "/admin/moderators/promote", strings.NewReader(`{"username":"admin-candidate"}`))
+	if err := AdminModeratorPromote(context.WithValue(rootCtx, UserKey, &candidate), httptest.NewRecorder(), req); err != ErrNotAdmin {
+		t.Fatalf("Expected non-admins to be rejected with %q, got %q", ErrNotAdmin, err)
+	}
+
+	req, _ = http.NewRequest("POST", "/admin/moderators/promote", strings.NewReader(`{"username":"admin-candidate"}`))
+	if err := AdminModeratorPromote(context.WithValue(rootCtx, UserKey, &admin), httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("AdminModeratorPromote errored with: %#v", err)
+	}
+	if promoted, _ := findUserByUsername(db, "admin-candidate"); !promoted.Moderator {
+		t.Errorf("Expected the candidate to be promoted")
+	}
+
+	var out bytes.Buffer
+	if err := runModeratorsCommand(commandEnv{db: db, out: &out}, []string{"demote", "admin-candidate"}); err != nil {
+		t.Fatalf("runModeratorsCommand errored with: %#v", err)
+	}
+	if demoted, _ := findUserByUsername(db, "admin-candidate"); demoted.Moderator {
+		t.Errorf("Expected the candidate to be demoted")
+	}
+	if err := runModeratorsCommand(commandEnv{db: db, out: &out}, []string{"demote", "admin-admin"}); err != ErrDemoteAdmin {
+		t.Errorf("Expected demoting admins to return %q, got %q", ErrDemoteAdmin, err)
+	}
+
+	var sources []string
+	var rows, _ = db.Query(`SELECT aa.source FROM admin_actions aa INNER JOIN users u ON u.id = aa.target_user_id WHERE u.username IN (?, ?) ORDER BY aa.id`, "admin-admin", "admin-candidate")
+	for rows.Next() {
+		var source string
+		rows.Scan(&source)
+		sources = append(sources, source)
+	}
+	rows.Close()
+	if strings.Join(sources, ",") != "bootstrap,api,cli" {
+		t.Errorf("Expected every change to be audited, got %v", sources)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrMissingIdentifier is returned when an identifier should be banned without specifying it
+	ErrMissingIdentifier = newAPIError(http.StatusUnprocessableEntity, "missing_identifier", "Missing parameter: identifier")
+	// ErrMissingPattern is returned when a docset should be banned without a pattern
+	ErrMissingPattern = newAPIError(http.StatusUnprocessableEntity, "missing_pattern", "Missing parameter: pattern")
+	// ErrInvalidPattern is returned when the docset pattern is malformed
+	ErrInvalidPattern = newAPIError(http.StatusUnprocessableEntity, "invalid_pattern", "Invalid parameter: pattern")
+)
+
+// bannedDocsetsTTL is how long banned docset patterns are cached. Bans and unbans through this server take
+// effect immediately, other servers sharing the database pick them up after the TTL
+const bannedDocsetsTTL = time.Minute
+
+// bannedDocsets caches the banned docset patterns, which are checked for every listed page and saved entry
+var bannedDocsets struct {
+	sync.Mutex
+	patterns []string
+	loadedAt time.Time
+}
+
+// bannedDocsetPatterns returns the banned docset patterns, loading them if the cache expired
+func bannedDocsetPatterns(db *sql.DB) ([]string, error) {
+	bannedDocsets.Lock()
+	defer bannedDocsets.Unlock()
+	if bannedDocsets.patterns != nil && time.Since(bannedDocsets.loadedAt) < bannedDocsetsTTL {
+		return bannedDocsets.patterns, nil
+	}
+
+	var rows, err = db.Query(`SELECT pattern FROM banned_docsets`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var patterns = make([]string, 0)
+	for rows.Next() {
+		var pattern string
+		if err := rows.Scan(&pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	bannedDocsets.patterns, bannedDocsets.loadedAt = patterns, time.Now()
+	return patterns, nil
+}
+
+// invalidateBannedDocsets drops the cached patterns after docsets were banned or unbanned
+func invalidateBannedDocsets() {
+	bannedDocsets.Lock()
+	bannedDocsets.patterns = nil
+	bannedDocsets.Unlock()
+}
+
+// isDocsetBanned reports whether the docset filename matches any banned docset pattern
+func isDocsetBanned(db *sql.DB, docsetFilename string) bool {
+	var patterns, err = bannedDocsetPatterns(db)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, docsetFilename); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// removeBannedEntriesFromPublic removes all visible public entries on identifiers accepted by match
+func removeBannedEntriesFromPublic(db *sql.DB, match func(identifierID int, docsetFilename string) bool, moderator dash.User, reason string) error {
+	var rows, err = db.Query(`SELECT e.id, e.identifier_id, i.docset_filename
+		FROM entries e
+		INNER JOIN identifiers i ON i.id = e.identifier_id
+		WHERE e.public = ? AND e.removed_from_public = ?`, true, false)
+	if err != nil {
+		return err
+	}
+
+	var entryIDs = make([]int, 0)
+	for rows.Next() {
+		var entryID, identifierID int
+		var docsetFilename string
+		if err := rows.Scan(&entryID, &identifierID, &docsetFilename); err != nil {
+			rows.Close()
+			return err
+		}
+		if match(identifierID, docsetFilename) {
+			entryIDs = append(entryIDs, entryID)
+		}
+	}
+	rows.Close()
+
+	var tx *sql.Tx
+	if tx, err = db.Begin(); err != nil {
+		return err
+	}
+	for _, entryID := range entryIDs {
+		var entry, err = findEntryByID(db, entryID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := setEntryRemovedFromPublic(tx, entry, true, moderator, reason); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type identifierBanRequest struct {
+	Identifier     dash.Identifier `json:"identifier"`
+	RemoveExisting bool            `json:"remove_existing"`
+	Reason         string          `json:"reason"`
+}
+
+// IdentifierBan allows moderators to forbid public annotations on a single page. Existing
+// public annotations are removed from public if requested
+func IdentifierBan(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Moderator {
+		return ErrNotModerator
+	}
+
+	var payload identifierBanRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.Identifier.IsEmpty() {
+		return ErrMissingIdentifier
+	}
+	if err := upsertIdentifier(db, &payload.Identifier); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE identifiers SET banned_from_public = ?, updated_at = ? WHERE id = ?`, true, time.Now(), payload.Identifier.ID); err != nil {
+		return err
+	}
+
+	if payload.RemoveExisting {
+		var match = func(identifierID int, docsetFilename string) bool {
+			return identifierID == payload.Identifier.ID
+		}
+		if err := removeBannedEntriesFromPublic(db, match, *user, payload.Reason); err != nil {
+			return err
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// IdentifierUnban allows moderators to permit public annotations on a single page again
+func IdentifierUnban(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Moderator {
+		return ErrNotModerator
+	}
+
+	var payload identifierBanRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.Identifier.IsEmpty() {
+		return ErrMissingIdentifier
+	}
+	findIdentifier(db, &payload.Identifier)
+	if payload.Identifier.ID != 0 {
+		if _, err := db.Exec(`UPDATE identifiers SET banned_from_public = ?, updated_at = ? WHERE id = ?`, false, time.Now(), payload.Identifier.ID); err != nil {
+			return err
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type docsetBanRequest struct {
+	Pattern        string `json:"pattern"`
+	RemoveExisting bool   `json:"remove_existing"`
+	Reason         string `json:"reason"`
+}
+
+// validDocsetPattern trims the pattern and makes sure it's a valid glob pattern, e.g. "Apple_*"
+func validDocsetPattern(pattern string) (string, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return pattern, ErrMissingPattern
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return pattern, ErrInvalidPattern
+	}
+	return pattern, nil
+}
+
+// DocsetBan allows moderators to forbid public annotations on all docsets whose filename matches the pattern
+func DocsetBan(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Moderator {
+		return ErrNotModerator
+	}
+
+	var payload docsetBanRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var pattern, err = validDocsetPattern(payload.Pattern)
+	if err != nil {
+		return err
+	}
+
+	var cnt = 0
+	db.QueryRow(`SELECT count(*) FROM banned_docsets WHERE pattern = ?`, pattern).Scan(&cnt)
+	if cnt == 0 {
+		if _, err := db.Exec(`INSERT INTO banned_docsets (pattern, user_id, created_at) VALUES (?, ?, ?)`, pattern, user.ID, time.Now()); err != nil {
+			return err
+		}
+		invalidateBannedDocsets()
+	}
+
+	if payload.RemoveExisting {
+		var match = func(identifierID int, docsetFilename string) bool {
+			var matched, _ = path.Match(pattern, docsetFilename)
+			return matched
+		}
+		if err := removeBannedEntriesFromPublic(db, match, *user, payload.Reason); err != nil {
+			return err
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// DocsetUnban allows moderators to remove a banned docset pattern
+func DocsetUnban(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Moderator {
+		return ErrNotModerator
+	}
+
+	var payload docsetBanRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var pattern, err = validDocsetPattern(payload.Pattern)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM banned_docsets WHERE pattern = ?`, pattern); err != nil {
+		return err
+	}
+	invalidateBannedDocsets()
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type bannedListResponse struct {
+	Status         string            `json:"status"`
+	Identifiers    []dash.Identifier `json:"identifiers"`
+	DocsetPatterns []string          `json:"docset_patterns"`
+}
+
+// BannedList lists all identifiers and docset patterns banned from public annotations
+func BannedList(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Moderator {
+		return ErrNotModerator
+	}
+
+	var resp = bannedListResponse{
+		Status:         "success",
+		Identifiers:    make([]dash.Identifier, 0),
+		DocsetPatterns: make([]string, 0),
+	}
+
+	var rows, err = db.Query(`SELECT docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source FROM identifiers WHERE banned_from_public = ? ORDER BY docset_filename, page_path`, true)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var identifier = dash.Identifier{BannedFromPublic: true}
+		if err := rows.Scan(&identifier.DocsetName, &identifier.DocsetFilename, &identifier.DocsetPlatform, &identifier.DocsetBundle, &identifier.DocsetVersion, &identifier.PagePath, &identifier.PageTitle, &identifier.HttrackSource); err != nil {
+			rows.Close()
+			return err
+		}
+		resp.Identifiers = append(resp.Identifiers, identifier)
+	}
+	rows.Close()
+
+	if rows, err = db.Query(`SELECT pattern FROM banned_docsets ORDER BY pattern`); err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pattern string
+		if err := rows.Scan(&pattern); err != nil {
+			return err
+		}
+		resp.DocsetPatterns = append(resp.DocsetPatterns, pattern)
+	}
+
+	json.NewEncoder(w).Encode(resp)
+	return nil
+}
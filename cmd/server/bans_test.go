@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestDocsetBan_RemoveExisting(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "ban-author", "b")
+	var moderatorID = exec(`INSERT INTO users (username, password, moderator) VALUES (?, ?, ?)`, "ban-moderator", "b", true)
+	var bannedID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Banned", "Banned_Docs", "c", "d", "e", "f", "g", "h", false)
+	var allowedID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Allowed", "Allowed_Docs", "c", "d", "e", "f", "g", "h", false)
+	var bannedEntryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "a", "b", "b", "comment", bannedID, "c", authorID, true, false, 0)
+	var allowedEntryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "a", "b", "b", "comment", allowedID, "c", authorID, true, false, 0)
+	var privateEntryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "a", "b", "b", "comment", bannedID, "c", authorID, false, false, 0)
+
+	var author = dash.User{ID: authorID, Username: "ban-author"}
+	var moderator = dash.User{ID: moderatorID, Username: "ban-moderator", Moderator: true}
+
+	var ctx = context.WithValue(rootCtx, UserKey, &moderator)
+	req, _ := http.NewRequest("POST", "/identifiers/ban_docset", strings.NewReader(`{"pattern":"Banned_*","remove_existing":true,"reason":"licensing"}`))
+	if err := DocsetBan(ctx, httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("DocsetBan errored with: %#v", err)
+	}
+
+	var banned, _ = findEntryByID(db, bannedEntryID)
+	if !banned.RemovedFromPublic {
+		t.Errorf("Expected public entries on banned docsets to be removed from public")
+	}
+	var allowed, _ = findEntryByID(db, allowedEntryID)
+	if allowed.RemovedFromPublic {
+		t.Errorf("Expected public entries on other docsets to stay public")
+	}
+
+	ctx = context.WithValue(rootCtx, UserKey, &author)
+	req, _ = http.NewRequest("POST", "/entries/save", strings.NewReader(fmt.Sprintf(`{"entry_id":%d,"title":"a","body":"b","anchor":"c","public":true}`, privateEntryID)))
+	var err = WithEntry(ContextHandlerFunc(EntrySave)).ServeHTTPContext(ctx, httptest.NewRecorder(), req)
+	if err != ErrPublicAnnotationForbidden {
+		t.Errorf("Expected publishing on a banned docset to return %q, got %q", ErrPublicAnnotationForbidden, err)
+	}
+
+	req, _ = http.NewRequest("POST", "/identifiers/ban_docset", strings.NewReader(`{"pattern":"[Banned"}`))
+	ctx = context.WithValue(rootCtx, UserKey, &moderator)
+	if err := DocsetBan(ctx, httptest.NewRecorder(), req); err != ErrInvalidPattern {
+		t.Errorf("Expected malformed patterns to return %q, got %q", ErrInvalidPattern, err)
+	}
+
+	// unbanning takes effect immediately despite the cached patterns
+	req, _ = http.NewRequest("POST", "/identifiers/unban_docset", strings.NewReader(`{"pattern":"Banned_*"}`))
+	if err := DocsetUnban(ctx, httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("DocsetUnban errored with: %#v", err)
+	}
+	if isDocsetBanned(db, "Banned_Docs") {
+		t.Errorf("Expected the docset to be allowed again after unbanning")
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+// commandEnv holds everything a subcommand needs. All subcommands share the --driver and --datasource flags
+type commandEnv struct {
+	db       *sql.DB
+	driver   string
+	renderer Renderer
+	out      io.Writer
+}
+
+type command struct {
+	usage string
+	help  string
+	// skipMigrations prevents pending migrations from being applied before the command runs
+	skipMigrations bool
+	run            func(env commandEnv, args []string) error
+}
+
+// commandNames lists all subcommands in the order they are printed by --help
+var commandNames = []string{"rerender", "moderators", "users", "teams", "entries", "migrate"}
+
+var commands = map[string]command{
+	"rerender": {
+		usage: "rerender",
+		help:  "rebuild the rendered body of all entries",
+		run:   runRerenderCommand,
+	},
+	"moderators": {
+		usage: "moderators list|promote <username>|demote <username>",
+		help:  "manage global moderators",
+		run:   runModeratorsCommand,
+	},
+	"users": {
+		usage: "users list|create <username> <password>|reset-password <username> [password]|disable <username>|enable <username>|delete <username> reassign|delete",
+		help:  "manage user accounts",
+		run:   runUsersCommand,
+	},
+	"teams": {
+		usage: "teams list|delete <name>|transfer <name> <username>",
+		help:  "manage teams",
+		run:   runTeamsCommand,
+	},
+	"entries": {
+		usage: "entries purge [-user <username>] [-docset <docset_filename>] [-removed] [-dry-run]",
+		help:  "permanently delete all entries matching the given filters",
+		run:   runEntriesCommand,
+	},
+	"migrate": {
+		usage:          "migrate status|up|down [steps]",
+		help:           "inspect or change the database schema version",
+		skipMigrations: true,
+		run:            runMigrateCommand,
+	},
+}
+
+func printCommandUsage(out io.Writer) {
+	for _, name := range commandNames {
+		fmt.Fprintf(out, "  %s\n    \t%s, then exit\n", commands[name].usage, commands[name].help)
+	}
+}
+
+func runRerenderCommand(env commandEnv, args []string) error {
+	var count, err = rerenderEntries(env.db, env.renderer)
+	if err != nil {
+		return fmt.Errorf("failed to rerender entries: %v", err)
+	}
+	fmt.Fprintf(env.out, "rerendered %d entries\n", count)
+	return nil
+}
+
+// findUserForCommand looks up the user or returns a readable error
+func findUserForCommand(db *sql.DB, username string) (dash.User, error) {
+	var user, err = findUserByUsername(db, username)
+	if err != nil {
+		return user, fmt.Errorf("unknown user %q", username)
+	}
+	return user, nil
+}
+
+func runUsersCommand(env commandEnv, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing users command. must either be list, create, reset-password, disable, enable or delete")
+	}
+
+	var store = &sqlUserStorage{db: env.db}
+	switch args[0] {
+	case "list":
+		var rows, err = env.db.Query(`SELECT id, username, email, moderator, admin, disabled FROM users WHERE ghost = ? ORDER BY username`, false)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var w = tabwriter.NewWriter(env.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tFLAGS")
+		for rows.Next() {
+			var user dash.User
+			if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Moderator, &user.Admin, &user.Disabled); err != nil {
+				return err
+			}
+			var flags = make([]string, 0)
+			if user.Admin {
+				flags = append(flags, "admin")
+			}
+			if user.Moderator {
+				flags = append(flags, "moderator")
+			}
+			if user.Disabled {
+				flags = append(flags, "disabled")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", user.ID, user.Username, user.Email.String, strings.Join(flags, ","))
+		}
+		return w.Flush()
+	case "create":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: users create <username> <password>")
+		}
+		if err := store.InsertUser(args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "created %s\n", args[1])
+		return nil
+	case "reset-password":
+		if len(args) != 2 && len(args) != 3 {
+			return fmt.Errorf("usage: users reset-password <username> [password]")
+		}
+		if _, err := findUserForCommand(env.db, args[1]); err != nil {
+			return err
+		}
+		var password string
+		if len(args) == 3 {
+			password = args[2]
+		} else {
+			password, _ = generateRandomString(12)
+		}
+		if err := store.UpdateUserWithPassword(args[1], password); err != nil {
+			return err
+		}
+		if err := store.UpdateUserWithToken(args[1], ""); err != nil {
+			return err
+		}
+		if len(args) == 3 {
+			fmt.Fprintf(env.out, "changed password of %s\n", args[1])
+		} else {
+			fmt.Fprintf(env.out, "changed password of %s to %s\n", args[1], password)
+		}
+		return nil
+	case "disable", "enable":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: users %s <username>", args[0])
+		}
+		var user, err = findUserForCommand(env.db, args[1])
+		if err != nil {
+			return err
+		}
+		if err := setSuspended(env.db, user.Username, args[0] == "disable", dash.SourceCLI, 0); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "%sd %s\n", args[0], args[1])
+		return nil
+	case "delete":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: users delete <username> reassign|delete")
+		}
+		var user, err = findUserForCommand(env.db, args[1])
+		if err != nil {
+			return err
+		}
+		if err := deleteUserAccount(env.db, user, args[2]); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "deleted %s\n", args[1])
+		return nil
+	default:
+		return fmt.Errorf("unknown users command %q. must either be list, create, reset-password, disable, enable or delete", args[0])
+	}
+}
+
+func runTeamsCommand(env commandEnv, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing teams command. must either be list, delete or transfer")
+	}
+
+	switch args[0] {
+	case "list":
+		var rows, err = env.db.Query(`SELECT t.name, u.username, (SELECT count(*) FROM team_user WHERE team_id = t.id), (SELECT count(*) FROM entry_team WHERE team_id = t.id)
+			FROM teams t
+			INNER JOIN team_user tu ON tu.team_id = t.id AND tu.role = ?
+			INNER JOIN users u ON u.id = tu.user_id
+			ORDER BY t.name`, "owner")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var w = tabwriter.NewWriter(env.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tOWNER\tMEMBERS\tENTRIES")
+		for rows.Next() {
+			var name, owner string
+			var members, entries int
+			if err := rows.Scan(&name, &owner, &members, &entries); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", name, owner, members, entries)
+		}
+		return w.Flush()
+	case "delete":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: teams delete <name>")
+		}
+		var team, err = findTeamByName(env.db, args[1])
+		if err != nil {
+			return fmt.Errorf("unknown team %q", args[1])
+		}
+		var tx *sql.Tx
+		if tx, err = env.db.Begin(); err != nil {
+			return err
+		}
+		if err := deleteTeam(tx, team.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "deleted %s\n", args[1])
+		return nil
+	case "transfer":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: teams transfer <name> <username>")
+		}
+		var team, err = findTeamByName(env.db, args[1])
+		if err != nil {
+			return fmt.Errorf("unknown team %q", args[1])
+		}
+		var newOwner dash.User
+		if newOwner, err = findUserForCommand(env.db, args[2]); err != nil {
+			return err
+		}
+		if err := transferTeamOwnership(env.db, team, newOwner, 0); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "transferred %s to %s\n", args[1], args[2])
+		return nil
+	default:
+		return fmt.Errorf("unknown teams command %q. must either be list, delete or transfer", args[0])
+	}
+}
+
+func runEntriesCommand(env commandEnv, args []string) error {
+	if len(args) == 0 || args[0] != "purge" {
+		return fmt.Errorf("missing entries command. must be purge")
+	}
+
+	var (
+		username string
+		docset   string
+		removed  bool
+		dryRun   bool
+	)
+	var flags = flag.NewFlagSet("entries purge", flag.ContinueOnError)
+	flags.SetOutput(env.out)
+	flags.StringVar(&username, "user", "", "only purge entries written by this user")
+	flags.StringVar(&docset, "docset", "", "only purge entries on this docset filename")
+	flags.BoolVar(&removed, "removed", false, "only purge entries removed from public")
+	flags.BoolVar(&dryRun, "dry-run", false, "only print how many entries would be purged")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if username == "" && docset == "" && !removed {
+		return fmt.Errorf("refusing to purge all entries. specify at least one of -user, -docset or -removed")
+	}
+
+	var query = `SELECT e.id FROM entries e INNER JOIN identifiers i ON i.id = e.identifier_id WHERE 1 = 1`
+	var params = make([]interface{}, 0)
+	if username != "" {
+		var user, err = findUserForCommand(env.db, username)
+		if err != nil {
+			return err
+		}
+		query += ` AND e.user_id = ?`
+		params = append(params, user.ID)
+	}
+	if docset != "" {
+		query += ` AND i.docset_filename = ?`
+		params = append(params, docset)
+	}
+	if removed {
+		query += ` AND e.removed_from_public = ?`
+		params = append(params, true)
+	}
+
+	var rows, err = env.db.Query(query, params...)
+	if err != nil {
+		return err
+	}
+	var entryIDs = make([]interface{}, 0)
+	for rows.Next() {
+		var entryID int
+		if err := rows.Scan(&entryID); err != nil {
+			rows.Close()
+			return err
+		}
+		entryIDs = append(entryIDs, entryID)
+	}
+	rows.Close()
+
+	if dryRun || len(entryIDs) == 0 {
+		fmt.Fprintf(env.out, "would purge %d entries\n", len(entryIDs))
+		return nil
+	}
+
+	var tx *sql.Tx
+	if tx, err = env.db.Begin(); err != nil {
+		return err
+	}
+	if err := deleteEntries(tx, entryIDs); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.out, "purged %d entries\n", len(entryIDs))
+	return nil
+}
+
+func runMigrateCommand(env commandEnv, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command. must either be status, up or down")
+	}
+
+	var m, err = newMigrator(env.db, env.driver)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "status":
+		var version, dirty, err = m.Version()
+		if err != nil && err != migrate.ErrNilVersion {
+			return err
+		}
+		for _, migration := range migrations {
+			var number, _ = strconv.Atoi(strings.SplitN(migration, "_", 2)[0])
+			var state = "pending"
+			if err != migrate.ErrNilVersion && uint(number) <= version {
+				state = "applied"
+				if dirty && uint(number) == version {
+					state = "dirty"
+				}
+			}
+			fmt.Fprintf(env.out, "%-8s %s\n", state, migration)
+		}
+		return nil
+	case "up":
+		if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+			return err
+		}
+	case "down":
+		var steps = 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		if err := m.Steps(-steps); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q. must either be status, up or down", args[0])
+	}
+
+	var version, _, _ = m.Version()
+	fmt.Fprintf(env.out, "schema version is now %d\n", version)
+	return nil
+}
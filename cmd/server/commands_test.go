@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUsersCommand_Disable(t *testing.T) {
+	var out bytes.Buffer
+	var env = commandEnv{db: db, out: &out}
+	if err := runUsersCommand(env, []string{"create", "cli-user", "secret"}); err != nil {
+		t.Fatalf("users create errored with: %#v", err)
+	}
+	exec(`UPDATE users SET remember_token = ? WHERE username = ?`, "cli-token", "cli-user")
+
+	if err := runUsersCommand(env, []string{"disable", "cli-user"}); err != nil {
+		t.Fatalf("users disable errored with: %#v", err)
+	}
+	var user, _ = findUserByUsername(db, "cli-user")
+	if !user.Disabled || user.RememberToken.Valid {
+		t.Fatalf("Expected the user to be disabled and logged out, got %#v", user)
+	}
+
+	exec(`UPDATE users SET remember_token = ? WHERE username = ?`, "cli-token", "cli-user")
+	var session, _ = encrypt([]byte("cli-token"))
+	req, _ := http.NewRequest("POST", "/dont-care", nil)
+	req.AddCookie(&http.Cookie{Name: "laravel_session", Value: string(session)})
+	var err = Authenticated(ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		t.Fatalf("Expected Authenticated to halt the request")
+		return nil
+	})).ServeHTTPContext(rootCtx, httptest.NewRecorder(), req)
+	if err != ErrUserDisabled {
+		t.Errorf("Expected disabled users to be rejected with %q, got %q", ErrUserDisabled, err)
+	}
+}
+
+func TestUsersCommand_Ghost(t *testing.T) {
+	var tx, _ = db.Begin()
+	var ghostID, err = findOrCreateGhostUser(tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("findOrCreateGhostUser errored with: %#v", err)
+	}
+	tx.Commit()
+	var ghost, _ = findUserByID(db, ghostID)
+
+	var out bytes.Buffer
+	var env = commandEnv{db: db, out: &out}
+	if err := runUsersCommand(env, []string{"list"}); err != nil {
+		t.Fatalf("users list errored with: %#v", err)
+	}
+	if strings.Contains(out.String(), ghost.Username) {
+		t.Errorf("Expected the ghost user not to be listed, got %q", out.String())
+	}
+	if err := runUsersCommand(env, []string{"delete", ghost.Username, "reassign"}); err != ErrDeleteGhostUser {
+		t.Errorf("Expected deleting the ghost user to fail with %q, got %q", ErrDeleteGhostUser, err)
+	}
+}
+
+func TestEntriesCommand_Purge(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "purge-author", "b")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Purge", "Purge", "c", "d", "e", "f", "g", "h", false)
+	var removedID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "a", "b", "b", "comment", identifierID, "c", authorID, true, true, 0)
+	var keptID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "a", "b", "b", "comment", identifierID, "c", authorID, true, false, 0)
+
+	var out bytes.Buffer
+	var env = commandEnv{db: db, out: &out}
+	if err := runEntriesCommand(env, []string{"purge"}); err == nil {
+		t.Fatalf("Expected purge without filters to be refused")
+	}
+	if err := runEntriesCommand(env, []string{"purge", "-user", "purge-author", "-removed"}); err != nil {
+		t.Fatalf("entries purge errored with: %#v", err)
+	}
+
+	if _, err := findEntryByID(db, removedID); err == nil {
+		t.Errorf("Expected the removed entry to be purged")
+	}
+	if _, err := findEntryByID(db, keptID); err != nil {
+		t.Errorf("Expected the visible entry to be kept, got %q", err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+// DigestItem describes a single event inside a digest
+type DigestItem struct {
+	Kind           string    `json:"kind"`
+	EntryID        int       `json:"entry_id"`
+	EntryTitle     string    `json:"entry_title"`
+	Actor          string    `json:"actor"`
+	DocsetFilename string    `json:"docset_filename"`
+	PageTitle      string    `json:"page_title"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Digest summarizes the events on all docsets and pages a user subscribed to
+type Digest struct {
+	Username  string       `json:"username"`
+	Frequency string       `json:"frequency"`
+	Since     time.Time    `json:"since"`
+	Until     time.Time    `json:"until"`
+	Items     []DigestItem `json:"items"`
+}
+
+// DigestSender delivers digests to users
+type DigestSender interface {
+	SendDigest(user dash.User, digest Digest) error
+}
+
+type mailDigestSender struct {
+	mailer Mailer
+}
+
+func (s *mailDigestSender) SendDigest(user dash.User, digest Digest) error {
+	if user.Email.String == "" {
+		return nil
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Annotation activity since %s:\n\n", digest.Since.Format("2006-01-02 15:04"))
+	for _, item := range digest.Items {
+		fmt.Fprintf(&body, "- %s: %q on %s (%s) by %s\n", strings.Replace(item.Kind, "_", " ", -1), item.EntryTitle, item.PageTitle, item.DocsetFilename, item.Actor)
+	}
+	return s.mailer.SendMail(user.Email.String, fmt.Sprintf("Your %s annotation digest", digest.Frequency), body.String())
+}
+
+type webhookDigestSender struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookDigestSender) SendDigest(user dash.User, digest Digest) error {
+	var payload, err = json.Marshal(digest)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// fileDigestSender writes every digest as json file into a directory. It's meant as
+// a stand-in for tests and local setups
+type fileDigestSender struct {
+	dir string
+}
+
+func (s *fileDigestSender) SendDigest(user dash.User, digest Digest) error {
+	var payload, err = json.MarshalIndent(digest, "", "  ")
+	if err != nil {
+		return err
+	}
+	var name = fmt.Sprintf("%s-%s-%d.json", user.Username, digest.Frequency, digest.Until.Unix())
+	return os.WriteFile(filepath.Join(s.dir, name), payload, 0600)
+}
+
+// newDigestSender returns the DigestSender with the given name
+func newDigestSender(name, webhookURL, dir string, mailer Mailer) (DigestSender, error) {
+	switch name {
+	case "email":
+		return &mailDigestSender{mailer: mailer}, nil
+	case "webhook":
+		if webhookURL == "" {
+			return nil, fmt.Errorf("the webhook digest sender requires a webhook url")
+		}
+		return &webhookDigestSender{url: webhookURL, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "file":
+		if dir == "" {
+			return nil, fmt.Errorf("the file digest sender requires a directory")
+		}
+		return &fileDigestSender{dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown digest sender %q. Must either be email, webhook or file", name)
+	}
+}
+
+var digestPeriods = map[string]time.Duration{
+	dash.DigestDaily:  24 * time.Hour,
+	dash.DigestWeekly: 7 * 24 * time.Hour,
+}
+
+type digestGroup struct {
+	userID    int
+	frequency string
+	since     time.Time
+}
+
+// findDueDigests returns all user and frequency combinations whose last digest is older than their period
+func findDueDigests(db *sql.DB, now time.Time) ([]digestGroup, error) {
+	var rows, err = db.Query(`SELECT user_id, frequency, last_digest_at, created_at FROM subscriptions ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups = make([]digestGroup, 0)
+	var index = map[string]int{}
+	for rows.Next() {
+		var group digestGroup
+		var lastDigestAt, createdAt nullTime
+		if err := rows.Scan(&group.userID, &group.frequency, &lastDigestAt, &createdAt); err != nil {
+			return nil, err
+		}
+		group.since = createdAt.Time
+		if lastDigestAt.Valid {
+			group.since = lastDigestAt.Time
+		}
+
+		var key = fmt.Sprintf("%d-%s", group.userID, group.frequency)
+		if i, ok := index[key]; ok {
+			if group.since.Before(groups[i].since) {
+				groups[i].since = group.since
+			}
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, group)
+	}
+
+	var due = make([]digestGroup, 0)
+	for _, group := range groups {
+		if now.Sub(group.since) >= digestPeriods[group.frequency] {
+			due = append(due, group)
+		}
+	}
+	return due, nil
+}
+
+// buildDigest collects all events on subscribed docsets and pages which happened between since and until.
+// Events caused by the user or on entries the user cannot see are skipped
+func buildDigest(db *sql.DB, user dash.User, group digestGroup, until time.Time) (Digest, error) {
+	var digest = Digest{
+		Username:  user.Username,
+		Frequency: group.frequency,
+		Since:     group.since,
+		Until:     until,
+		Items:     make([]DigestItem, 0),
+	}
+
+	var rows, err = db.Query(`SELECT DISTINCT ev.id, ev.kind, ev.entry_id, e.title, u.username, i.docset_filename, i.page_title, ev.created_at
+		FROM events ev
+		INNER JOIN entries e ON e.id = ev.entry_id
+		INNER JOIN identifiers i ON i.id = ev.identifier_id
+		INNER JOIN users u ON u.id = ev.actor_id
+		INNER JOIN subscriptions s ON s.user_id = ? AND s.frequency = ?
+			AND (s.identifier_id = ev.identifier_id OR (s.identifier_id IS NULL AND s.docset_filename = i.docset_filename))
+		WHERE ev.created_at > ? AND ev.created_at <= ? AND ev.actor_id != ?
+		ORDER BY ev.id`, user.ID, group.frequency, group.since, until, user.ID)
+	if err != nil {
+		return digest, err
+	}
+
+	var items = make([]DigestItem, 0)
+	for rows.Next() {
+		var item DigestItem
+		var eventID int
+		var createdAt nullTime
+		if err := rows.Scan(&eventID, &item.Kind, &item.EntryID, &item.EntryTitle, &item.Actor, &item.DocsetFilename, &item.PageTitle, &createdAt); err != nil {
+			rows.Close()
+			return digest, err
+		}
+		item.CreatedAt = createdAt.Time
+		items = append(items, item)
+	}
+	rows.Close()
+
+	for _, item := range items {
+		if canSeeEntry(db, item.EntryID, user.ID) {
+			digest.Items = append(digest.Items, item)
+		}
+	}
+	return digest, nil
+}
+
+// sendDigests delivers all due digests. Empty digests are not sent, but still mark the period as done
+func sendDigests(db *sql.DB, sender DigestSender, now time.Time) error {
+	var groups, err = findDueDigests(db, now)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		var user dash.User
+		if user, err = findUserByID(db, group.userID); err != nil {
+			return err
+		}
+
+		var digest Digest
+		if digest, err = buildDigest(db, user, group, now); err != nil {
+			return err
+		}
+		if len(digest.Items) > 0 {
+			if err := sender.SendDigest(user, digest); err != nil {
+				log.Printf("failed to deliver %s digest to %q: %v\n", group.frequency, user.Username, err)
+				continue
+			}
+		}
+
+		if _, err := db.Exec(`UPDATE subscriptions SET last_digest_at = ? WHERE user_id = ? AND frequency = ?`, now, group.userID, group.frequency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runDigestScheduler periodically sends due digests until the process exits
+func runDigestScheduler(db *sql.DB, sender DigestSender, interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := sendDigests(db, sender, now); err != nil {
+			log.Printf("failed to send digests: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestSendDigests_FileSender(t *testing.T) {
+	var subscriberID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "digest-subscriber", "b")
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "digest-author", "b")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Digest", "Digest", "c", "d", "e", "f", "Digest Page", "h", false)
+	var publicID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "public notes", "b", "b", "comment", identifierID, "c", authorID, true, false, 1)
+	var privateID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "private notes", "b", "b", "comment", identifierID, "c", authorID, false, false, 1)
+	exec(`INSERT INTO subscriptions (user_id, docset_filename, frequency, created_at) VALUES (?, ?, ?, ?)`, subscriberID, "Digest", dash.DigestDaily, time.Now().Add(-48*time.Hour))
+
+	for _, event := range []dash.Event{
+		{Kind: dash.EventEntryCreated, ActorID: authorID, EntryID: publicID, IdentifierID: identifierID},
+		{Kind: dash.EventEntryCreated, ActorID: authorID, EntryID: privateID, IdentifierID: identifierID},
+		{Kind: dash.EventEntryVoted, ActorID: subscriberID, EntryID: publicID, IdentifierID: identifierID},
+	} {
+		if err := recordEvent(db, event); err != nil {
+			t.Fatalf("Failed to record event: %v", err)
+		}
+	}
+
+	var dir = t.TempDir()
+	var now = time.Now().Add(time.Second)
+	if err := sendDigests(db, &fileDigestSender{dir: dir}, now); err != nil {
+		t.Fatalf("Expected sendDigests not to return an error, got %q", err)
+	}
+
+	var files, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected a single digest, got %v", files)
+	}
+	var raw, _ = os.ReadFile(files[0])
+	var digest Digest
+	if err := json.Unmarshal(raw, &digest); err != nil {
+		t.Fatalf("Failed to decode digest: %v", err)
+	}
+	if digest.Username != "digest-subscriber" || len(digest.Items) != 1 || digest.Items[0].EntryID != publicID {
+		t.Fatalf("Expected the digest to only contain the visible entry by another user, got %+v", digest)
+	}
+
+	if err := sendDigests(db, &fileDigestSender{dir: dir}, now.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected sendDigests not to return an error, got %q", err)
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Errorf("Expected no digest before the period passed, got %v", files)
+	}
+}
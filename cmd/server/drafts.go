@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrPublishForbidden is returned when a user tries to publish a draft he did not write
+	ErrPublishForbidden = newAPIError(http.StatusForbidden, "publish_forbidden", "Only the author can publish an entry")
+	// ErrNotDraft is returned when a published entry should be published again
+	ErrNotDraft = newAPIError(http.StatusConflict, "not_draft", "The entry is already published")
+	// ErrNothingToApprove is returned when an entry has no pending approvals in the teams of the current user
+	ErrNothingToApprove = newAPIError(http.StatusConflict, "nothing_to_approve", "The entry awaits no approval from your teams")
+)
+
+// linkEntryTeams updates the teams an entry is shared with. Teams requiring approval only show the entry once
+// a team moderator approved it. Rows of teams the entry stays shared with are kept, including their approval,
+// removal by moderators and the former member mark
+func linkEntryTeams(db *sql.DB, entry dash.Entry, user dash.User) {
+	var linked = map[int]bool{}
+	if rows, err := db.Query(`SELECT team_id, approved FROM entry_team WHERE entry_id = ?`, entry.ID); err == nil {
+		for rows.Next() {
+			var teamID int
+			var approved bool
+			rows.Scan(&teamID, &approved)
+			linked[teamID] = approved
+		}
+		rows.Close()
+	}
+
+	var requested = map[int]bool{}
+	for _, t := range entry.Teams {
+		var teamID int
+		var requiresApproval bool
+		if err := db.QueryRow(`SELECT id, requires_approval FROM teams WHERE name = ? LIMIT 1`, t).Scan(&teamID, &requiresApproval); err != nil {
+			continue
+		}
+		requested[teamID] = true
+
+		var isApproved = !requiresApproval || membershipCan(user, teamID, dash.CapabilityModerateEntries)
+		if approved, ok := linked[teamID]; !ok {
+			db.Exec(`INSERT INTO entry_team (entry_id, team_id, approved, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, entry.ID, teamID, isApproved, time.Now(), time.Now())
+		} else if !approved && isApproved {
+			db.Exec(`UPDATE entry_team SET approved = ?, updated_at = ? WHERE entry_id = ? AND team_id = ?`, true, time.Now(), entry.ID, teamID)
+		}
+	}
+	for teamID := range linked {
+		if !requested[teamID] {
+			db.Exec(`DELETE FROM entry_team WHERE entry_id = ? AND team_id = ?`, entry.ID, teamID)
+		}
+	}
+}
+
+// EntryPublish moves a draft to its requested visibility
+func EntryPublish(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var entry = ctx.Value(EntryKey).(*dash.Entry)
+
+	if entry.UserID != user.ID {
+		return ErrPublishForbidden
+	}
+	if !entry.Draft {
+		return ErrNotDraft
+	}
+
+	if _, err := db.Exec(`UPDATE entries SET draft = ?, updated_at = ? WHERE id = ?`, false, time.Now(), entry.ID); err != nil {
+		return err
+	}
+	entry.Draft = false
+	linkEntryTeams(db, *entry, *user)
+
+	if err := notifyMentions(db, mailerFromContext(ctx), *entry, *user); err != nil {
+		return err
+	}
+	if err := recordEvent(db, dash.Event{Kind: dash.EventEntryPublished, ActorID: user.ID, EntryID: entry.ID, IdentifierID: entry.IdentifierID}); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(entrySaveResponse{
+		Entry:  *entry,
+		Status: "success",
+	})
+	return nil
+}
+
+// EntryApprove allows team moderators to approve an entry shared with their teams
+func EntryApprove(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var entry = ctx.Value(EntryKey).(*dash.Entry)
+
+	var approved int64
+	for _, membership := range user.TeamMemberships {
+		if !membership.Can(dash.CapabilityModerateEntries) {
+			continue
+		}
+		var res, err = db.Exec(`UPDATE entry_team SET approved = ?, updated_at = ? WHERE entry_id = ? AND team_id = ? AND approved = ?`, true, time.Now(), entry.ID, membership.TeamID, false)
+		if err != nil {
+			return err
+		}
+		var affected, _ = res.RowsAffected()
+		approved += affected
+	}
+	if approved == 0 {
+		return ErrNothingToApprove
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type teamPendingEntriesResponse struct {
+	Status  string       `json:"status"`
+	Entries []dash.Entry `json:"entries"`
+}
+
+// TeamPendingEntries lists all published entries awaiting approval by the team moderators
+func TeamPendingEntries(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityModerateEntries); err != nil {
+		return err
+	}
+
+	var rows, err = db.Query(`SELECT e.id, e.title, e.type, e.anchor, e.score
+		FROM entries e
+		INNER JOIN entry_team et ON et.entry_id = e.id
+		WHERE et.team_id = ? AND et.approved = ? AND e.draft = ?
+		ORDER BY e.id`, team.ID, false, false)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var entries = make([]dash.Entry, 0)
+	for rows.Next() {
+		var entry = dash.Entry{Teams: []string{team.Name}}
+		if err := rows.Scan(&entry.ID, &entry.Title, &entry.Type, &entry.Anchor, &entry.Score); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+
+	json.NewEncoder(w).Encode(teamPendingEntriesResponse{
+		Status:  "success",
+		Entries: entries,
+	})
+	return nil
+}
+
+type teamSetApprovalRequest struct {
+	RequiresApproval bool `json:"requires_approval"`
+}
+
+// TeamSetApproval allows the team owner to require moderator approval for entries shared with the team
+func TeamSetApproval(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
+	}
+
+	var payload teamSetApprovalRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if _, err := db.Exec(`UPDATE teams SET requires_approval = ?, updated_at = ? WHERE id = ?`, payload.RequiresApproval, time.Now(), team.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
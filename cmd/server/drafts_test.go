@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestEntryPublish_Draft(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "draft-author", "b")
+	var readerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "draft-reader", "b")
+	var author = dash.User{ID: authorID, Username: "draft-author"}
+	var reader = dash.User{ID: readerID, Username: "draft-reader"}
+	var identifier = dash.Identifier{DocsetFilename: "Drafts", PagePath: "index.html"}
+
+	var ctx = context.WithValue(rootCtx, UserKey, &author)
+	req, _ := http.NewRequest("POST", "/entries/create", strings.NewReader(`{"title":"t","body":"b","anchor":"a","public":true,"draft":true,"identifier":{"docset_filename":"Drafts","page_path":"index.html"}}`))
+	if err := EntryCreate(ctx, httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("EntryCreate errored with: %#v", err)
+	}
+	upsertIdentifier(db, &identifier)
+
+	var own, _ = findOwnByIdentifier(db, identifier, &author)
+	if len(own) != 1 || !own[0].Draft {
+		t.Fatalf("Expected the draft to be listed for its author, got %#v", own)
+	}
+	var public, _ = findPublicByIdentifier(db, identifier, &reader)
+	if len(public) != 0 {
+		t.Fatalf("Expected drafts not to be public, got %#v", public)
+	}
+	var byID = fmt.Sprintf(`{"entry_id":%d,"vote_type":1}`, own[0].ID)
+	if _, err := call(readerID, WithEntry(ContextHandlerFunc(EntryGet)), byID); err != ErrEntryUnknown {
+		t.Fatalf("Expected drafts of others to return %q, got %q", ErrEntryUnknown, err)
+	}
+	if _, err := call(readerID, WithEntry(ContextHandlerFunc(EntryVote)), byID); err != ErrEntryUnknown {
+		t.Fatalf("Expected votes on drafts of others to return %q, got %q", ErrEntryUnknown, err)
+	}
+
+	req, _ = http.NewRequest("POST", "/entries/publish", strings.NewReader(fmt.Sprintf(`{"entry_id":%d}`, own[0].ID)))
+	var err = WithEntry(ContextHandlerFunc(EntryPublish)).ServeHTTPContext(ctx, httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatalf("EntryPublish errored with: %#v", err)
+	}
+
+	public, _ = findPublicByIdentifier(db, identifier, &reader)
+	if len(public) != 1 {
+		t.Fatalf("Expected published entries to be public, got %#v", public)
+	}
+	if _, err := call(readerID, WithEntry(ContextHandlerFunc(EntryGet)), byID); err != nil {
+		t.Fatalf("Expected published entries to be readable, got %q", err)
+	}
+
+	req, _ = http.NewRequest("POST", "/entries/publish", strings.NewReader(fmt.Sprintf(`{"entry_id":%d}`, own[0].ID)))
+	err = WithEntry(ContextHandlerFunc(EntryPublish)).ServeHTTPContext(ctx, httptest.NewRecorder(), req)
+	if err != ErrNotDraft {
+		t.Fatalf("Expected publishing twice to return %q, got %q", ErrNotDraft, err)
+	}
+}
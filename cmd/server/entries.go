@@ -5,7 +5,6 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -14,29 +13,28 @@ import (
 	"text/template"
 	"time"
 
-	"github.com/microcosm-cc/bluemonday"
-	"github.com/russross/blackfriday/v2"
-
 	"github.com/nicolai86/dash-annotations/dash"
 )
 
 var (
 	// ErrMissingTitle will be returned when you try to create an annotation without a title
-	ErrMissingTitle = errors.New("Missing parameter: title")
+	ErrMissingTitle = newAPIError(http.StatusUnprocessableEntity, "missing_title", "Missing parameter: title")
 	// ErrMissingBody will be returned when you try to create an annotation without body
-	ErrMissingBody = errors.New("Missing parameter: body")
+	ErrMissingBody = newAPIError(http.StatusUnprocessableEntity, "missing_body", "Missing parameter: body")
 	// ErrMissingAnchor will be returned when the Dash frontend fails to include an anchor for a new entry
-	ErrMissingAnchor = errors.New("Missing parameter: anchor")
+	ErrMissingAnchor = newAPIError(http.StatusUnprocessableEntity, "missing_anchor", "Missing parameter: anchor")
 	// ErrPublicAnnotationForbidden will be returned when the requested identifier is banned from public
-	ErrPublicAnnotationForbidden = errors.New("Public annotations forbidden")
+	ErrPublicAnnotationForbidden = newAPIError(http.StatusForbidden, "public_annotation_forbidden", "Public annotations forbidden")
 	// ErrUpdateForbidden will be returned when a user tries to modify annotations he did not create
-	ErrUpdateForbidden = errors.New("You need to be the author")
+	ErrUpdateForbidden = newAPIError(http.StatusForbidden, "update_forbidden", "You need to be the author")
 	// ErrDeleteForbidden will be returned when a user tries to delete other users annotations
-	ErrDeleteForbidden = errors.New("Only the author can delete an entry")
+	ErrDeleteForbidden = newAPIError(http.StatusForbidden, "delete_forbidden", "Only the author can delete an entry")
 	// ErrNotModerator will be returned when a user tries to remove an annotation from the public without being moderator
-	ErrNotModerator = errors.New("You need to be a moderator for this")
+	ErrNotModerator = newAPIError(http.StatusForbidden, "not_moderator", "You need to be a moderator for this")
 	// ErrNotTeamModerator will be returned when a user tries to remove an annotation from a team without being team moderator
-	ErrNotTeamModerator = errors.New("You need to be the teams moderator for this")
+	ErrNotTeamModerator = newAPIError(http.StatusForbidden, "not_team_moderator", "You need to be the teams moderator for this")
+	// ErrNothingToRestore will be returned when an entry which was not removed should be restored
+	ErrNothingToRestore = newAPIError(http.StatusConflict, "nothing_to_restore", "The entry was not removed")
 )
 
 func findVoteByEntryAndUser(db *sql.DB, entry dash.Entry, u dash.User) (dash.Vote, error) {
@@ -48,33 +46,82 @@ func findVoteByEntryAndUser(db *sql.DB, entry dash.Entry, u dash.User) (dash.Vot
 	return vote, err
 }
 
+// findByTeamAndIdentifier returns the entries shared with the teams of the user. Teams whose docset allow-list
+// does not contain the identifier are skipped
 func findByTeamAndIdentifier(db *sql.DB, identifier dash.Identifier, user dash.User) ([]dash.Entry, error) {
-	if len(user.TeamMemberships) < 1 {
-		return nil, nil
+	var teamIDs, err = allowedTeamIDs(db, user, identifier)
+	if err != nil || len(teamIDs) < 1 {
+		return nil, err
 	}
 
-	var query = fmt.Sprintf(`SELECT e.id, e.title, e.type, e.anchor, e.body, e.body_rendered, e.score, e.user_id
+	var query = fmt.Sprintf(`SELECT e.id, e.title, e.type, e.anchor, e.body, e.score, e.user_id
 		FROM entries e
 		INNER JOIN entry_team et ON et.entry_id = e.id
 		WHERE e.identifier_id = ?
 			AND et.removed_from_team = ?
+			AND et.approved = ?
+			AND e.draft = ?
 			AND e.user_id != ?
 			AND et.team_id IN (%s)
-		GROUP BY e.id`, strings.Join(strings.Split(strings.Repeat("?", len(user.TeamMemberships)), ""), ","))
-	var params = []interface{}{identifier.ID, false, user.ID}
-	for _, membership := range user.TeamMemberships {
-		params = append(params, membership.TeamID)
+		GROUP BY e.id`, strings.Join(strings.Split(strings.Repeat("?", len(teamIDs)), ""), ","))
+	var params = []interface{}{identifier.ID, false, true, false, user.ID}
+	for _, teamID := range teamIDs {
+		params = append(params, teamID)
+	}
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return nil, err
 	}
-	var rows, err = db.Query(query, params...)
 	defer rows.Close()
+
+	var entries = make([]dash.Entry, 0)
+	for rows.Next() {
+		var entry = dash.Entry{}
+		if err := rows.Scan(&entry.ID, &entry.Title, &entry.Type, &entry.Anchor, &entry.Body, &entry.Score, &entry.UserID); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// findByOrganizationAndIdentifier returns the entries visible to the organizations of the user, except those
+// already visible through one of the teams of the user
+func findByOrganizationAndIdentifier(db *sql.DB, identifier dash.Identifier, user dash.User) ([]dash.Entry, error) {
+	if len(user.Organizations) < 1 {
+		return nil, nil
+	}
+
+	var visibility, visibilityParams = organizationVisibility(user.Organizations)
+	var query = `SELECT e.id, e.title, e.type, e.anchor, e.body, e.score, e.user_id
+		FROM entries e
+		WHERE e.identifier_id = ?
+			AND e.draft = ?
+			AND e.user_id != ?
+			AND ` + visibility
+	var params = append([]interface{}{identifier.ID, false, user.ID}, visibilityParams...)
+	if len(user.TeamMemberships) > 0 {
+		query += fmt.Sprintf(` AND e.id NOT IN (SELECT et.entry_id
+			FROM entry_team et
+			WHERE et.removed_from_team = ?
+				AND et.approved = ?
+				AND et.team_id IN (%s))`, strings.Join(strings.Split(strings.Repeat("?", len(user.TeamMemberships)), ""), ","))
+		params = append(params, false, true)
+		for _, membership := range user.TeamMemberships {
+			params = append(params, membership.TeamID)
+		}
+	}
+	var rows, err = db.Query(query, params...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var entries = make([]dash.Entry, 0)
 	for rows.Next() {
 		var entry = dash.Entry{}
-		if err := rows.Scan(&entry.ID, &entry.Title, &entry.Type, &entry.Anchor, &entry.Body, &entry.BodyRendered, &entry.Score, &entry.UserID); err != nil {
+		if err := rows.Scan(&entry.ID, &entry.Title, &entry.Type, &entry.Anchor, &entry.Body, &entry.Score, &entry.UserID); err != nil {
 			return nil, err
 		}
 		entries = append(entries, entry)
@@ -90,31 +137,38 @@ func findPublicByIdentifier(db *sql.DB, identifier dash.Identifier, user *dash.U
     e.type,
     e.anchor,
     e.body,
-    e.body_rendered,
     e.score,
     e.user_id
   FROM entries e
     WHERE e.identifier_id = ?
     AND e.public = ?
     AND e.removed_from_public = ?
+    AND e.draft = ?
     AND e.score > ? `
-	var params = []interface{}{identifier.ID, true, false, -5}
+	var params = []interface{}{identifier.ID, true, false, false, -5}
 	if user != nil && len(user.TeamMemberships) > 0 {
 		var subQuery = fmt.Sprintf(`SELECT e.id
       FROM entries e
       INNER JOIN entry_team et ON et.entry_id = e.id
       WHERE identifier_id = ?
         AND et.removed_from_team = ?
+        AND et.approved = ?
         AND et.team_id IN (%s)
       GROUP BY e.id`, strings.Join(strings.Split(strings.Repeat("?", len(user.TeamMemberships)), ""), ","))
 
 		query = query + "AND e.id NOT IN (" + subQuery + ")"
 		params = append(params, identifier.ID)
 		params = append(params, true)
+		params = append(params, true)
 		for _, team := range user.TeamMemberships {
 			params = append(params, team.TeamID)
 		}
 	}
+	if user != nil && len(user.Organizations) > 0 {
+		var visibility, visibilityParams = organizationVisibility(user.Organizations)
+		query += ` AND NOT ` + visibility
+		params = append(params, visibilityParams...)
+	}
 	if user != nil {
 		query += ` AND user_id != ?`
 		params = append(params, user.ID)
@@ -128,7 +182,7 @@ func findPublicByIdentifier(db *sql.DB, identifier dash.Identifier, user *dash.U
 	var entries = make([]dash.Entry, 0)
 	for rows.Next() {
 		var entry = dash.Entry{}
-		if err := rows.Scan(&entry.ID, &entry.Title, &entry.Type, &entry.Anchor, &entry.Body, &entry.BodyRendered, &entry.Score, &entry.UserID); err != nil {
+		if err := rows.Scan(&entry.ID, &entry.Title, &entry.Type, &entry.Anchor, &entry.Body, &entry.Score, &entry.UserID); err != nil {
 			return nil, err
 		}
 		entries = append(entries, entry)
@@ -142,7 +196,7 @@ func findOwnByIdentifier(db *sql.DB, identifier dash.Identifier, user *dash.User
 		return nil, nil
 	}
 
-	var rows, err = db.Query(`SELECT id, title, type, anchor, body, body_rendered, score, user_id FROM entries WHERE user_id = ? AND identifier_id = ?`, user.ID, identifier.ID)
+	var rows, err = db.Query(`SELECT id, title, type, anchor, body, score, user_id, draft FROM entries WHERE user_id = ? AND identifier_id = ?`, user.ID, identifier.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -151,7 +205,7 @@ func findOwnByIdentifier(db *sql.DB, identifier dash.Identifier, user *dash.User
 	var entries = make([]dash.Entry, 0)
 	for rows.Next() {
 		var entry = dash.Entry{}
-		if err := rows.Scan(&entry.ID, &entry.Title, &entry.Type, &entry.Anchor, &entry.Body, &entry.BodyRendered, &entry.Score, &entry.UserID); err != nil {
+		if err := rows.Scan(&entry.ID, &entry.Title, &entry.Type, &entry.Anchor, &entry.Body, &entry.Score, &entry.UserID, &entry.Draft); err != nil {
 			return nil, err
 		}
 		entries = append(entries, entry)
@@ -169,9 +223,11 @@ type entryListResponse struct {
 	PublicEntries []dash.Entry `json:"public_entries,omitempty"`
 	OwnEntries    []dash.Entry `json:"own_entries,omitempty"`
 	TeamEntries   []dash.Entry `json:"team_entries,omitempty"`
+
+	OrganizationEntries []dash.Entry `json:"organization_entries,omitempty"`
 }
 
-// EntryList returns all public/ team/ and own entries for a requested identifier
+// EntryList returns all public/ organization/ team/ and own entries for a requested identifier
 func EntryList(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
 	var db = ctx.Value(DBKey).(*sql.DB)
 	var user *dash.User = nil
@@ -188,7 +244,7 @@ func EntryList(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 		return err
 	}
 
-	var public, own, team []dash.Entry
+	var public, own, team, organization []dash.Entry
 	var err error
 	if public, err = findPublicByIdentifier(db, listReq.Identifier, user); err != nil {
 		return err
@@ -201,6 +257,9 @@ func EntryList(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 		if team, err = findByTeamAndIdentifier(db, listReq.Identifier, *user); err != nil {
 			return err
 		}
+		if organization, err = findByOrganizationAndIdentifier(db, listReq.Identifier, *user); err != nil {
+			return err
+		}
 	}
 	// TODO(rr) remove from public which are in team
 
@@ -209,6 +268,8 @@ func EntryList(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 		PublicEntries: public,
 		OwnEntries:    own,
 		TeamEntries:   team,
+
+		OrganizationEntries: organization,
 	}
 	enc.Encode(resp)
 	return nil
@@ -224,6 +285,10 @@ type entrySaveRequest struct {
 	Identifier dash.Identifier `json:"identifier"`
 	Anchor     string          `json:"anchor"`
 	EntryID    int             `json:"entry_id"`
+	Draft      bool            `json:"draft"`
+
+	// Organization is nil when the client does not know about organizations, keeping the stored one
+	Organization *string `json:"organization"`
 }
 
 type entrySaveResponse struct {
@@ -231,12 +296,18 @@ type entrySaveResponse struct {
 	Entry  dash.Entry `json:"entry"`
 }
 
-func upsertIdentifier(db *sql.DB, dict *dash.Identifier) error {
+// findIdentifier looks up the id and ban status of an existing identifier
+func findIdentifier(db *sql.DB, dict *dash.Identifier) {
 	if dict.DocsetFilename == "Mono" && dict.HttrackSource != "" {
-		db.QueryRow(`SELECT id FROM identifiers WHERE docset_filename = ? AND httrack_source = ? LIMIT 1`, dict.DocsetFilename, dict.HttrackSource).Scan(&dict.ID)
+		db.QueryRow(`SELECT id, banned_from_public FROM identifiers WHERE docset_filename = ? AND httrack_source = ? LIMIT 1`, dict.DocsetFilename, dict.HttrackSource).Scan(&dict.ID, &dict.BannedFromPublic)
 	} else {
-		db.QueryRow(`SELECT id FROM identifiers WHERE docset_filename = ? AND page_path = ? LIMIT 1`, dict.DocsetFilename, dict.PagePath).Scan(&dict.ID)
+		db.QueryRow(`SELECT id, banned_from_public FROM identifiers WHERE docset_filename = ? AND page_path = ? LIMIT 1`, dict.DocsetFilename, dict.PagePath).Scan(&dict.ID, &dict.BannedFromPublic)
 	}
+}
+
+func upsertIdentifier(db *sql.DB, dict *dash.Identifier) error {
+	findIdentifier(db, dict)
+	dict.BannedFromPublic = dict.BannedFromPublic || isDocsetBanned(db, dict.DocsetFilename)
 
 	if dict.ID == 0 {
 		var res, err = db.Exec(`INSERT INTO identifiers
@@ -263,12 +334,21 @@ func EntrySave(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 	var payload entrySaveRequest
 	json.NewDecoder(req.Body).Decode(&payload)
 
+	// team editors are looked up by the teams the entry is currently shared with, not the requested ones
+	var editorTeams = entryTeamsWith(*entry, *user, dash.CapabilityEditEntries)
+
+	// only the author and moderators decide where the entry is visible; team editors change its content
+	var isAuthor = entry.UserID == user.ID
+	var canScope = isAuthor || user.Moderator
+	var previousBodySize = len(entry.Body)
 	entry.Title = payload.Title
 	entry.Type = payload.Type
 	entry.Body = payload.Body
-	entry.Public = payload.Public
 	entry.Anchor = payload.Anchor
-	entry.Teams = payload.Teams
+	if canScope {
+		entry.Public = payload.Public
+		entry.Teams = payload.Teams
+	}
 
 	if entry.Title == "" {
 		return ErrMissingTitle
@@ -280,14 +360,46 @@ func EntrySave(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 		return ErrMissingAnchor
 	}
 
-	if !user.Moderator && entry.UserID != user.ID {
+	if !user.Moderator && !isAuthor && len(editorTeams) == 0 {
 		return ErrUpdateForbidden
 	}
-	entry.BodyRendered = string(bluemonday.UGCPolicy().SanitizeBytes(
-		blackfriday.Run([]byte(entry.Body))),
-	)
+	// entries stored before the limit was lowered can still be edited as long as the body does not grow
+	if len(entry.Body) > previousBodySize {
+		if err := checkBodySize(db, quotasFromContext(ctx), *user, entry.Body); err != nil {
+			return err
+		}
+	}
+	var organizationID int
+	var err error
+	if canScope {
+		var organizationName = entry.Organization
+		if payload.Organization != nil {
+			organizationName = *payload.Organization
+		}
+		if organizationID, entry.Organization, err = entryOrganization(db, *user, organizationName, entry.Organization); err != nil {
+			return err
+		}
+		var identifier dash.Identifier
+		if identifier, err = findIdentifierByID(db, entry.IdentifierID); err != nil {
+			return err
+		}
+		if entry.Public && (identifier.BannedFromPublic || isDocsetBanned(db, identifier.DocsetFilename)) {
+			return ErrPublicAnnotationForbidden
+		}
+		if err := checkTeamDocsets(db, entry.Teams, identifier); err != nil {
+			return err
+		}
+	} else if entry.Organization != "" {
+		var organization dash.Organization
+		if organization, err = findOrganizationByName(db, entry.Organization); err != nil {
+			return err
+		}
+		organizationID = organization.ID
+	}
+	var refs []reference
+	entry.BodyRendered, refs = renderEntryBody(db, rendererFromContext(ctx), entry.Body, entry.UserID)
 
-	var _, err = db.Exec(`UPDATE entries SET
+	_, err = db.Exec(`UPDATE entries SET
 			title               = ?,
 			body                = ?,
 			body_rendered       = ?,
@@ -296,6 +408,7 @@ func EntrySave(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 			public              = ?,
 			removed_from_public = ?,
 			score               = ?,
+			organization_id     = ?,
 			updated_at          = ?
 		WHERE id = ?`,
 		entry.Title,
@@ -306,19 +419,36 @@ func EntrySave(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 		entry.Public,
 		entry.RemovedFromPublic,
 		entry.Score,
+		nullableID(organizationID),
 		time.Now(), entry.ID)
 	if err != nil {
 		return err
 	}
 
-	db.Exec(`DELETE FROM entry_team WHERE entry_id = ?`, entry.ID)
-	for _, t := range entry.Teams {
-		var teamID int64
-		db.QueryRow(`SELECT id FROM teams WHERE name = ? LIMIT 1`, t).Scan(&teamID)
-		db.Exec(`INSERT INTO entry_team (entry_id, team_id) VALUES (?, ?)`, entry.ID, teamID)
+	if canScope {
+		linkEntryTeams(db, *entry, *user)
 	}
 
 	updateEntryVoteScore(db, entry)
+	if err := saveEntryReferences(db, entry.ID, refs); err != nil {
+		return err
+	}
+	if !entry.Draft {
+		var author dash.User
+		if author, err = findUserByID(db, entry.UserID); err != nil {
+			return err
+		}
+		if err := notifyMentions(db, mailerFromContext(ctx), *entry, author); err != nil {
+			return err
+		}
+		var event = dash.Event{Kind: dash.EventEntryUpdated, ActorID: user.ID, EntryID: entry.ID, IdentifierID: entry.IdentifierID}
+		if !isAuthor && len(editorTeams) > 0 {
+			event.TeamID = editorTeams[0]
+		}
+		if err := recordEvent(db, event); err != nil {
+			return err
+		}
+	}
 
 	json.NewEncoder(w).Encode(entrySaveResponse{
 		Entry:  *entry,
@@ -344,6 +474,8 @@ func EntryCreate(ctx context.Context, w http.ResponseWriter, req *http.Request)
 		Identifier: payload.Identifier,
 		Anchor:     payload.Anchor,
 		Teams:      payload.Teams,
+		Draft:      payload.Draft,
+		UserID:     user.ID,
 	}
 
 	if entry.Title == "" {
@@ -355,19 +487,36 @@ func EntryCreate(ctx context.Context, w http.ResponseWriter, req *http.Request)
 	if entry.Anchor == "" {
 		return ErrMissingAnchor
 	}
+	if err := checkBodySize(db, quotasFromContext(ctx), *user, entry.Body); err != nil {
+		return err
+	}
+	if err := checkEntryQuota(db, quotasFromContext(ctx), *user); err != nil {
+		return err
+	}
 	if err := upsertIdentifier(db, &entry.Identifier); err != nil {
 		return err
 	}
 	if entry.Public && entry.Identifier.BannedFromPublic {
 		return ErrPublicAnnotationForbidden
 	}
+	if err := checkTeamDocsets(db, entry.Teams, entry.Identifier); err != nil {
+		return err
+	}
+	var requestedOrganization string
+	if payload.Organization != nil {
+		requestedOrganization = *payload.Organization
+	}
+	var organizationID, organizationName, err = entryOrganization(db, *user, requestedOrganization, "")
+	if err != nil {
+		return err
+	}
+	entry.Organization = organizationName
 	entry.IdentifierID = entry.Identifier.ID
-	entry.BodyRendered = string(bluemonday.UGCPolicy().SanitizeBytes(
-		blackfriday.Run([]byte(entry.Body))),
-	)
+	var refs []reference
+	entry.BodyRendered, refs = renderEntryBody(db, rendererFromContext(ctx), entry.Body, user.ID)
 
-	var res, err = db.Exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, public, removed_from_public, score, user_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		entry.Title, entry.Body, entry.BodyRendered, entry.Type, entry.IdentifierID, entry.Anchor, entry.Public, entry.RemovedFromPublic, entry.Score, user.ID, time.Now(), time.Now())
+	res, err := db.Exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, public, removed_from_public, draft, score, user_id, organization_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Title, entry.Body, entry.BodyRendered, entry.Type, entry.IdentifierID, entry.Anchor, entry.Public, entry.RemovedFromPublic, entry.Draft, entry.Score, user.ID, nullableID(organizationID), time.Now(), time.Now())
 	if err != nil {
 		return err
 	}
@@ -387,13 +536,20 @@ func EntryCreate(ctx context.Context, w http.ResponseWriter, req *http.Request)
 		return err
 	}
 
-	for _, t := range entry.Teams {
-		var teamID int64
-		db.QueryRow(`SELECT id FROM teams WHERE name = ? LIMIT 1`, t).Scan(&teamID)
-		db.Exec(`INSERT INTO entry_team (entry_id, team_id) VALUES (?, ?)`, entry.ID, teamID)
-	}
+	linkEntryTeams(db, entry, *user)
 
 	updateEntryVoteScore(db, &entry)
+	if err := saveEntryReferences(db, entry.ID, refs); err != nil {
+		return err
+	}
+	if !entry.Draft {
+		if err := notifyMentions(db, mailerFromContext(ctx), entry, *user); err != nil {
+			return err
+		}
+		if err := recordEvent(db, dash.Event{Kind: dash.EventEntryCreated, ActorID: user.ID, EntryID: entry.ID, IdentifierID: entry.IdentifierID}); err != nil {
+			return err
+		}
+	}
 
 	json.NewEncoder(w).Encode(entrySaveResponse{
 		Entry:  entry,
@@ -414,16 +570,18 @@ type entryGetResponse struct {
 }
 
 type decoratedContext struct {
-	Entry dash.Entry
-	User  dash.User
-	Vote  dash.Vote
+	Entry     dash.Entry
+	User      dash.User
+	Vote      dash.Vote
+	Backlinks []dash.Entry
 }
 
-func decorateBodyRendered(entry dash.Entry, user dash.User, vote dash.Vote) string {
+func decorateBodyRendered(entry dash.Entry, user dash.User, vote dash.Vote, backlinks []dash.Entry) string {
 	var err error
 
 	var fns = template.FuncMap{
-		"join": strings.Join,
+		"join":          strings.Join,
+		"identifierURL": identifierURL,
 		"max": func(upper, current int) int {
 			if current > upper {
 				return upper
@@ -452,14 +610,7 @@ func decorateBodyRendered(entry dash.Entry, user dash.User, vote dash.Vote) stri
 			return resp
 		},
 		"isTeamModerator": func(user dash.User, teams []string) bool {
-			var isModerator = false
-			for _, membership := range user.TeamMemberships {
-				for _, team := range teams {
-					isModerator = isModerator ||
-						(team == membership.TeamName && (membership.Role == "owner" || membership.Role == "moderator"))
-				}
-			}
-			return isModerator
+			return len(entryTeamsWith(dash.Entry{Teams: teams}, user, dash.CapabilityModerateEntries)) > 0
 		},
 	}
 
@@ -470,9 +621,10 @@ func decorateBodyRendered(entry dash.Entry, user dash.User, vote dash.Vote) stri
 	}
 	var tmp = bytes.Buffer{}
 	var c = decoratedContext{
-		Entry: entry,
-		User:  user,
-		Vote:  vote,
+		Entry:     entry,
+		User:      user,
+		Vote:      vote,
+		Backlinks: backlinks,
 	}
 
 	err = html.Execute(&tmp, &c)
@@ -492,8 +644,16 @@ func EntryGet(ctx context.Context, w http.ResponseWriter, req *http.Request) err
 	if ctx.Value(UserKey) != nil {
 		user = dash.User(*ctx.Value(UserKey).(*dash.User))
 	}
+	// entries hidden from the user, like drafts of others or entries pending approval, are reported as unknown
+	if !user.Moderator && !canSeeEntry(db, entry.ID, user.ID) {
+		return ErrEntryUnknown
+	}
 
 	var vote, _ = findVoteByEntryAndUser(db, *entry, user)
+	var backlinks, err = findReferencingEntries(db, *entry, user)
+	if err != nil {
+		return err
+	}
 	var entryTeams = make([]dash.TeamMember, 0)
 	for _, team := range entry.Teams {
 		for _, membership := range user.TeamMemberships {
@@ -503,10 +663,14 @@ func EntryGet(ctx context.Context, w http.ResponseWriter, req *http.Request) err
 		}
 	}
 
+	// cross references are resolved for the reader, so titles of entries hidden from the reader never show up
+	var rendered = *entry
+	rendered.BodyRendered = renderEntryBodyFor(db, rendererFromContext(ctx), entry.Body, user.ID)
+
 	var resp = entryGetResponse{
 		Status:          "success",
 		Body:            entry.Body,
-		BodyRendered:    decorateBodyRendered(*entry, user, vote),
+		BodyRendered:    decorateBodyRendered(rendered, user, vote, backlinks),
 		Teams:           entryTeams,
 		GlobalModerator: user.Moderator,
 	}
@@ -537,6 +701,10 @@ func EntryVote(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 	var user = ctx.Value(UserKey).(*dash.User)
 	var entry = ctx.Value(EntryKey).(*dash.Entry)
 
+	if !canSeeEntry(db, entry.ID, user.ID) {
+		return ErrEntryUnknown
+	}
+
 	var payload entryVoteRequest
 	json.NewDecoder(req.Body).Decode(&payload)
 
@@ -553,12 +721,40 @@ func EntryVote(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 	}
 
 	updateEntryVoteScore(db, entry)
+	if err := recordEvent(db, dash.Event{Kind: dash.EventEntryVoted, ActorID: user.ID, EntryID: entry.ID, IdentifierID: entry.IdentifierID}); err != nil {
+		return err
+	}
 	json.NewEncoder(w).Encode(map[string]string{
 		"status": "success",
 	})
 	return nil
 }
 
+// deleteEntries removes the given entries including everything referencing them
+func deleteEntries(tx *sql.Tx, entryIDs []interface{}) error {
+	if len(entryIDs) == 0 {
+		return nil
+	}
+	var placeholders = strings.Join(strings.Split(strings.Repeat("?", len(entryIDs)), ""), ",")
+
+	for _, stmt := range []struct {
+		query  string
+		params []interface{}
+	}{
+		{`DELETE FROM votes WHERE entry_id IN (%s)`, entryIDs},
+		{`DELETE FROM entry_team WHERE entry_id IN (%s)`, entryIDs},
+		{`DELETE FROM entry_references WHERE entry_id IN (%[1]s) OR target_entry_id IN (%[1]s)`, append(append([]interface{}{}, entryIDs...), entryIDs...)},
+		{`DELETE FROM notifications WHERE entry_id IN (%s)`, entryIDs},
+		{`DELETE FROM flags WHERE status = ? AND entry_id IN (%s)`, append([]interface{}{dash.FlagOpen}, entryIDs...)},
+		{`DELETE FROM entries WHERE id IN (%s)`, entryIDs},
+	} {
+		if _, err := tx.Exec(fmt.Sprintf(stmt.query, placeholders), stmt.params...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // EntryDelete removes an annotation entirely from dash
 func EntryDelete(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
 	var db = ctx.Value(DBKey).(*sql.DB)
@@ -577,9 +773,10 @@ func EntryDelete(ctx context.Context, w http.ResponseWriter, req *http.Request)
 		return err
 	}
 
-	tx.Exec(`DELETE FROM votes WHERE entry_id = ?`, entry.ID)
-	tx.Exec(`DELETE FROM entry_team WHERE entry_id = ?`, entry.ID)
-	tx.Exec(`DELETE FROM entries WHERE id = ?`, entry.ID)
+	if err := deleteEntries(tx, []interface{}{entry.ID}); err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	if err = tx.Commit(); err != nil {
 		return err
@@ -591,6 +788,73 @@ func EntryDelete(ctx context.Context, w http.ResponseWriter, req *http.Request)
 	return nil
 }
 
+// setEntryRemovedFromPublic hides a public entry from everyone but its author, or restores it, and records
+// the moderation action if the state changed. Pass a transaction so the change is never left unaudited
+func setEntryRemovedFromPublic(db execer, entry dash.Entry, removed bool, moderator dash.User, reason string) error {
+	var res, err = db.Exec(`UPDATE entries SET removed_from_public = ? WHERE id = ? AND removed_from_public = ?`, removed, entry.ID, !removed)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return nil
+	}
+
+	var action = dash.ModerationRemoveFromPublic
+	if !removed {
+		action = dash.ModerationRestoreToPublic
+	}
+	return recordModerationAction(db, dash.ModerationAction{
+		Action:     action,
+		ActorID:    moderator.ID,
+		EntryID:    entry.ID,
+		EntryTitle: entry.Title,
+		Reason:     reason,
+		Before:     visibilityState(!removed),
+		After:      visibilityState(removed),
+	})
+}
+
+// setEntryRemovedFromTeams hides the entry from the given teams, or restores it, and records a moderation
+// action for every team whose state changed. It returns the number of changed teams. Pass a transaction so
+// the changes are never left unaudited
+func setEntryRemovedFromTeams(db execer, entry dash.Entry, teamIDs []int, removed bool, moderator dash.User, reason string) (int, error) {
+	var action = dash.ModerationRemoveFromTeam
+	if !removed {
+		action = dash.ModerationRestoreToTeam
+	}
+
+	var changed = 0
+	for _, teamID := range teamIDs {
+		var res, err = db.Exec(`UPDATE entry_team SET removed_from_team = ?, updated_at = ? WHERE entry_id = ? AND team_id = ? AND removed_from_team = ?`, removed, time.Now(), entry.ID, teamID, !removed)
+		if err != nil {
+			return changed, err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			continue
+		}
+		changed++
+
+		if err := recordModerationAction(db, dash.ModerationAction{
+			Action:     action,
+			ActorID:    moderator.ID,
+			EntryID:    entry.ID,
+			EntryTitle: entry.Title,
+			TeamID:     teamID,
+			Reason:     reason,
+			Before:     visibilityState(!removed),
+			After:      visibilityState(removed),
+		}); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+type entryModerationRequest struct {
+	EntryID int    `json:"entry_id"`
+	Reason  string `json:"reason"`
+}
+
 // EntryRemoveFromPublic allows an moderator to hide a public annotation
 func EntryRemoveFromPublic(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
 	var user = ctx.Value(UserKey).(*dash.User)
@@ -601,7 +865,52 @@ func EntryRemoveFromPublic(ctx context.Context, w http.ResponseWriter, req *http
 	var db = ctx.Value(DBKey).(*sql.DB)
 	var entry = ctx.Value(EntryKey).(*dash.Entry)
 
-	if _, err := db.Exec(`UPDATE entries SET removed_from_public = ? WHERE id = ?`, true, entry.ID); err != nil {
+	var payload entryModerationRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := setEntryRemovedFromPublic(tx, *entry, true, *user, payload.Reason); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// EntryRestoreToPublic allows an moderator to undo the removal of a public annotation
+func EntryRestoreToPublic(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var user = ctx.Value(UserKey).(*dash.User)
+	if !user.Moderator {
+		return ErrNotModerator
+	}
+
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var entry = ctx.Value(EntryKey).(*dash.Entry)
+
+	var payload entryModerationRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if !entry.RemovedFromPublic {
+		return ErrNothingToRestore
+	}
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := setEntryRemovedFromPublic(tx, *entry, false, *user, payload.Reason); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
 		return err
 	}
 
@@ -617,31 +926,60 @@ func EntryRemoveFromTeams(ctx context.Context, w http.ResponseWriter, req *http.
 	var user = ctx.Value(UserKey).(*dash.User)
 	var entry = ctx.Value(EntryKey).(*dash.Entry)
 
-	var payload entryGetRequest
+	var payload entryModerationRequest
 	json.NewDecoder(req.Body).Decode(&payload)
 
-	var isTeamModerator = false
-	for _, membership := range user.TeamMemberships {
-		for _, team := range entry.Teams {
-			isTeamModerator = isTeamModerator ||
-				(team == membership.TeamName && (membership.Role == "owner" || membership.Role == "moderator"))
-		}
-	}
-	if !isTeamModerator {
+	var teamIDs = entryTeamsWith(*entry, *user, dash.CapabilityModerateEntries)
+	if len(teamIDs) == 0 {
 		return ErrNotTeamModerator
 	}
 
-	var args = []interface{}{
-		true,
-		entry.ID,
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
 	}
-	for _, membership := range user.TeamMemberships {
-		args = append(args, membership.TeamID)
+	if _, err := setEntryRemovedFromTeams(tx, *entry, teamIDs, true, *user, payload.Reason); err != nil {
+		tx.Rollback()
+		return err
 	}
-	query := fmt.Sprintf(`UPDATE entry_team SET removed_from_team = ? WHERE entry_id = ? AND team_id IN (%s)`,
-		strings.Join(strings.Split(strings.Repeat("?", len(user.TeamMemberships)), ""), ","))
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// EntryRestoreToTeams allows a team moderator to undo the removal of an annotation from the team
+func EntryRestoreToTeams(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var entry = ctx.Value(EntryKey).(*dash.Entry)
 
-	if _, err := db.Exec(query, args...); err != nil {
+	var payload entryModerationRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var teamIDs = entryTeamsWith(*entry, *user, dash.CapabilityModerateEntries)
+	if len(teamIDs) == 0 {
+		return ErrNotTeamModerator
+	}
+
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+	var restored int
+	if restored, err = setEntryRemovedFromTeams(tx, *entry, teamIDs, false, *user, payload.Reason); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if restored == 0 {
+		tx.Rollback()
+		return ErrNothingToRestore
+	}
+	if err := tx.Commit(); err != nil {
 		return err
 	}
 
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// APIError is an error caused by the request. It is reported to clients with its status code and a stable,
+// machine readable code
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// newAPIError returns an error reported to clients with the given status, code and message
+func newAPIError(status int, code, message string) error {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+var (
+	// ErrNotFound is reported for lookups of records which do not exist
+	ErrNotFound = newAPIError(http.StatusNotFound, "not_found", "Not found")
+	// ErrInternal is reported instead of errors not caused by the request, which are logged
+	ErrInternal = newAPIError(http.StatusInternalServerError, "internal_error", "Internal server error")
+)
+
+// apiErrorFor maps errors to the error reported to clients. Errors not caused by the request are logged and
+// reported as ErrInternal, so no internal details leak to clients
+func apiErrorFor(err error) *APIError {
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, sql.ErrNoRows):
+		errors.As(ErrNotFound, &apiErr)
+	default:
+		log.Printf("internal error: %v\n", err)
+		errors.As(ErrInternal, &apiErr)
+	}
+	return apiErr
+}
+
+// writeError answers the request with the error, keeping the response body Dash expects
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr = apiErrorFor(err)
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "error",
+		"message": apiErr.Message,
+		"code":    apiErr.Code,
+	})
+}
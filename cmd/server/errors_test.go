@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextAdapter_Errors(t *testing.T) {
+	var tests = []struct {
+		handler ContextHandler
+		status  int
+		code    string
+		message string
+	}{
+		{Authenticated(ContextHandlerFunc(UserFeedToken)), http.StatusUnauthorized, "missing_session_cookie", "Missing session cookie"},
+		{ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+			return ErrNotTeamOwner
+		}), http.StatusForbidden, "not_team_owner", ErrNotTeamOwner.Error()},
+		{ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+			return fmt.Errorf("loading team: %w", ErrTeamUnknown)
+		}), http.StatusNotFound, "team_unknown", ErrTeamUnknown.Error()},
+		{ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+			return ErrTeamNameExists
+		}), http.StatusConflict, "team_name_exists", ErrTeamNameExists.Error()},
+		{ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+			return ErrMissingTeamName
+		}), http.StatusUnprocessableEntity, "missing_team_name", ErrMissingTeamName.Error()},
+		{ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+			return sql.ErrNoRows
+		}), http.StatusNotFound, "not_found", "Not found"},
+		{ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+			return errors.New("dial tcp 10.0.0.1:3306: connection refused")
+		}), http.StatusInternalServerError, "internal_error", "Internal server error"},
+	}
+
+	for _, test := range tests {
+		var w = httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", nil)
+		(&ContextAdapter{ctx: rootCtx, handler: test.handler}).ServeHTTP(w, req)
+
+		var body map[string]string
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != test.status {
+			t.Errorf("Expected status %d, got %d", test.status, w.Code)
+		}
+		if body["status"] != "error" || body["code"] != test.code || body["message"] != test.message {
+			t.Errorf("Expected %q with message %q, got %#v", test.code, test.message, body)
+		}
+	}
+}
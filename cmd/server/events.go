@@ -0,0 +1,20 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+// nullableID converts optional ids into sql NULL values
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// recordEvent stores the event. Events are used to build digests for subscriptions and the team activity log
+func recordEvent(db execer, event dash.Event) error {
+	_, err := db.Exec(`INSERT INTO events (kind, actor_id, entry_id, identifier_id, team_id, target_user_id, detail, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.Kind, event.ActorID, nullableID(event.EntryID), nullableID(event.IdentifierID), nullableID(event.TeamID), nullableID(event.TargetUserID), event.Detail, time.Now())
+	return err
+}
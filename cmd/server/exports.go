@@ -0,0 +1,317 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// exportDir is the directory export archives are written to
+	exportDir = filepath.Join(os.TempDir(), "dash-annotations-exports")
+	// exportTTL is how long an export can be downloaded after it was generated
+	exportTTL = 24 * time.Hour
+	// exportTimeout is how long an export may stay pending before it is considered failed
+	exportTimeout = 30 * time.Minute
+
+	// ErrExportUnknown is returned when the user has not requested an export yet
+	ErrExportUnknown = newAPIError(http.StatusNotFound, "export_unknown", "Unknown export")
+	// ErrInvalidExportLink is returned when a download link was tampered with or has expired
+	ErrInvalidExportLink = newAPIError(http.StatusForbidden, "invalid_export_link", "Invalid or expired download link")
+)
+
+// exportSignature signs the export id and expiry of a download link with the session secret
+func exportSignature(exportID int, expires int64) string {
+	var mac = hmac.New(sha256.New, []byte(encryptionKey))
+	fmt.Fprintf(mac, "%d:%d", exportID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// exportDownloadURL returns a link to the export archive which is valid until expires
+func exportDownloadURL(exportID int, expires time.Time) string {
+	var params = url.Values{}
+	params.Set("id", strconv.Itoa(exportID))
+	params.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	params.Set("signature", exportSignature(exportID, expires.Unix()))
+	return "/users/export/download?" + params.Encode()
+}
+
+// exportRows returns all rows of the query as column name to value maps, suitable for json encoding
+func exportRows(db *sql.DB, query string, params ...interface{}) ([]map[string]interface{}, error) {
+	var rows, err = db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	if columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+
+	var result = make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var values = make([]interface{}, len(columns))
+		var pointers = make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		var row = make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+type exportSection struct {
+	filename string
+	query    string
+	params   []interface{}
+}
+
+// exportSections lists every file of the archive with the query returning its content. Secrets
+// like the password hash or the session token are never exported
+func exportSections(userID int) []exportSection {
+	return []exportSection{
+		{"user.json", `SELECT id, username, email, moderator, admin, disabled, notify_mentions, notify_by_email, created_at, updated_at FROM users WHERE id = ?`, []interface{}{userID}},
+		{"teams.json", `SELECT t.name, tu.role FROM team_user tu INNER JOIN teams t ON t.id = tu.team_id WHERE tu.user_id = ? ORDER BY t.name`, []interface{}{userID}},
+		{"team_join_requests.json", `SELECT t.name, r.status, r.decided_at, r.created_at FROM team_join_requests r INNER JOIN teams t ON t.id = r.team_id WHERE r.user_id = ? ORDER BY r.id`, []interface{}{userID}},
+		{"organization_admins.json", `SELECT o.name, oa.created_at FROM organization_admins oa INNER JOIN organizations o ON o.id = oa.organization_id WHERE oa.user_id = ? ORDER BY o.name`, []interface{}{userID}},
+		{"entries.json", `SELECT e.id, e.title, e.body, e.type, e.anchor, e.public, e.removed_from_public, e.draft, e.score, e.created_at, e.updated_at,
+			i.docset_name, i.docset_filename, i.docset_platform, i.docset_bundle, i.docset_version, i.page_path, i.page_title, i.httrack_source
+			FROM entries e INNER JOIN identifiers i ON i.id = e.identifier_id WHERE e.user_id = ? ORDER BY e.id`, []interface{}{userID}},
+		{"votes.json", `SELECT entry_id, type, created_at, updated_at FROM votes WHERE user_id = ? ORDER BY id`, []interface{}{userID}},
+		{"sessions.json", `SELECT updated_at FROM users WHERE id = ? AND remember_token IS NOT NULL AND remember_token != ?`, []interface{}{userID, ""}},
+		{"notifications.json", `SELECT entry_id, kind, read_at, created_at FROM notifications WHERE user_id = ? ORDER BY id`, []interface{}{userID}},
+		{"subscriptions.json", `SELECT docset_filename, identifier_id, frequency, last_digest_at, created_at FROM subscriptions WHERE user_id = ? ORDER BY id`, []interface{}{userID}},
+		{"events.json", `SELECT kind, entry_id, identifier_id, team_id, target_user_id, detail, created_at FROM events WHERE actor_id = ? OR target_user_id = ? ORDER BY id`, []interface{}{userID, userID}},
+		{"flags.json", `SELECT entry_id, reason, status, resolution, created_at FROM flags WHERE user_id = ? ORDER BY id`, []interface{}{userID}},
+		{"moderation_actions.json", `SELECT action, entry_id, entry_title, team_id, reason, before_state, after_state, created_at FROM moderation_actions WHERE actor_id = ? ORDER BY id`, []interface{}{userID}},
+		{"admin_actions.json", `SELECT action, source, actor_id, target_user_id, created_at FROM admin_actions WHERE actor_id = ? OR target_user_id = ? ORDER BY id`, []interface{}{userID, userID}},
+	}
+}
+
+// writeExportArchive writes a zip archive containing one json file per export section
+func writeExportArchive(db *sql.DB, userID int, filename string) error {
+	var f, err = os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var archive = zip.NewWriter(f)
+	for _, section := range exportSections(userID) {
+		var rows, err = exportRows(db, section.query, section.params...)
+		if err != nil {
+			return fmt.Errorf("%s: %v", section.filename, err)
+		}
+		var w io.Writer
+		if w, err = archive.Create(section.filename); err != nil {
+			return err
+		}
+		var enc = json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rows); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// buildExport generates the archive of a pending export and marks it as ready or failed
+func buildExport(db *sql.DB, exportID, userID int) error {
+	var filename = filepath.Join(exportDir, fmt.Sprintf("export-%d.zip", exportID))
+	var err = os.MkdirAll(exportDir, 0700)
+	if err == nil {
+		err = writeExportArchive(db, userID, filename)
+	}
+	if err != nil {
+		os.Remove(filename)
+		db.Exec(`UPDATE exports SET status = ?, finished_at = ? WHERE id = ?`, dash.ExportFailed, time.Now(), exportID)
+		return err
+	}
+
+	_, err = db.Exec(`UPDATE exports SET status = ?, filename = ?, finished_at = ? WHERE id = ?`, dash.ExportReady, filename, time.Now(), exportID)
+	return err
+}
+
+// failPendingExports marks all pending exports as failed. Archives are built in the background, so exports
+// pending while the server starts were interrupted and would never finish
+func failPendingExports(db *sql.DB) error {
+	var _, err = db.Exec(`UPDATE exports SET status = ?, finished_at = ? WHERE status = ?`, dash.ExportFailed, time.Now(), dash.ExportPending)
+	return err
+}
+
+// queryExecer is implemented by both *sql.DB and *sql.Tx
+type queryExecer interface {
+	execer
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// removeExports deletes all exports of the user including their archives
+func removeExports(db queryExecer, userID int) error {
+	var rows, err = db.Query(`SELECT filename FROM exports WHERE user_id = ? AND filename IS NOT NULL`, userID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var filename string
+		if err := rows.Scan(&filename); err != nil {
+			rows.Close()
+			return err
+		}
+		os.Remove(filename)
+	}
+	rows.Close()
+
+	_, err = db.Exec(`DELETE FROM exports WHERE user_id = ?`, userID)
+	return err
+}
+
+type exportResponse struct {
+	Status string      `json:"status"`
+	Export dash.Export `json:"export"`
+}
+
+// findLatestExport returns the most recent export of the user. Archives whose download link has
+// expired are removed
+func findLatestExport(db *sql.DB, userID int) (dash.Export, error) {
+	var export dash.Export
+	var filename sql.NullString
+	var createdAt, finishedAt nullTime
+	if err := db.QueryRow(`SELECT id, status, filename, created_at, finished_at FROM exports WHERE user_id = ? ORDER BY id DESC LIMIT 1`, userID).Scan(&export.ID, &export.Status, &filename, &createdAt, &finishedAt); err != nil {
+		return export, ErrExportUnknown
+	}
+	export.CreatedAt = createdAt.Time
+
+	// exports still pending after the timeout were interrupted, e.g. by a restart
+	if export.Status == dash.ExportPending && time.Since(export.CreatedAt) > exportTimeout {
+		export.Status = dash.ExportFailed
+		_, err := db.Exec(`UPDATE exports SET status = ?, finished_at = ? WHERE id = ?`, dash.ExportFailed, time.Now(), export.ID)
+		return export, err
+	}
+	if export.Status != dash.ExportReady {
+		return export, nil
+	}
+	var expires = finishedAt.Time.Add(exportTTL)
+	if time.Now().After(expires) {
+		os.Remove(filename.String)
+		export.Status = dash.ExportExpired
+		_, err := db.Exec(`UPDATE exports SET status = ?, filename = NULL WHERE id = ?`, dash.ExportExpired, export.ID)
+		return export, err
+	}
+	export.ExpiresAt = &expires
+	export.DownloadURL = exportDownloadURL(export.ID, expires)
+	return export, nil
+}
+
+// UserExport starts generating an archive of all personal data of the current user. Previous exports
+// are discarded; while an export is pending it is returned instead of starting another one
+func UserExport(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var export, err = findLatestExport(db, user.ID)
+	if err == nil && export.Status == dash.ExportPending {
+		json.NewEncoder(w).Encode(exportResponse{
+			Status: "success",
+			Export: export,
+		})
+		return nil
+	}
+
+	if err := removeExports(db, user.ID); err != nil {
+		return err
+	}
+	var now = time.Now()
+	res, err := db.Exec(`INSERT INTO exports (user_id, status, created_at) VALUES (?, ?, ?)`, user.ID, dash.ExportPending, now)
+	if err != nil {
+		return err
+	}
+	var exportID, _ = res.LastInsertId()
+
+	go func() {
+		if err := buildExport(db, int(exportID), user.ID); err != nil {
+			log.Printf("failed to export data of %s: %v", user.Username, err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(exportResponse{
+		Status: "success",
+		Export: dash.Export{ID: int(exportID), Status: dash.ExportPending, CreatedAt: now},
+	})
+	return nil
+}
+
+// UserExportStatus returns the latest export of the current user, including a signed download link once it's ready
+func UserExportStatus(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var export, err = findLatestExport(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(exportResponse{
+		Status: "success",
+		Export: export,
+	})
+	return nil
+}
+
+// UserExportDownload serves an export archive. It requires no session; the link itself is signed and expires
+func UserExportDownload(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+
+	var query = req.URL.Query()
+	var exportID, _ = strconv.Atoi(query.Get("id"))
+	var expires, _ = strconv.ParseInt(query.Get("expires"), 10, 64)
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(exportSignature(exportID, expires))) || time.Now().Unix() > expires {
+		return ErrInvalidExportLink
+	}
+
+	var filename sql.NullString
+	if err := db.QueryRow(`SELECT filename FROM exports WHERE id = ? AND status = ?`, exportID, dash.ExportReady).Scan(&filename); err != nil || !filename.Valid {
+		return ErrInvalidExportLink
+	}
+	var f, err = os.Open(filename.String)
+	if err != nil {
+		return ErrInvalidExportLink
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dash-annotations-export-%d.zip"`, exportID))
+	http.ServeContent(w, req, "", time.Unix(0, 0), f)
+	return nil
+}
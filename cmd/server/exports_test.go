@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestUserExport(t *testing.T) {
+	exportDir = t.TempDir()
+
+	var userID = exec(`INSERT INTO users (username, password, remember_token) VALUES (?, ?, ?)`, "export-user", "secret-hash", "secret-token")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Export", "Export", "c", "d", "e", "f", "g", "h", false)
+	exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "exported entry", "b", "b", "comment", identifierID, "c", userID, true, false, 0)
+
+	var user = dash.User{ID: userID, Username: "export-user"}
+	var ctx = context.WithValue(rootCtx, UserKey, &user)
+	if err := UserExportStatus(ctx, httptest.NewRecorder(), &http.Request{}); err != ErrExportUnknown {
+		t.Fatalf("Expected no export to exist yet, got %q", err)
+	}
+
+	var exportID = exec(`INSERT INTO exports (user_id, status) VALUES (?, ?)`, userID, dash.ExportPending)
+	if err := buildExport(db, exportID, userID); err != nil {
+		t.Fatalf("buildExport errored with: %#v", err)
+	}
+
+	var w = httptest.NewRecorder()
+	if err := UserExportStatus(ctx, w, &http.Request{}); err != nil {
+		t.Fatalf("UserExportStatus errored with: %#v", err)
+	}
+	var resp exportResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Export.Status != dash.ExportReady || resp.Export.DownloadURL == "" {
+		t.Fatalf("Expected the export to be ready for download, got %#v", resp.Export)
+	}
+
+	req, _ := http.NewRequest("GET", strings.Replace(resp.Export.DownloadURL, "signature=", "signature=0", 1), nil)
+	if err := UserExportDownload(rootCtx, httptest.NewRecorder(), req); err != ErrInvalidExportLink {
+		t.Fatalf("Expected tampered links to return %q, got %q", ErrInvalidExportLink, err)
+	}
+
+	req, _ = http.NewRequest("GET", resp.Export.DownloadURL, nil)
+	w = httptest.NewRecorder()
+	if err := UserExportDownload(rootCtx, w, req); err != nil {
+		t.Fatalf("UserExportDownload errored with: %#v", err)
+	}
+	var archive, err = zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Expected a zip archive, got %v", err)
+	}
+	var files = map[string]string{}
+	for _, f := range archive.File {
+		var r, _ = f.Open()
+		var content, _ = ioutil.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(content)
+	}
+	if !strings.Contains(files["entries.json"], "exported entry") {
+		t.Errorf("Expected the entries to be exported, got %s", files["entries.json"])
+	}
+	if !strings.Contains(files["user.json"], "export-user") || strings.Contains(files["user.json"], "secret") {
+		t.Errorf("Expected the user to be exported without secrets, got %s", files["user.json"])
+	}
+	if strings.Contains(files["sessions.json"], "secret") || files["sessions.json"] == "[]\n" {
+		t.Errorf("Expected the session to be exported without its token, got %s", files["sessions.json"])
+	}
+}
+
+func TestUserExport_Interrupted(t *testing.T) {
+	exportDir = t.TempDir()
+
+	var userID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "export-interrupted", "b")
+	var user = dash.User{ID: userID, Username: "export-interrupted"}
+	var ctx = context.WithValue(rootCtx, UserKey, &user)
+
+	exec(`INSERT INTO exports (user_id, status, created_at) VALUES (?, ?, ?)`, userID, dash.ExportPending, time.Now().Add(-2*exportTimeout))
+	if export, _ := findLatestExport(db, userID); export.Status != dash.ExportFailed {
+		t.Fatalf("Expected exports pending beyond the timeout to fail, got %q", export.Status)
+	}
+
+	exec(`INSERT INTO exports (user_id, status, created_at) VALUES (?, ?, ?)`, userID, dash.ExportPending, time.Now())
+	if err := failPendingExports(db); err != nil {
+		t.Fatalf("failPendingExports errored with: %#v", err)
+	}
+	if export, _ := findLatestExport(db, userID); export.Status != dash.ExportFailed {
+		t.Fatalf("Expected pending exports to fail on startup, got %q", export.Status)
+	}
+
+	var w = httptest.NewRecorder()
+	if err := UserExport(ctx, w, &http.Request{}); err != nil || w.Code != http.StatusAccepted {
+		t.Fatalf("Expected a new export to start, got %d: %v", w.Code, err)
+	}
+	// wait for the export to finish before its directory is removed
+	for i := 0; i < 100; i++ {
+		if export, _ := findLatestExport(db, userID); export.Status != dash.ExportPending {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
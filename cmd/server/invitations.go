@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+const (
+	// defaultInvitationExpiry is used when an invitation is created without expires_in_days
+	defaultInvitationExpiry = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidExpiry is returned when an invitation should expire in the past
+	ErrInvalidExpiry = newAPIError(http.StatusUnprocessableEntity, "invalid_expiry", "Invalid parameter: expires_in_days. Must be positive")
+	// ErrInvalidMaxUses is returned when an invitation should be usable less than once
+	ErrInvalidMaxUses = newAPIError(http.StatusUnprocessableEntity, "invalid_max_uses", "Invalid parameter: max_uses. Must be positive")
+	// ErrMissingInvitationToken is returned when an invitation should be redeemed without a token
+	ErrMissingInvitationToken = newAPIError(http.StatusUnprocessableEntity, "missing_invitation_token", "Missing parameter: token")
+	// ErrInvalidInvitation is returned when an invitation is unknown, revoked, expired or used up
+	ErrInvalidInvitation = newAPIError(http.StatusNotFound, "invalid_invitation", "Invalid or expired invitation")
+	// ErrInvitationEmailMismatch is returned when an invitation locked to an email is redeemed by someone else
+	ErrInvitationEmailMismatch = newAPIError(http.StatusForbidden, "invitation_email_mismatch", "This invitation was issued for another email address")
+	// ErrEmailNotVerified is returned when an invitation locked to an email is redeemed before the address was verified
+	ErrEmailNotVerified = newAPIError(http.StatusForbidden, "email_not_verified", "Verify your email address before redeeming this invitation")
+	// ErrUnknownInvitation is returned when an invitation should be revoked which does not belong to the team
+	ErrUnknownInvitation = newAPIError(http.StatusNotFound, "unknown_invitation", "Unknown invitation")
+	// ErrAlreadyTeamMember is returned when a member of a team tries to join it again
+	ErrAlreadyTeamMember = newAPIError(http.StatusConflict, "already_team_member", "You are already a member of this team")
+)
+
+// hashInvitationToken returns the value stored for an invitation token. Tokens themselves are only
+// returned once when the invitation is created
+func hashInvitationToken(token string) string {
+	var sum = sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type teamInvitationCreateRequest struct {
+	ExpiresInDays int    `json:"expires_in_days"`
+	MaxUses       int    `json:"max_uses"`
+	Email         string `json:"email"`
+}
+
+type teamInvitationCreateResponse struct {
+	Status     string          `json:"status"`
+	Token      string          `json:"token"`
+	Invitation dash.Invitation `json:"invitation"`
+}
+
+// TeamInvitationCreate allows team owners and moderators to create an invitation token. Invitations expire after
+// expires_in_days (7 by default), can be redeemed max_uses times (once by default) and can be locked to an email address.
+// Locked invitations can only be redeemed by accounts which verified that address
+func TeamInvitationCreate(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityInvite); err != nil {
+		return err
+	}
+
+	var payload teamInvitationCreateRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var expiry = defaultInvitationExpiry
+	if payload.ExpiresInDays < 0 {
+		return ErrInvalidExpiry
+	} else if payload.ExpiresInDays > 0 {
+		expiry = time.Duration(payload.ExpiresInDays) * 24 * time.Hour
+	}
+	if payload.MaxUses < 0 {
+		return ErrInvalidMaxUses
+	} else if payload.MaxUses == 0 {
+		payload.MaxUses = 1
+	}
+	var email = sql.NullString{String: strings.TrimSpace(payload.Email)}
+	email.Valid = email.String != ""
+
+	var token, err = generateRandomString(24)
+	if err != nil {
+		return err
+	}
+	var invitation = dash.Invitation{
+		CreatedBy: user.Username,
+		Email:     email.String,
+		MaxUses:   payload.MaxUses,
+		ExpiresAt: time.Now().Add(expiry),
+		CreatedAt: time.Now(),
+	}
+	res, err := db.Exec(`INSERT INTO team_invitations (team_id, token, created_by, email, max_uses, uses, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		team.ID, hashInvitationToken(token), user.ID, email, invitation.MaxUses, 0, invitation.ExpiresAt, invitation.CreatedAt)
+	if err != nil {
+		return err
+	}
+	var id, _ = res.LastInsertId()
+	invitation.ID = int(id)
+	if err := recordEvent(db, dash.Event{Kind: dash.EventInvitationCreated, ActorID: user.ID, TeamID: team.ID, Detail: invitation.Email}); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(teamInvitationCreateResponse{
+		Status:     "success",
+		Token:      token,
+		Invitation: invitation,
+	})
+	return nil
+}
+
+type teamInvitationListResponse struct {
+	Status      string            `json:"status"`
+	Invitations []dash.Invitation `json:"invitations"`
+}
+
+// TeamInvitationList allows team owners and moderators to list all invitations of the team, newest first
+func TeamInvitationList(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityInvite); err != nil {
+		return err
+	}
+
+	var rows, err = db.Query(`SELECT ti.id, u.username, ti.email, ti.max_uses, ti.uses, ti.expires_at, ti.revoked_at, ti.created_at
+		FROM team_invitations ti
+		INNER JOIN users u ON u.id = ti.created_by
+		WHERE ti.team_id = ?
+		ORDER BY ti.id DESC`, team.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var invitations = make([]dash.Invitation, 0)
+	for rows.Next() {
+		var invitation dash.Invitation
+		var email sql.NullString
+		var expiresAt, revokedAt, createdAt nullTime
+		if err := rows.Scan(&invitation.ID, &invitation.CreatedBy, &email, &invitation.MaxUses, &invitation.Uses, &expiresAt, &revokedAt, &createdAt); err != nil {
+			return err
+		}
+		invitation.Email = email.String
+		invitation.ExpiresAt = expiresAt.Time
+		if revokedAt.Valid {
+			invitation.RevokedAt = &revokedAt.Time
+		}
+		invitation.CreatedAt = createdAt.Time
+		invitations = append(invitations, invitation)
+	}
+
+	json.NewEncoder(w).Encode(teamInvitationListResponse{
+		Status:      "success",
+		Invitations: invitations,
+	})
+	return nil
+}
+
+type teamInvitationRevokeRequest struct {
+	InvitationID int `json:"invitation_id"`
+}
+
+// TeamInvitationRevoke allows team owners and moderators to invalidate an invitation before it expires
+func TeamInvitationRevoke(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityInvite); err != nil {
+		return err
+	}
+
+	var payload teamInvitationRevokeRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var res, err = db.Exec(`UPDATE team_invitations SET revoked_at = ? WHERE id = ? AND team_id = ? AND revoked_at IS NULL`, time.Now(), payload.InvitationID, team.ID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrUnknownInvitation
+	}
+	if err := recordEvent(db, dash.Event{Kind: dash.EventInvitationRevoked, ActorID: user.ID, TeamID: team.ID}); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type teamInvitationRedeemRequest struct {
+	Token string `json:"token"`
+}
+
+type teamInvitationRedeemResponse struct {
+	Status   string `json:"status"`
+	TeamName string `json:"team"`
+}
+
+// redeemInvitation adds the user to the team of the invitation as member. The use is counted with a conditional
+// update, so concurrent redemptions cannot exceed max_uses
+func redeemInvitation(db *sql.DB, quotas dash.Quotas, user dash.User, token string) (string, error) {
+	var invitationID, teamID int
+	var teamName string
+	var email sql.NullString
+	var expiresAt nullTime
+	if err := db.QueryRow(`SELECT ti.id, ti.team_id, t.name, ti.email, ti.expires_at
+		FROM team_invitations ti
+		INNER JOIN teams t ON t.id = ti.team_id
+		WHERE ti.token = ? AND ti.revoked_at IS NULL AND ti.uses < ti.max_uses`, hashInvitationToken(token)).Scan(&invitationID, &teamID, &teamName, &email, &expiresAt); err != nil {
+		return "", ErrInvalidInvitation
+	}
+	if time.Now().After(expiresAt.Time) {
+		return "", ErrInvalidInvitation
+	}
+	if email.String != "" {
+		if !strings.EqualFold(email.String, user.Email.String) {
+			return "", ErrInvitationEmailMismatch
+		}
+		if !user.EmailVerified {
+			return "", ErrEmailNotVerified
+		}
+	}
+
+	var cnt = 0
+	db.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ? AND user_id = ?`, teamID, user.ID).Scan(&cnt)
+	if cnt != 0 {
+		return "", ErrAlreadyTeamMember
+	}
+	if err := checkTeamMemberQuota(db, quotas, teamID, user); err != nil {
+		return "", err
+	}
+
+	var tx, err = db.Begin()
+	if err != nil {
+		return "", err
+	}
+	var res sql.Result
+	if res, err = tx.Exec(`UPDATE team_invitations SET uses = uses + 1 WHERE id = ? AND uses < max_uses`, invitationID); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		return "", ErrInvalidInvitation
+	}
+	if err := addTeamMember(tx, teamID, user.ID); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	return teamName, tx.Commit()
+}
+
+// TeamInvitationRedeem adds the current user to the team the invitation token was issued for
+func TeamInvitationRedeem(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var payload teamInvitationRedeemRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.Token == "" {
+		return ErrMissingInvitationToken
+	}
+
+	var teamName, err = redeemInvitation(db, quotasFromContext(ctx), *user, payload.Token)
+	if err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(teamInvitationRedeemResponse{
+		Status:   "success",
+		TeamName: teamName,
+	})
+	return nil
+}
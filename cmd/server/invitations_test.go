@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestTeamInvitationRedeem(t *testing.T) {
+	var ownerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "invite-owner", "b")
+	var aliceID = exec(`INSERT INTO users (username, password, email, email_verified) VALUES (?, ?, ?, ?)`, "invite-alice", "b", "alice@example.com", true)
+	var bobID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "invite-bob", "b")
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "invite-team")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, ownerID, "owner")
+
+	var owner = dash.User{ID: ownerID, Username: "invite-owner", TeamMemberships: []dash.TeamMember{{TeamID: teamID, TeamName: "invite-team", Role: "owner"}}}
+	var alice = dash.User{ID: aliceID, Username: "invite-alice", Email: sql.NullString{String: "Alice@example.com", Valid: true}, EmailVerified: true}
+	var mallory = dash.User{ID: bobID, Username: "invite-bob", Email: sql.NullString{String: "alice@example.com", Valid: true}}
+	var bob = dash.User{ID: bobID, Username: "invite-bob"}
+
+	var create = func(user *dash.User, body string) (teamInvitationCreateResponse, error) {
+		var w = httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/teams/invitations/create", strings.NewReader(body))
+		var err = WithTeam(ContextHandlerFunc(TeamInvitationCreate)).ServeHTTPContext(context.WithValue(rootCtx, UserKey, user), w, req)
+		var resp teamInvitationCreateResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp, err
+	}
+	var redeem = func(user *dash.User, token string) error {
+		req, _ := http.NewRequest("POST", "/teams/invitations/redeem", strings.NewReader(fmt.Sprintf(`{"token":%q}`, token)))
+		return TeamInvitationRedeem(context.WithValue(rootCtx, UserKey, user), httptest.NewRecorder(), req)
+	}
+
+	if _, err := create(&bob, `{"name":"invite-team"}`); err != ErrNotTeamModerator {
+		t.Fatalf("Expected non-moderators to be rejected with %q, got %q", ErrNotTeamModerator, err)
+	}
+
+	var locked, err = create(&owner, `{"name":"invite-team","email":"alice@example.com"}`)
+	if err != nil {
+		t.Fatalf("TeamInvitationCreate errored with: %#v", err)
+	}
+	if err := redeem(&bob, locked.Token); err != ErrInvitationEmailMismatch {
+		t.Errorf("Expected locked invitations to reject other users with %q, got %q", ErrInvitationEmailMismatch, err)
+	}
+	if err := redeem(&mallory, locked.Token); err != ErrEmailNotVerified {
+		t.Errorf("Expected locked invitations to require a verified address with %q, got %q", ErrEmailNotVerified, err)
+	}
+	if err := redeem(&alice, locked.Token); err != nil {
+		t.Fatalf("TeamInvitationRedeem errored with: %#v", err)
+	}
+	if err := redeem(&alice, locked.Token); err != ErrInvalidInvitation {
+		t.Errorf("Expected used up invitations to return %q, got %q", ErrInvalidInvitation, err)
+	}
+
+	var open, _ = create(&owner, `{"name":"invite-team","max_uses":5}`)
+	req, _ := http.NewRequest("POST", "/teams/invitations/revoke", strings.NewReader(fmt.Sprintf(`{"name":"invite-team","invitation_id":%d}`, open.Invitation.ID)))
+	if err := WithTeam(ContextHandlerFunc(TeamInvitationRevoke)).ServeHTTPContext(context.WithValue(rootCtx, UserKey, &owner), httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("TeamInvitationRevoke errored with: %#v", err)
+	}
+	if err := redeem(&bob, open.Token); err != ErrInvalidInvitation {
+		t.Errorf("Expected revoked invitations to return %q, got %q", ErrInvalidInvitation, err)
+	}
+
+	var expired, _ = create(&owner, `{"name":"invite-team"}`)
+	exec(`UPDATE team_invitations SET expires_at = ? WHERE id = ?`, "2000-01-01 00:00:00", expired.Invitation.ID)
+	if err := redeem(&bob, expired.Token); err != ErrInvalidInvitation {
+		t.Errorf("Expected expired invitations to return %q, got %q", ErrInvalidInvitation, err)
+	}
+
+	var members = 0
+	db.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ?`, teamID).Scan(&members)
+	if members != 2 {
+		t.Errorf("Expected only alice to join, got %d members", members)
+	}
+
+	var w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/teams/invitations/list", strings.NewReader(`{"name":"invite-team"}`))
+	if err := WithTeam(ContextHandlerFunc(TeamInvitationList)).ServeHTTPContext(context.WithValue(rootCtx, UserKey, &owner), w, req); err != nil {
+		t.Fatalf("TeamInvitationList errored with: %#v", err)
+	}
+	var list teamInvitationListResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Invitations) != 3 || list.Invitations[1].RevokedAt == nil || list.Invitations[2].Uses != 1 {
+		t.Errorf("Expected all invitations to be listed, got %#v", list.Invitations)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrJoinRequestPending is returned when a user requests to join a team twice
+	ErrJoinRequestPending = newAPIError(http.StatusConflict, "join_request_pending", "Your request to join this team is still pending")
+	// ErrUnknownJoinRequest is returned when a moderator decides on a request which does not exist
+	ErrUnknownJoinRequest = newAPIError(http.StatusNotFound, "unknown_join_request", "Invalid parameter: username. The user has not requested to join the team")
+)
+
+// requestToJoin records a pending membership and notifies the members who may invite by email, if they opted in
+func requestToJoin(db *sql.DB, mailer Mailer, team dash.Team, user dash.User) error {
+	var cnt = 0
+	db.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ? AND user_id = ?`, team.ID, user.ID).Scan(&cnt)
+	if cnt != 0 {
+		return ErrAlreadyTeamMember
+	}
+	db.QueryRow(`SELECT count(*) FROM team_join_requests WHERE team_id = ? AND user_id = ? AND status = ?`, team.ID, user.ID, dash.JoinRequestPending).Scan(&cnt)
+	if cnt != 0 {
+		return ErrJoinRequestPending
+	}
+
+	if _, err := db.Exec(`INSERT INTO team_join_requests (team_id, user_id, status, created_at) VALUES (?, ?, ?, ?)`, team.ID, user.ID, dash.JoinRequestPending, time.Now()); err != nil {
+		return err
+	}
+
+	var rows, err = db.Query(`SELECT u.username, u.email, tu.role, COALESCE(tr.capabilities, '')
+		FROM team_user tu
+		INNER JOIN users u ON u.id = tu.user_id
+		LEFT JOIN team_roles tr ON tr.team_id = tu.team_id AND tr.name = tu.role
+		WHERE tu.team_id = ? AND u.notify_by_email = ?`, team.ID, true)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var username, capabilities string
+		var email sql.NullString
+		var membership dash.TeamMember
+		if err := rows.Scan(&username, &email, &membership.Role, &capabilities); err != nil {
+			return err
+		}
+		membership.Capabilities = splitCapabilities(capabilities)
+		if email.String == "" || !membership.Can(dash.CapabilityInvite) {
+			continue
+		}
+		var subject = fmt.Sprintf("%s wants to join %s", user.Username, team.Name)
+		var body = fmt.Sprintf("%s requested to join the team %s. Approve or reject the request via /teams/join_requests/approve or /teams/join_requests/reject.\n", user.Username, team.Name)
+		if err := mailer.SendMail(email.String, subject, body); err != nil {
+			log.Printf("failed to deliver join request notification to %q: %v\n", username, err)
+		}
+	}
+	return nil
+}
+
+// listJoinRequests returns all pending requests to join the team, oldest first
+func listJoinRequests(db *sql.DB, teamID int) ([]dash.JoinRequest, error) {
+	var rows, err = db.Query(`SELECT u.username, r.created_at FROM team_join_requests r INNER JOIN users u ON u.id = r.user_id WHERE r.team_id = ? AND r.status = ? ORDER BY r.id`, teamID, dash.JoinRequestPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests = make([]dash.JoinRequest, 0)
+	for rows.Next() {
+		var request dash.JoinRequest
+		var createdAt nullTime
+		if err := rows.Scan(&request.Username, &createdAt); err != nil {
+			return nil, err
+		}
+		request.CreatedAt = createdAt.Time
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// decideJoinRequest approves or rejects the pending request of the user. Approved requests become memberships;
+// the requesting user is notified by email, if they opted in
+func decideJoinRequest(db *sql.DB, mailer Mailer, quotas dash.Quotas, team dash.Team, target dash.User, moderator dash.User, approve bool) error {
+	var status, kind = dash.JoinRequestRejected, dash.EventJoinRequestRejected
+	if approve {
+		status, kind = dash.JoinRequestApproved, dash.EventJoinRequestApproved
+		if err := checkTeamMemberQuota(db, quotas, team.ID, moderator); err != nil {
+			return err
+		}
+	}
+
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+	var res sql.Result
+	if res, err = tx.Exec(`UPDATE team_join_requests SET status = ?, decided_by = ?, decided_at = ? WHERE team_id = ? AND user_id = ? AND status = ?`, status, moderator.ID, time.Now(), team.ID, target.ID, dash.JoinRequestPending); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		return ErrUnknownJoinRequest
+	}
+	if approve {
+		var cnt = 0
+		tx.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ? AND user_id = ?`, team.ID, target.ID).Scan(&cnt)
+		if cnt == 0 {
+			if err := addTeamMember(tx, team.ID, target.ID); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	if err := recordEvent(tx, dash.Event{Kind: kind, ActorID: moderator.ID, TeamID: team.ID, TargetUserID: target.ID}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if target.NotifyByEmail && target.Email.String != "" {
+		var subject = fmt.Sprintf("Your request to join %s was %s", team.Name, status)
+		if err := mailer.SendMail(target.Email.String, subject, subject+".\n"); err != nil {
+			log.Printf("failed to deliver join request decision to %q: %v\n", target.Username, err)
+		}
+	}
+	return nil
+}
+
+type teamSetJoinApprovalRequest struct {
+	RequiresJoinApproval bool `json:"requires_join_approval"`
+}
+
+// TeamSetJoinApproval allows the team owner to turn joining the team into a request moderators need to approve
+func TeamSetJoinApproval(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
+	}
+
+	var payload teamSetJoinApprovalRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if _, err := db.Exec(`UPDATE teams SET requires_join_approval = ?, updated_at = ? WHERE id = ?`, payload.RequiresJoinApproval, time.Now(), team.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type teamJoinRequestDecisionRequest struct {
+	Username string `json:"username"`
+}
+
+func teamJoinRequestDecision(approve bool) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+		var db = ctx.Value(DBKey).(*sql.DB)
+		var user = ctx.Value(UserKey).(*dash.User)
+		var team = ctx.Value(TeamKey).(*dash.Team)
+
+		if err := requireTeamCapability(*user, *team, dash.CapabilityInvite); err != nil {
+			return err
+		}
+
+		var payload teamJoinRequestDecisionRequest
+		json.NewDecoder(req.Body).Decode(&payload)
+
+		if payload.Username == "" {
+			return ErrMissingUsernameParameter
+		}
+		var target, err = findUserByUsername(db, payload.Username)
+		if err != nil {
+			return ErrUnknownUser
+		}
+
+		if err := decideJoinRequest(db, mailerFromContext(ctx), quotasFromContext(ctx), *team, target, *user, approve); err != nil {
+			return err
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "success",
+		})
+		return nil
+	}
+}
+
+// TeamJoinRequestApprove allows team owners and moderators to turn a pending request into a membership
+func TeamJoinRequestApprove(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	return teamJoinRequestDecision(true)(ctx, w, req)
+}
+
+// TeamJoinRequestReject allows team owners and moderators to decline a pending request
+func TeamJoinRequestReject(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	return teamJoinRequestDecision(false)(ctx, w, req)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestTeamJoin_RequiresApproval(t *testing.T) {
+	var ownerID = exec(`INSERT INTO users (username, password, email, notify_by_email) VALUES (?, ?, ?, ?)`, "join-owner", "b", "owner@example.com", true)
+	var applicantID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "join-applicant", "b")
+	var rejectedID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "join-rejected", "b")
+	var teamID = exec(`INSERT INTO teams (name, requires_join_approval) VALUES (?, ?)`, "join-team", true)
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, ownerID, "owner")
+
+	var mailer = &mockMailer{}
+	var ctx = context.WithValue(rootCtx, MailerKey, mailer)
+	var owner = dash.User{ID: ownerID, Username: "join-owner", TeamMemberships: []dash.TeamMember{{TeamID: teamID, TeamName: "join-team", Role: "owner"}}}
+	var call = func(user dash.User, handler ContextHandlerFunc, body string) (*httptest.ResponseRecorder, error) {
+		var w = httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+		return w, WithTeam(handler).ServeHTTPContext(context.WithValue(ctx, UserKey, &user), w, req)
+	}
+
+	for _, user := range []dash.User{{ID: applicantID, Username: "join-applicant"}, {ID: rejectedID, Username: "join-rejected"}} {
+		if _, err := call(user, TeamJoin, `{"name":"join-team"}`); err != nil {
+			t.Fatalf("TeamJoin errored with: %#v", err)
+		}
+	}
+	if _, err := call(dash.User{ID: applicantID}, TeamJoin, `{"name":"join-team"}`); err != ErrJoinRequestPending {
+		t.Errorf("Expected requesting twice to return %q, got %q", ErrJoinRequestPending, err)
+	}
+	if !reflect.DeepEqual(mailer.recipients, []string{"owner@example.com", "owner@example.com"}) {
+		t.Errorf("Expected the owner to be notified about both requests, got %v", mailer.recipients)
+	}
+
+	var w, err = call(owner, TeamListMember, `{"name":"join-team"}`)
+	if err != nil {
+		t.Fatalf("TeamListMember errored with: %#v", err)
+	}
+	var list teamListMembersResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Members) != 1 || len(list.PendingRequests) != 2 || list.PendingRequests[0].Username != "join-applicant" {
+		t.Fatalf("Expected two pending requests next to the owner, got %#v", list)
+	}
+
+	if _, err := call(dash.User{ID: applicantID}, TeamJoinRequestApprove, `{"name":"join-team","username":"join-applicant"}`); err != ErrNotTeamModerator {
+		t.Errorf("Expected applicants not to approve themselves, got %q", err)
+	}
+	if _, err := call(owner, TeamJoinRequestApprove, `{"name":"join-team","username":"join-applicant"}`); err != nil {
+		t.Fatalf("TeamJoinRequestApprove errored with: %#v", err)
+	}
+	if _, err := call(owner, TeamJoinRequestReject, `{"name":"join-team","username":"join-rejected"}`); err != nil {
+		t.Fatalf("TeamJoinRequestReject errored with: %#v", err)
+	}
+	if _, err := call(owner, TeamJoinRequestReject, `{"name":"join-team","username":"join-rejected"}`); err != ErrUnknownJoinRequest {
+		t.Errorf("Expected deciding twice to return %q, got %q", ErrUnknownJoinRequest, err)
+	}
+
+	for _, tc := range []struct {
+		userID   int
+		expected int
+	}{
+		{applicantID, 1},
+		{rejectedID, 0},
+	} {
+		var cnt = 0
+		db.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ? AND user_id = ?`, teamID, tc.userID).Scan(&cnt)
+		if cnt != tc.expected {
+			t.Errorf("Expected user %d to have %d memberships, got %d", tc.userID, tc.expected, cnt)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer delivers plain text emails
+type Mailer interface {
+	SendMail(to, subject, body string) error
+}
+
+// logMailer is used when no smtp server is configured. It only logs outgoing mails
+type logMailer struct{}
+
+func (logMailer) SendMail(to, subject, body string) error {
+	log.Printf("mail delivery disabled, dropping mail to %q: %q\n", to, subject)
+	return nil
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// newSMTPMailer returns a Mailer delivering mails through the smtp server at addr.
+// Authentication is only used when a username is given
+func newSMTPMailer(addr, from, username, password string) Mailer {
+	var m = &smtpMailer{addr: addr, from: from}
+	if username != "" {
+		var host, _, _ = net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *smtpMailer) SendMail(to, subject, body string) error {
+	var msg = strings.Join([]string{
+		fmt.Sprintf("From: %s", m.from),
+		fmt.Sprintf("To: %s", to),
+		fmt.Sprintf("Subject: %s", subject),
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body,
+	}, "\r\n")
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg))
+}
+
+// mailerFromContext returns the configured mailer, falling back to logging mails
+func mailerFromContext(ctx context.Context) Mailer {
+	if m, ok := ctx.Value(MailerKey).(Mailer); ok {
+		return m
+	}
+	return logMailer{}
+}
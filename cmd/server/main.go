@@ -4,12 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"embed"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -19,6 +19,8 @@ import (
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	bindata "github.com/golang-migrate/migrate/v4/source/go_bindata"
 	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/nicolai86/dash-annotations/scim"
 )
 
 //go:embed templates/entries/*
@@ -57,16 +59,46 @@ type ContextAdapter struct {
 // ServeHTTP implements the traditional golang net/http interface for a ContextAdapter
 func (ca *ContextAdapter) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	if err := ca.handler.ServeHTTPContext(ca.ctx, rw, req); err != nil {
-		var enc = json.NewEncoder(rw)
-		rw.WriteHeader(http.StatusBadRequest)
-		enc.Encode(map[string]string{
-			"status":  "error",
-			"message": err.Error(),
-		})
+		writeError(rw, err)
 	}
 }
 
-func runMigrations(db *sql.DB, driverName string) error {
+// migrations lists all migrations in order. Each has an up and a down file per driver
+var migrations = []string{
+	"1_users",
+	"2_teams",
+	"3_team_user",
+	"4_identifiers",
+	"5_entries",
+	"6_entry_team",
+	"7_password_reminders",
+	"8_votes",
+	"9_indices",
+	"10_entry_references",
+	"11_notifications",
+	"12_subscriptions",
+	"13_drafts",
+	"14_flags",
+	"15_moderation_actions",
+	"16_banned_docsets",
+	"17_admins",
+	"18_disabled_users",
+	"19_exports",
+	"20_team_invitations",
+	"21_team_join_requests",
+	"22_departure_policy",
+	"23_team_profiles",
+	"24_organizations",
+	"25_team_roles",
+	"26_event_targets",
+	"27_feed_tokens",
+	"28_team_docsets",
+	"29_quota_overrides",
+	"30_ghost_user",
+	"31_email_verification",
+}
+
+func newMigrator(db *sql.DB, driverName string) (*migrate.Migrate, error) {
 	var driver database.Driver
 	var err error
 	if driverName == "sqlite3" {
@@ -78,34 +110,32 @@ func runMigrations(db *sql.DB, driverName string) error {
 	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var names = make([]string, 0, 2*len(migrations))
+	for _, migration := range migrations {
+		names = append(names, migration+".up.sql", migration+".down.sql")
+	}
 	s := bindata.Resource(
-		[]string{
-			"1_users.up.sql",
-			"2_teams.up.sql",
-			"3_team_user.up.sql",
-			"4_identifiers.up.sql",
-			"5_entries.up.sql",
-			"6_entry_team.up.sql",
-			"7_password_reminders.up.sql",
-			"8_votes.up.sql",
-			"9_indices.up.sql",
-		},
+		names,
 		func(name string) ([]byte, error) {
 			return data.ReadFile(fmt.Sprintf("migrations/%s/%s", driverName, name))
 		})
 
 	d, err := bindata.WithInstance(s)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	m, err := migrate.NewWithInstance(
+	return migrate.NewWithInstance(
 		"go-bindata",
 		d,
 		driverName,
 		driver)
+}
+
+func runMigrations(db *sql.DB, driverName string) error {
+	var m, err = newMigrator(db, driverName)
 	if err != nil {
 		return err
 	}
@@ -123,13 +153,60 @@ func main() {
 		driverName string
 		dataSource string
 		listen     string
+
+		markdownExtensions string
+		sanitizerPolicy    string
+
+		smtpAddr     string
+		mailFrom     string
+		smtpUsername string
+		smtpPassword string
+
+		digestSender   string
+		digestWebhook  string
+		digestDir      string
+		digestInterval time.Duration
+
+		admin     string
+		scimToken string
+
+		quotas = defaultQuotas
 	)
 	flag.StringVar(&driverName, "driver", "mysql", "database driver to use. see github.com/rubenv/sql-migrate for details.")
 	flag.StringVar(&dataSource, "datasource", "", "datasource to be used with the database driver. mysql/pg REVDSN")
 	flag.StringVar(&listen, "listen", ":8000", "interface & port to listen on")
 	flag.StringVar(&encryptionKey, "session.secret", "1234567812345678", "secret used to encrypt sessions. must have either 16, 24 or 32 bytes length")
+	flag.StringVar(&markdownExtensions, "markdown.extensions", strings.Join(defaultMarkdownExtensions, ","), "comma separated markdown extensions. any of tables, footnotes, tasklists, heading-anchors, autolinks")
+	flag.StringVar(&sanitizerPolicy, "sanitizer.policy", "ugc", "html sanitizer policy applied to rendered annotations. either ugc or strict")
+	flag.StringVar(&smtpAddr, "mail.smtp", "", "host:port of the smtp server used to deliver emails. mails are only logged if empty")
+	flag.StringVar(&mailFrom, "mail.from", "annotations@localhost", "sender address of outgoing emails")
+	flag.StringVar(&smtpUsername, "mail.username", "", "username used to authenticate against the smtp server")
+	flag.StringVar(&smtpPassword, "mail.password", "", "password used to authenticate against the smtp server")
+	flag.StringVar(&digestSender, "digest.sender", "", "delivery of subscription digests. either email, webhook or file. digests are disabled if empty")
+	flag.StringVar(&digestWebhook, "digest.webhook", "", "url digests are posted to when using the webhook sender")
+	flag.StringVar(&digestDir, "digest.dir", "", "directory digests are written to when using the file sender")
+	flag.DurationVar(&digestInterval, "digest.interval", time.Hour, "how often to check for due digests")
+	flag.StringVar(&exportDir, "export.dir", exportDir, "directory personal data exports are written to")
+	flag.DurationVar(&exportTTL, "export.ttl", exportTTL, "how long personal data exports can be downloaded")
+	flag.IntVar(&quotas.EntriesPerDay, "quota.entries-per-day", quotas.EntriesPerDay, "entries a user can create within 24 hours. 0 means unlimited")
+	flag.IntVar(&quotas.MaxBodySize, "quota.max-body-size", quotas.MaxBodySize, "maximum size of entry bodies in bytes. 0 means unlimited")
+	flag.IntVar(&quotas.TeamsPerUser, "quota.teams-per-user", quotas.TeamsPerUser, "teams a user can own. 0 means unlimited")
+	flag.IntVar(&quotas.MembersPerTeam, "quota.members-per-team", quotas.MembersPerTeam, "members a team can have. 0 means unlimited")
+	flag.StringVar(&admin, "admin", os.Getenv("DASH_ANNOTATIONS_ADMIN"), "username of an existing user to grant the admin role on startup. defaults to $DASH_ANNOTATIONS_ADMIN")
+	flag.StringVar(&scimToken, "scim.token", os.Getenv("DASH_ANNOTATIONS_SCIM_TOKEN"), "bearer token identity providers use to provision users and teams via /scim/v2. SCIM is disabled if empty. defaults to $DASH_ANNOTATIONS_SCIM_TOKEN")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\nCommands:\n", os.Args[0])
+		printCommandUsage(flag.CommandLine.Output())
+		fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	var cmd, isCommand = commands[flag.Arg(0)]
+	if flag.Arg(0) != "" && !isCommand {
+		log.Fatalf("unknown command %q! please re-run with --help for details", flag.Arg(0))
+	}
+
 	if dataSource == "" {
 		log.Fatalf("missing data source! please re-run with --help for details")
 		os.Exit(1)
@@ -141,12 +218,53 @@ func main() {
 	}
 	defer db.Close()
 
-	if err := runMigrations(db, driverName); err != nil {
-		log.Panicf("failed to run migrations: %v\n", err)
+	if !cmd.skipMigrations {
+		if err := runMigrations(db, driverName); err != nil {
+			log.Panicf("failed to run migrations: %v\n", err)
+		}
+
+		if admin != "" {
+			if err := bootstrapAdmin(db, admin); err != nil {
+				log.Fatalf("failed to grant admin role to %q: %v", admin, err)
+			}
+		}
+	}
+
+	renderer, err := newMarkdownRenderer(strings.Split(markdownExtensions, ","), sanitizerPolicy)
+	if err != nil {
+		log.Fatalf("invalid markdown configuration: %v", err)
+	}
+
+	if isCommand {
+		var env = commandEnv{db: db, driver: driverName, renderer: renderer, out: os.Stdout}
+		if err := cmd.run(env, flag.Args()[1:]); err != nil {
+			log.Fatalf("%s: %v", flag.Arg(0), err)
+		}
+		return
+	}
+
+	if err := failPendingExports(db); err != nil {
+		log.Fatalf("failed to clean up interrupted exports: %v", err)
 	}
 
 	var userStorage = &sqlUserStorage{db: db}
 	var rootContext = context.WithValue(NewRootContext(db), UserStoreKey, userStorage)
+	rootContext = context.WithValue(rootContext, RendererKey, renderer)
+	rootContext = context.WithValue(rootContext, QuotasKey, quotas)
+
+	var mailer Mailer = logMailer{}
+	if smtpAddr != "" {
+		mailer = newSMTPMailer(smtpAddr, mailFrom, smtpUsername, smtpPassword)
+	}
+	rootContext = context.WithValue(rootContext, MailerKey, mailer)
+
+	if digestSender != "" {
+		var sender, err = newDigestSender(digestSender, digestWebhook, digestDir, mailer)
+		if err != nil {
+			log.Fatalf("invalid digest configuration: %v", err)
+		}
+		go runDigestScheduler(db, sender, digestInterval)
+	}
 
 	mux.Handle("/users/register", &ContextAdapter{
 		ctx:     rootContext,
@@ -160,6 +278,22 @@ func main() {
 		ctx:     rootContext,
 		handler: Authenticated(ContextHandlerFunc(UserLogout)),
 	})
+	mux.Handle("/users/delete", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(UserDelete)),
+	})
+	mux.Handle("/users/export", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(UserExport)),
+	})
+	mux.Handle("/users/export/status", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(UserExportStatus)),
+	})
+	mux.Handle("/users/export/download", &ContextAdapter{
+		ctx:     rootContext,
+		handler: ContextHandlerFunc(UserExportDownload),
+	})
 	mux.Handle("/users/password", &ContextAdapter{
 		ctx:     rootContext,
 		handler: Authenticated(ContextHandlerFunc(UserChangePassword)),
@@ -168,6 +302,26 @@ func main() {
 		ctx:     rootContext,
 		handler: Authenticated(ContextHandlerFunc(UserChangeEmail)),
 	})
+	mux.Handle("/users/email/verify", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(UserVerifyEmail)),
+	})
+	mux.Handle("/users/notifications", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(UserNotifications)),
+	})
+	mux.Handle("/users/notifications/read", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(UserNotificationsRead)),
+	})
+	mux.Handle("/users/preferences", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(UserPreferences)),
+	})
+	mux.Handle("/users/feed_token", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(UserFeedToken)),
+	})
 	// TODO(rr) add support for password forgotten requests /users/forgot/request
 	// TODO(rr) add support for password reset requests /users/forgot/reset
 
@@ -195,6 +349,14 @@ func main() {
 		ctx:     rootContext,
 		handler: Authenticated(WithEntry(ContextHandlerFunc(EntryDelete))),
 	})
+	mux.Handle("/entries/publish", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithEntry(ContextHandlerFunc(EntryPublish))),
+	})
+	mux.Handle("/entries/approve", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithEntry(ContextHandlerFunc(EntryApprove))),
+	})
 	mux.Handle("/entries/remove_from_public", &ContextAdapter{
 		ctx:     rootContext,
 		handler: Authenticated(WithEntry(ContextHandlerFunc(EntryRemoveFromPublic))),
@@ -204,10 +366,123 @@ func main() {
 		handler: Authenticated(WithEntry(ContextHandlerFunc(EntryRemoveFromTeams))),
 	})
 
+	mux.Handle("/entries/restore_to_public", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithEntry(ContextHandlerFunc(EntryRestoreToPublic))),
+	})
+	mux.Handle("/entries/restore_to_teams", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithEntry(ContextHandlerFunc(EntryRestoreToTeams))),
+	})
+	mux.Handle("/entries/flag", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithEntry(ContextHandlerFunc(EntryFlag))),
+	})
+
+	mux.Handle("/moderation/queue", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(ModerationQueue)),
+	})
+	mux.Handle("/moderation/resolve", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(ModerationResolve)),
+	})
+	mux.Handle("/moderation/log", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(ModerationLog)),
+	})
+
+	mux.Handle("/admin/moderators/list", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(AdminModeratorList)),
+	})
+	mux.Handle("/admin/moderators/promote", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(AdminModeratorPromote)),
+	})
+	mux.Handle("/admin/moderators/demote", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(AdminModeratorDemote)),
+	})
+	mux.Handle("/admin/log", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(AdminLog)),
+	})
+	mux.Handle("/admin/users/suspend", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(AdminUserSuspend)),
+	})
+	mux.Handle("/admin/users/unsuspend", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(AdminUserUnsuspend)),
+	})
+	mux.Handle("/admin/quotas/list", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(AdminQuotaList)),
+	})
+	mux.Handle("/admin/quotas/set", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(AdminQuotaSet)),
+	})
+
+	mux.Handle("/identifiers/ban", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(IdentifierBan)),
+	})
+	mux.Handle("/identifiers/unban", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(IdentifierUnban)),
+	})
+	mux.Handle("/identifiers/ban_docset", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(DocsetBan)),
+	})
+	mux.Handle("/identifiers/unban_docset", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(DocsetUnban)),
+	})
+	mux.Handle("/identifiers/banned", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(BannedList)),
+	})
+
+	mux.Handle("/subscriptions/list", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(SubscriptionList)),
+	})
+	mux.Handle("/subscriptions/create", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(SubscriptionCreate)),
+	})
+	mux.Handle("/subscriptions/delete", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(SubscriptionDelete)),
+	})
+
 	mux.Handle("/teams/list", &ContextAdapter{
 		ctx:     rootContext,
 		handler: Authenticated(ContextHandlerFunc(TeamList)),
 	})
+	mux.Handle("/organizations/create", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(OrganizationCreate)),
+	})
+	mux.Handle("/organizations/set_admin", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithOrganization(ContextHandlerFunc(OrganizationSetAdmin))),
+	})
+	mux.Handle("/organizations/set_defaults", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithOrganization(ContextHandlerFunc(OrganizationSetDefaults))),
+	})
+	mux.Handle("/organizations/add_team", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithOrganization(ContextHandlerFunc(OrganizationAddTeam))),
+	})
+	mux.Handle("/organizations/list_members", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithOrganization(ContextHandlerFunc(OrganizationListMembers))),
+	})
 	mux.Handle("/teams/create", &ContextAdapter{
 		ctx:     rootContext,
 		handler: Authenticated(ContextHandlerFunc(TeamCreate)),
@@ -224,6 +499,50 @@ func main() {
 		ctx:     rootContext,
 		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamSetRole))),
 	})
+	mux.Handle("/teams/activity", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamActivity))),
+	})
+	mux.Handle("/teams/activity.atom", &ContextAdapter{
+		ctx:     rootContext,
+		handler: ContextHandlerFunc(TeamActivityFeed),
+	})
+	mux.Handle("/teams/set_docsets", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamSetDocsets))),
+	})
+	mux.Handle("/teams/roles/list", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamRoleList))),
+	})
+	mux.Handle("/teams/roles/set", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamRoleSet))),
+	})
+	mux.Handle("/teams/roles/delete", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamRoleDelete))),
+	})
+	mux.Handle("/teams/rename", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamRename))),
+	})
+	mux.Handle("/teams/set_profile", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamSetProfile))),
+	})
+	mux.Handle("/teams/delete", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamDelete))),
+	})
+	mux.Handle("/teams/set_departure_policy", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamSetDeparturePolicy))),
+	})
+	mux.Handle("/teams/transfer_ownership", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamTransferOwnership))),
+	})
 	mux.Handle("/teams/remove_member", &ContextAdapter{
 		ctx:     rootContext,
 		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamRemoveMember))),
@@ -232,10 +551,50 @@ func main() {
 		ctx:     rootContext,
 		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamSetAccessKey))),
 	})
+	mux.Handle("/teams/set_approval", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamSetApproval))),
+	})
+	mux.Handle("/teams/pending_entries", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamPendingEntries))),
+	})
 	mux.Handle("/teams/list_members", &ContextAdapter{
 		ctx:     rootContext,
 		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamListMember))),
 	})
+	mux.Handle("/teams/set_join_approval", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamSetJoinApproval))),
+	})
+	mux.Handle("/teams/join_requests/approve", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamJoinRequestApprove))),
+	})
+	mux.Handle("/teams/join_requests/reject", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamJoinRequestReject))),
+	})
+	mux.Handle("/teams/invitations/create", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamInvitationCreate))),
+	})
+	mux.Handle("/teams/invitations/list", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamInvitationList))),
+	})
+	mux.Handle("/teams/invitations/revoke", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(WithTeam(ContextHandlerFunc(TeamInvitationRevoke))),
+	})
+	mux.Handle("/teams/invitations/redeem", &ContextAdapter{
+		ctx:     rootContext,
+		handler: Authenticated(ContextHandlerFunc(TeamInvitationRedeem)),
+	})
+
+	if scimToken != "" {
+		mux.Handle("/scim/v2/", http.StripPrefix("/scim/v2", scim.NewHandler(&sqlSCIMProvider{db: db}, scimToken)))
+	}
 
 	log.Printf("Listening on %q\n", listen)
 	http.ListenAndServe(listen, logHandler(jsonHandler(mux)))
@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -12,12 +15,29 @@ import (
 
 func clearDatabase(db *sql.DB) {
 	db.Exec(`DELETE FROM votes;`)
+	db.Exec(`DELETE FROM entry_references;`)
+	db.Exec(`DELETE FROM notifications;`)
+	db.Exec(`DELETE FROM subscriptions;`)
+	db.Exec(`DELETE FROM events;`)
+	db.Exec(`DELETE FROM flags;`)
+	db.Exec(`DELETE FROM moderation_actions;`)
+	db.Exec(`DELETE FROM banned_docsets;`)
+	db.Exec(`DELETE FROM admin_actions;`)
+	db.Exec(`DELETE FROM exports;`)
+	db.Exec(`DELETE FROM team_invitations;`)
+	db.Exec(`DELETE FROM team_join_requests;`)
+	db.Exec(`DELETE FROM team_roles;`)
+	db.Exec(`DELETE FROM team_docsets;`)
+	db.Exec(`DELETE FROM quota_overrides;`)
 	db.Exec(`DELETE FROM team_user;`)
 	db.Exec(`DELETE FROM entry_team;`)
 	db.Exec(`DELETE FROM teams;`)
+	db.Exec(`DELETE FROM organization_admins;`)
+	db.Exec(`DELETE FROM organizations;`)
 	db.Exec(`DELETE FROM identifiers;`)
 	db.Exec(`DELETE FROM entries;`)
 	db.Exec(`DELETE FROM users;`)
+	invalidateBannedDocsets()
 }
 
 var (
@@ -25,6 +45,19 @@ var (
 	db      *sql.DB
 )
 
+// call posts the body to the handler as the user with the given id
+func call(userID int, handler ContextHandler, body string) (*httptest.ResponseRecorder, error) {
+	return callWithContext(rootCtx, userID, handler, body)
+}
+
+// callWithContext posts the body to the handler as the user with the given id, deriving the request context from ctx
+func callWithContext(ctx context.Context, userID int, handler ContextHandler, body string) (*httptest.ResponseRecorder, error) {
+	var user, _ = findUserByID(db, userID)
+	var w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	return w, handler.ServeHTTPContext(context.WithValue(ctx, UserKey, &user), w, req)
+}
+
 func TestMain(m *testing.M) {
 	var driver = os.Getenv("TEST_DRIVER")
 	if driver == "" {
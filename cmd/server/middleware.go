@@ -8,7 +8,6 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -19,13 +18,17 @@ import (
 var (
 	encryptionKey = "1234567812345678"
 	// ErrAuthenticationRequired is returned from Authenticated middleware if the session can not be matched to an existing user
-	ErrAuthenticationRequired = errors.New("Authentication required")
+	ErrAuthenticationRequired = newAPIError(http.StatusUnauthorized, "authentication_required", "Authentication required")
 	// ErrTeamUnknown is returned when a name cannot be matched to the requested team name
-	ErrTeamUnknown = errors.New("Unknown team")
+	ErrTeamUnknown = newAPIError(http.StatusNotFound, "team_unknown", "Unknown team")
 	// ErrEntryUnknown is returned if the entry_id cannot be matched to the requested entry_id
-	ErrEntryUnknown = errors.New("Unknown entry")
+	ErrEntryUnknown = newAPIError(http.StatusNotFound, "entry_unknown", "Unknown entry")
 	// ErrMissingEntryID is returned if the entry_id parameter is empty or not present
-	ErrMissingEntryID = errors.New("Missing parameter: entry_id")
+	ErrMissingEntryID = newAPIError(http.StatusUnprocessableEntity, "missing_entry_id", "Missing parameter: entry_id")
+	// ErrMissingSessionCookie is returned from Authenticated middleware if the request carries no session cookie
+	ErrMissingSessionCookie = newAPIError(http.StatusUnauthorized, "missing_session_cookie", "Missing session cookie")
+	// ErrOrganizationUnknown is returned when a name cannot be matched to the requested organization
+	ErrOrganizationUnknown = newAPIError(http.StatusNotFound, "organization_unknown", "Unknown organization")
 )
 
 func encrypt(b []byte) ([]byte, error) {
@@ -108,6 +111,18 @@ const TeamKey key = 2
 // EntryKey is used to fetch the current entry from a context
 const EntryKey key = 3
 
+// RendererKey is used to fetch the markdown renderer from a context
+const RendererKey key = 4
+
+// MailerKey is used to fetch the mailer from a context
+const MailerKey key = 5
+
+// OrganizationKey is used to fetch the current organization from a context
+const OrganizationKey key = 6
+
+// QuotasKey is used to fetch the configured quotas from a context
+const QuotasKey key = 7
+
 type withEntryPayload struct {
 	EntryID int `json:"entry_id"`
 }
@@ -126,9 +141,13 @@ func findEntryByID(db *sql.DB, entryID int) (dash.Entry, error) {
 				e.user_id,
 				e.removed_from_public,
 				e.public,
-				u.username
+				e.draft,
+				e.identifier_id,
+				u.username,
+				COALESCE(o.name, '')
 			FROM entries AS e
 			INNER JOIN users AS u ON u.id = e.user_id
+			LEFT JOIN organizations AS o ON o.id = e.organization_id
 			WHERE e.id = ?`, entryID,
 	).Scan(
 		&entry.Title,
@@ -140,13 +159,16 @@ func findEntryByID(db *sql.DB, entryID int) (dash.Entry, error) {
 		&entry.UserID,
 		&entry.RemovedFromPublic,
 		&entry.Public,
-		&entry.AuthorUsername)
+		&entry.Draft,
+		&entry.IdentifierID,
+		&entry.AuthorUsername,
+		&entry.Organization)
 	if err != nil {
 		return entry, err
 	}
 
 	var rows *sql.Rows
-	rows, err = db.Query(`select t.name FROM teams AS t inner join entry_team ON t.id = entry_team.team_id where entry_team.entry_id = ?`, entryID)
+	rows, err = db.Query(`select t.name, entry_team.author_former_member FROM teams AS t inner join entry_team ON t.id = entry_team.team_id where entry_team.entry_id = ?`, entryID)
 	if err != nil {
 		return entry, err
 	}
@@ -155,10 +177,12 @@ func findEntryByID(db *sql.DB, entryID int) (dash.Entry, error) {
 
 	for rows.Next() {
 		var teamName string
-		if err := rows.Scan(&teamName); err != nil {
+		var formerMember bool
+		if err := rows.Scan(&teamName, &formerMember); err != nil {
 			return entry, err
 		}
 		entry.Teams = append(entry.Teams, teamName)
+		entry.AuthorDeparted = entry.AuthorDeparted || formerMember
 	}
 
 	return entry, err
@@ -201,7 +225,9 @@ func findTeamByName(db *sql.DB, teamName string) (dash.Team, error) {
 	var team = dash.Team{
 		Name: teamName,
 	}
-	var err = db.QueryRow(`SELECT t.id, t.access_key, tm.user_id FROM teams AS t INNER JOIN team_user AS tm ON tm.team_id = t.id WHERE name = ? AND tm.role = ? LIMIT 1`, teamName, "owner").Scan(&team.ID, &team.EncryptedAccessKey, &team.OwnerID)
+	var organizationID sql.NullInt64
+	var err = db.QueryRow(`SELECT t.id, t.access_key, t.requires_join_approval, t.departure_policy, t.description, t.avatar_url, t.organization_id, tm.user_id FROM teams AS t INNER JOIN team_user AS tm ON tm.team_id = t.id WHERE name = ? AND tm.role = ? LIMIT 1`, teamName, "owner").Scan(&team.ID, &team.EncryptedAccessKey, &team.RequiresJoinApproval, &team.DeparturePolicy, &team.Description, &team.AvatarURL, &organizationID, &team.OwnerID)
+	team.OrganizationID = int(organizationID.Int64)
 	return team, err
 }
 
@@ -234,6 +260,47 @@ func WithTeam(h ContextHandler) ContextHandler {
 	})
 }
 
+type withOrganizationPayload struct {
+	OrganizationName string `json:"name"`
+}
+
+func findOrganizationByName(db *sql.DB, name string) (dash.Organization, error) {
+	var organization = dash.Organization{
+		Name: name,
+	}
+	var err = db.QueryRow(`SELECT id, default_access_key, default_visibility FROM organizations WHERE name = ?`, name).Scan(&organization.ID, &organization.DefaultEncryptedAccessKey, &organization.DefaultVisibility)
+	return organization, err
+}
+
+// WithOrganization is a middleware that extracts the organization from the given payload and
+// adds it to the request context.
+// The organization is always searched by using the name parameter
+// If no organization is found the request is halted.
+func WithOrganization(h ContextHandler) ContextHandler {
+	return ContextHandlerFunc(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		var db = ctx.Value(DBKey).(*sql.DB)
+
+		var body bytes.Buffer
+		var dec = json.NewDecoder(io.TeeReader(req.Body, &body))
+		req.Body = ioutil.NopCloser(&body)
+
+		var payload withOrganizationPayload
+		dec.Decode(&payload)
+
+		if payload.OrganizationName == "" {
+			return ErrMissingOrganizationName
+		}
+
+		var organization, err = findOrganizationByName(db, payload.OrganizationName)
+		if err != nil {
+			return ErrOrganizationUnknown
+		}
+
+		ctx = context.WithValue(ctx, OrganizationKey, &organization)
+		return h.ServeHTTPContext(ctx, rw, req)
+	})
+}
+
 // Authenticated is a middleware that checks for authentication in the request
 // Authentication is identified using the laravel_session cookie.
 // If no authentication is present the request is halted.
@@ -248,17 +315,20 @@ func Authenticated(h ContextHandler) ContextHandler {
 			}
 		}
 		if encryptedSessionID == "" {
-			return errors.New("Missing session cookie")
+			return ErrMissingSessionCookie
 		}
 		sessionID, err := decrypt([]byte(encryptedSessionID))
 		if err != nil {
-			return err
+			return ErrAuthenticationRequired
 		}
 
 		user, err := findUserByRememberToken(db, string(sessionID))
 		if err != nil {
 			return ErrAuthenticationRequired
 		}
+		if user.Disabled {
+			return ErrUserDisabled
+		}
 		ctx = context.WithValue(ctx, UserKey, &user)
 		ctx = context.WithValue(ctx, UserStoreKey, &sqlUserStorage{db: db})
 
@@ -280,7 +350,7 @@ func MaybeAuthenticated(h ContextHandler) ContextHandler {
 		}
 		if encryptedSessionID != "" {
 			if sessionID, err := decrypt([]byte(encryptedSessionID)); err == nil {
-				if user, err := findUserByRememberToken(db, string(sessionID)); err == nil {
+				if user, err := findUserByRememberToken(db, string(sessionID)); err == nil && !user.Disabled {
 					ctx = context.WithValue(ctx, UserKey, &user)
 				}
 			}
@@ -0,0 +1 @@
+DROP TABLE `entry_references`;
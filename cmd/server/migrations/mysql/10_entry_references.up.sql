@@ -0,0 +1,14 @@
+CREATE TABLE `entry_references` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `entry_id` int(10) unsigned NOT NULL,
+  `target_entry_id` int(10) unsigned DEFAULT NULL,
+  `target_identifier_id` int(10) unsigned DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  KEY `entry_references_entry_id_foreign` (`entry_id`),
+  KEY `entry_references_target_entry_id_foreign` (`target_entry_id`),
+  KEY `entry_references_target_identifier_id_foreign` (`target_identifier_id`),
+  CONSTRAINT `entry_references_entry_id_foreign` FOREIGN KEY (`entry_id`) REFERENCES `entries` (`id`),
+  CONSTRAINT `entry_references_target_entry_id_foreign` FOREIGN KEY (`target_entry_id`) REFERENCES `entries` (`id`),
+  CONSTRAINT `entry_references_target_identifier_id_foreign` FOREIGN KEY (`target_identifier_id`) REFERENCES `identifiers` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,5 @@
+DROP TABLE `notifications`;
+
+ALTER TABLE `users`
+  DROP COLUMN `notify_mentions`,
+  DROP COLUMN `notify_by_email`;
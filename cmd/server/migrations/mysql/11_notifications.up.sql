@@ -0,0 +1,19 @@
+ALTER TABLE `users`
+  ADD COLUMN `notify_mentions` tinyint(1) NOT NULL DEFAULT true,
+  ADD COLUMN `notify_by_email` tinyint(1) NOT NULL DEFAULT false;
+
+CREATE TABLE `notifications` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` int(10) unsigned NOT NULL,
+  `actor_id` int(10) unsigned NOT NULL,
+  `entry_id` int(10) unsigned NOT NULL,
+  `kind` varchar(255) NOT NULL,
+  `read_at` timestamp NULL DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  KEY `notifications_user_id_foreign` (`user_id`),
+  KEY `notifications_entry_id_foreign` (`entry_id`),
+  CONSTRAINT `notifications_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`),
+  CONSTRAINT `notifications_actor_id_foreign` FOREIGN KEY (`actor_id`) REFERENCES `users` (`id`),
+  CONSTRAINT `notifications_entry_id_foreign` FOREIGN KEY (`entry_id`) REFERENCES `entries` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,28 @@
+CREATE TABLE `subscriptions` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` int(10) unsigned NOT NULL,
+  `docset_filename` varchar(340) NOT NULL,
+  `identifier_id` int(10) unsigned DEFAULT NULL,
+  `frequency` varchar(255) NOT NULL,
+  `last_digest_at` timestamp NULL DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  KEY `subscriptions_user_id_foreign` (`user_id`),
+  CONSTRAINT `subscriptions_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`),
+  CONSTRAINT `subscriptions_identifier_id_foreign` FOREIGN KEY (`identifier_id`) REFERENCES `identifiers` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `events` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `kind` varchar(255) NOT NULL,
+  `actor_id` int(10) unsigned NOT NULL,
+  `entry_id` int(10) unsigned DEFAULT NULL,
+  `identifier_id` int(10) unsigned DEFAULT NULL,
+  `team_id` int(10) unsigned DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  KEY `events_entry_id_index` (`entry_id`),
+  KEY `events_identifier_id_index` (`identifier_id`),
+  KEY `events_team_id_index` (`team_id`),
+  KEY `events_created_at_index` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
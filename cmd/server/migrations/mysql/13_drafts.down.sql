@@ -0,0 +1,8 @@
+ALTER TABLE `teams`
+  DROP COLUMN `requires_approval`;
+
+ALTER TABLE `entry_team`
+  DROP COLUMN `approved`;
+
+ALTER TABLE `entries`
+  DROP COLUMN `draft`;
@@ -0,0 +1,15 @@
+CREATE TABLE `flags` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `entry_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `reason` text NOT NULL,
+  `status` varchar(255) NOT NULL,
+  `resolution` varchar(255) DEFAULT NULL,
+  `resolved_by` int(10) unsigned DEFAULT NULL,
+  `resolved_at` timestamp NULL DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  KEY `flags_entry_id_index` (`entry_id`),
+  KEY `flags_status_index` (`status`),
+  CONSTRAINT `flags_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
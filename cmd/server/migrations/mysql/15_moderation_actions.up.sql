@@ -0,0 +1,16 @@
+CREATE TABLE `moderation_actions` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `actor_id` int(10) unsigned NOT NULL,
+  `action` varchar(255) NOT NULL,
+  `entry_id` int(10) unsigned NOT NULL,
+  `entry_title` varchar(255) NOT NULL,
+  `team_id` int(10) unsigned DEFAULT NULL,
+  `reason` text NOT NULL,
+  `before_state` varchar(255) NOT NULL,
+  `after_state` varchar(255) NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  KEY `moderation_actions_actor_id_index` (`actor_id`),
+  KEY `moderation_actions_team_id_index` (`team_id`),
+  KEY `moderation_actions_created_at_index` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
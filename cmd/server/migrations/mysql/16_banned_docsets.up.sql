@@ -0,0 +1,8 @@
+CREATE TABLE `banned_docsets` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `pattern` varchar(340) NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `banned_docsets_pattern_unique` (`pattern`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,4 @@
+DROP TABLE `admin_actions`;
+
+ALTER TABLE `users`
+  DROP COLUMN `admin`;
@@ -0,0 +1,13 @@
+ALTER TABLE `users`
+  ADD COLUMN `admin` tinyint(1) NOT NULL DEFAULT false;
+
+CREATE TABLE `admin_actions` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `actor_id` int(10) unsigned DEFAULT NULL,
+  `action` varchar(255) NOT NULL,
+  `source` varchar(255) NOT NULL,
+  `target_user_id` int(10) unsigned NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  KEY `admin_actions_target_user_id_index` (`target_user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,2 @@
+ALTER TABLE `users`
+  ADD COLUMN `disabled` tinyint(1) NOT NULL DEFAULT false;
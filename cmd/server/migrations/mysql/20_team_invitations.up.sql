@@ -0,0 +1,17 @@
+CREATE TABLE `team_invitations` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `team_id` int(10) unsigned NOT NULL,
+  `token` varchar(64) NOT NULL,
+  `created_by` int(10) unsigned NOT NULL,
+  `email` varchar(300) DEFAULT NULL,
+  `max_uses` int(10) unsigned NOT NULL,
+  `uses` int(10) unsigned NOT NULL DEFAULT 0,
+  `expires_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  `revoked_at` timestamp NULL DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `team_invitations_token_unique` (`token`),
+  KEY `team_invitations_team_id_foreign` (`team_id`),
+  CONSTRAINT `team_invitations_team_id_foreign` FOREIGN KEY (`team_id`) REFERENCES `teams` (`id`),
+  CONSTRAINT `team_invitations_created_by_foreign` FOREIGN KEY (`created_by`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
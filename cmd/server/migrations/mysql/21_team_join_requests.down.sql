@@ -0,0 +1,4 @@
+DROP TABLE `team_join_requests`;
+
+ALTER TABLE `teams`
+  DROP COLUMN `requires_join_approval`;
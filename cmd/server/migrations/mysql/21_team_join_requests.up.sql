@@ -0,0 +1,16 @@
+ALTER TABLE `teams`
+  ADD COLUMN `requires_join_approval` tinyint(1) NOT NULL DEFAULT false;
+
+CREATE TABLE `team_join_requests` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `team_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `status` varchar(255) NOT NULL,
+  `decided_by` int(10) unsigned DEFAULT NULL,
+  `decided_at` timestamp NULL DEFAULT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  KEY `team_join_requests_team_id_foreign` (`team_id`),
+  CONSTRAINT `team_join_requests_team_id_foreign` FOREIGN KEY (`team_id`) REFERENCES `teams` (`id`),
+  CONSTRAINT `team_join_requests_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
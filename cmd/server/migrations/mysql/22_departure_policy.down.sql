@@ -0,0 +1,5 @@
+ALTER TABLE `teams`
+  DROP COLUMN `departure_policy`;
+
+ALTER TABLE `entry_team`
+  DROP COLUMN `author_former_member`;
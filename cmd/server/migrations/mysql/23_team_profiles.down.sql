@@ -0,0 +1,3 @@
+ALTER TABLE `teams`
+  DROP COLUMN `description`,
+  DROP COLUMN `avatar_url`;
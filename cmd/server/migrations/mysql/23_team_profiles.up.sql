@@ -0,0 +1,3 @@
+ALTER TABLE `teams`
+  ADD COLUMN `description` varchar(1000) NOT NULL DEFAULT '',
+  ADD COLUMN `avatar_url` varchar(2000) NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+ALTER TABLE `entries`
+  DROP COLUMN `organization_id`;
+
+ALTER TABLE `teams`
+  DROP COLUMN `organization_id`;
+
+DROP TABLE `organization_admins`;
+
+DROP TABLE `organizations`;
@@ -0,0 +1,27 @@
+CREATE TABLE `organizations` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `name` varchar(191) NOT NULL,
+  `default_access_key` varchar(500) NOT NULL DEFAULT '',
+  `default_visibility` varchar(255) NOT NULL DEFAULT 'team',
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  `updated_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `organizations_name_unique` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `organization_admins` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `organization_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  KEY `organization_admins_organization_id_foreign` (`organization_id`),
+  CONSTRAINT `organization_admins_organization_id_foreign` FOREIGN KEY (`organization_id`) REFERENCES `organizations` (`id`),
+  CONSTRAINT `organization_admins_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+ALTER TABLE `teams`
+  ADD COLUMN `organization_id` int(10) unsigned DEFAULT NULL;
+
+ALTER TABLE `entries`
+  ADD COLUMN `organization_id` int(10) unsigned DEFAULT NULL;
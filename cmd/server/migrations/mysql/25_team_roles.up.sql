@@ -0,0 +1,11 @@
+CREATE TABLE `team_roles` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `team_id` int(10) unsigned NOT NULL,
+  `name` varchar(191) NOT NULL,
+  `capabilities` varchar(1000) NOT NULL DEFAULT '',
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  `updated_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `team_roles_team_id_name_unique` (`team_id`, `name`),
+  CONSTRAINT `team_roles_team_id_foreign` FOREIGN KEY (`team_id`) REFERENCES `teams` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
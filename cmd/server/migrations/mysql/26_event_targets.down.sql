@@ -0,0 +1,3 @@
+ALTER TABLE `events`
+  DROP COLUMN `target_user_id`,
+  DROP COLUMN `detail`;
@@ -0,0 +1,3 @@
+ALTER TABLE `events`
+  ADD COLUMN `target_user_id` int(10) unsigned DEFAULT NULL,
+  ADD COLUMN `detail` varchar(255) NOT NULL DEFAULT '';
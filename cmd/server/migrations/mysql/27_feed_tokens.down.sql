@@ -0,0 +1,3 @@
+ALTER TABLE `users`
+  DROP INDEX `users_feed_token_index`,
+  DROP COLUMN `feed_token`;
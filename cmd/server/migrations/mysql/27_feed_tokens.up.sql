@@ -0,0 +1,3 @@
+ALTER TABLE `users`
+  ADD COLUMN `feed_token` varchar(64) DEFAULT NULL,
+  ADD INDEX `users_feed_token_index` (`feed_token`);
@@ -0,0 +1,9 @@
+CREATE TABLE `team_docsets` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `team_id` int(10) unsigned NOT NULL,
+  `pattern` varchar(191) NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `team_docsets_team_id_pattern_unique` (`team_id`, `pattern`),
+  CONSTRAINT `team_docsets_team_id_foreign` FOREIGN KEY (`team_id`) REFERENCES `teams` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,12 @@
+CREATE TABLE `quota_overrides` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` int(10) unsigned DEFAULT NULL,
+  `team_id` int(10) unsigned DEFAULT NULL,
+  `quota` varchar(64) NOT NULL,
+  `quota_limit` int(10) unsigned NOT NULL DEFAULT 0,
+  `created_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  `updated_at` timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  PRIMARY KEY (`id`),
+  KEY `quota_overrides_user_id_index` (`user_id`),
+  KEY `quota_overrides_team_id_index` (`team_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,3 @@
+ALTER TABLE `users`
+  ADD COLUMN `email_verified` tinyint(1) NOT NULL DEFAULT false,
+  ADD COLUMN `email_verification_token` varchar(64) DEFAULT NULL;
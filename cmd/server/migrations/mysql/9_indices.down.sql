@@ -0,0 +1,12 @@
+-- DROP INDEX votes_entry_id_foreign ON votes;
+-- DROP INDEX votes_user_id_foreign ON votes;
+-- DROP INDEX password_reminders_email_index ON password_reminders;
+-- DROP INDEX password_reminders_token_index ON password_reminders;
+-- DROP INDEX users_username_unique ON users;
+-- DROP INDEX entries_identifier_id_foreign ON entries;
+-- DROP INDEX entries_user_id_foreign ON entries;
+-- DROP INDEX teams_name_unique ON teams;
+-- DROP INDEX entry_team_entry_id_foreign ON entry_team;
+-- DROP INDEX entry_team_team_id_foreign ON entry_team;
+-- DROP INDEX team_user_team_id_foreign ON team_user;
+-- DROP INDEX team_user_user_id_foreign ON team_user;
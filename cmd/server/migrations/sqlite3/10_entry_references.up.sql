@@ -0,0 +1,13 @@
+CREATE TABLE entry_references (
+  "id" INTEGER primary key,
+  "entry_id" int(10)  NOT NULL,
+  "target_entry_id" int(10) DEFAULT NULL,
+  "target_identifier_id" int(10) DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "entry_references_entry_id_foreign" FOREIGN KEY ("entry_id") REFERENCES "entries" ("id"),
+  CONSTRAINT "entry_references_target_entry_id_foreign" FOREIGN KEY ("target_entry_id") REFERENCES "entries" ("id"),
+  CONSTRAINT "entry_references_target_identifier_id_foreign" FOREIGN KEY ("target_identifier_id") REFERENCES "identifiers" ("id")
+);
+
+CREATE INDEX "entry_references_entry_id_foreign" ON "entry_references" ("entry_id");
+CREATE INDEX "entry_references_target_entry_id_foreign" ON "entry_references" ("target_entry_id");
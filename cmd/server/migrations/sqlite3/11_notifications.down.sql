@@ -0,0 +1,19 @@
+DROP TABLE notifications;
+
+-- sqlite cannot drop columns, so the users table is rebuilt without the notification settings
+CREATE TABLE users_down (
+  "id" INTEGER primary key ,
+  "username" varchar(191) NOT NULL,
+  "email" varchar(300) DEFAULT NULL,
+  "password" varchar(500) NOT NULL,
+  "moderator" tinyint(1) NOT NULL DEFAULT false,
+  "remember_token" varchar(500) DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00'
+);
+INSERT INTO users_down (id, username, email, password, moderator, remember_token, created_at, updated_at)
+  SELECT id, username, email, password, moderator, remember_token, created_at, updated_at FROM users;
+DROP TABLE users;
+ALTER TABLE users_down RENAME TO users;
+
+CREATE INDEX "users_username_unique" ON "users" ("username");
@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN "notify_mentions" tinyint(1) NOT NULL DEFAULT true;
+ALTER TABLE users ADD COLUMN "notify_by_email" tinyint(1) NOT NULL DEFAULT false;
+
+CREATE TABLE notifications (
+  "id" INTEGER primary key,
+  "user_id" int(10)  NOT NULL,
+  "actor_id" int(10)  NOT NULL,
+  "entry_id" int(10)  NOT NULL,
+  "kind" varchar(255) NOT NULL,
+  "read_at" timestamp DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "notifications_user_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id"),
+  CONSTRAINT "notifications_actor_id_foreign" FOREIGN KEY ("actor_id") REFERENCES "users" ("id"),
+  CONSTRAINT "notifications_entry_id_foreign" FOREIGN KEY ("entry_id") REFERENCES "entries" ("id")
+);
+
+CREATE INDEX "notifications_user_id_foreign" ON "notifications" ("user_id");
+CREATE INDEX "notifications_entry_id_foreign" ON "notifications" ("entry_id");
@@ -0,0 +1,27 @@
+CREATE TABLE subscriptions (
+  "id" INTEGER primary key,
+  "user_id" int(10)  NOT NULL,
+  "docset_filename" varchar(340) NOT NULL,
+  "identifier_id" int(10) DEFAULT NULL,
+  "frequency" varchar(255) NOT NULL,
+  "last_digest_at" timestamp DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "subscriptions_user_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id"),
+  CONSTRAINT "subscriptions_identifier_id_foreign" FOREIGN KEY ("identifier_id") REFERENCES "identifiers" ("id")
+);
+
+CREATE TABLE events (
+  "id" INTEGER primary key,
+  "kind" varchar(255) NOT NULL,
+  "actor_id" int(10)  NOT NULL,
+  "entry_id" int(10) DEFAULT NULL,
+  "identifier_id" int(10) DEFAULT NULL,
+  "team_id" int(10) DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00'
+);
+
+CREATE INDEX "subscriptions_user_id_foreign" ON "subscriptions" ("user_id");
+CREATE INDEX "events_entry_id_index" ON "events" ("entry_id");
+CREATE INDEX "events_identifier_id_index" ON "events" ("identifier_id");
+CREATE INDEX "events_team_id_index" ON "events" ("team_id");
+CREATE INDEX "events_created_at_index" ON "events" ("created_at");
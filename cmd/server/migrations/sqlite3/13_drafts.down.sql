@@ -0,0 +1,55 @@
+-- sqlite cannot drop columns, so the affected tables are rebuilt without the approval and draft columns
+CREATE TABLE teams_down (
+  "id" INTEGER primary key,
+  "name" varchar(191) NOT NULL,
+  "access_key" varchar(500) NOT NULL DEFAULT '',
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00'
+);
+INSERT INTO teams_down (id, name, access_key, created_at, updated_at)
+  SELECT id, name, access_key, created_at, updated_at FROM teams;
+DROP TABLE teams;
+ALTER TABLE teams_down RENAME TO teams;
+
+CREATE TABLE entry_team_down (
+  "id" INTEGER primary key,
+  "entry_id" int(10)  NOT NULL,
+  "team_id" int(10)  NOT NULL,
+  "removed_from_team" tinyint(1) NOT NULL DEFAULT false,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "entry_team_entry_id_foreign" FOREIGN KEY ("entry_id") REFERENCES "entries" ("id"),
+  CONSTRAINT "entry_team_team_id_foreign" FOREIGN KEY ("team_id") REFERENCES "teams" ("id")
+);
+INSERT INTO entry_team_down (id, entry_id, team_id, removed_from_team, created_at, updated_at)
+  SELECT id, entry_id, team_id, removed_from_team, created_at, updated_at FROM entry_team;
+DROP TABLE entry_team;
+ALTER TABLE entry_team_down RENAME TO entry_team;
+
+CREATE TABLE entries_down (
+  "id" INTEGER primary key,
+  "title" varchar(340) NOT NULL,
+  "body" longtext NOT NULL,
+  "body_rendered" longtext NOT NULL,
+  "type" varchar(255) NOT NULL,
+  "identifier_id" int(10)  NOT NULL,
+  "anchor" varchar(2000) NOT NULL,
+  "user_id" int(10)  NOT NULL,
+  "public" tinyint(1) NOT NULL DEFAULT false,
+  "removed_from_public" tinyint(1) NOT NULL DEFAULT false,
+  "score" int(11) NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "entries_identifier_id_foreign" FOREIGN KEY ("identifier_id") REFERENCES "identifiers" ("id"),
+  CONSTRAINT "entries_user_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+INSERT INTO entries_down (id, title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score, created_at, updated_at)
+  SELECT id, title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score, created_at, updated_at FROM entries;
+DROP TABLE entries;
+ALTER TABLE entries_down RENAME TO entries;
+
+CREATE INDEX "teams_name_unique" ON "teams" ("name");
+CREATE INDEX "entry_team_entry_id_foreign" ON "entry_team" ("entry_id");
+CREATE INDEX "entry_team_team_id_foreign" ON "entry_team" ("team_id");
+CREATE INDEX "entries_identifier_id_foreign" ON "entries" ("identifier_id");
+CREATE INDEX "entries_user_id_foreign" ON "entries" ("user_id");
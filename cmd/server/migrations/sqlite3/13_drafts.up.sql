@@ -0,0 +1,3 @@
+ALTER TABLE entries ADD COLUMN "draft" tinyint(1) NOT NULL DEFAULT false;
+ALTER TABLE entry_team ADD COLUMN "approved" tinyint(1) NOT NULL DEFAULT true;
+ALTER TABLE teams ADD COLUMN "requires_approval" tinyint(1) NOT NULL DEFAULT false;
@@ -0,0 +1,15 @@
+CREATE TABLE flags (
+  "id" INTEGER primary key,
+  "entry_id" int(10) NOT NULL,
+  "user_id" int(10) NOT NULL,
+  "reason" text NOT NULL,
+  "status" varchar(255) NOT NULL,
+  "resolution" varchar(255) DEFAULT NULL,
+  "resolved_by" int(10) DEFAULT NULL,
+  "resolved_at" timestamp DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "flags_user_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+
+CREATE INDEX "flags_entry_id_index" ON "flags" ("entry_id");
+CREATE INDEX "flags_status_index" ON "flags" ("status");
@@ -0,0 +1,16 @@
+CREATE TABLE moderation_actions (
+  "id" INTEGER primary key,
+  "actor_id" int(10) NOT NULL,
+  "action" varchar(255) NOT NULL,
+  "entry_id" int(10) NOT NULL,
+  "entry_title" varchar(255) NOT NULL,
+  "team_id" int(10) DEFAULT NULL,
+  "reason" text NOT NULL,
+  "before_state" varchar(255) NOT NULL,
+  "after_state" varchar(255) NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00'
+);
+
+CREATE INDEX "moderation_actions_actor_id_index" ON "moderation_actions" ("actor_id");
+CREATE INDEX "moderation_actions_team_id_index" ON "moderation_actions" ("team_id");
+CREATE INDEX "moderation_actions_created_at_index" ON "moderation_actions" ("created_at");
@@ -0,0 +1 @@
+DROP TABLE banned_docsets;
@@ -0,0 +1,8 @@
+CREATE TABLE banned_docsets (
+  "id" INTEGER primary key,
+  "pattern" varchar(340) NOT NULL,
+  "user_id" int(10) NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00'
+);
+
+CREATE UNIQUE INDEX "banned_docsets_pattern_unique" ON "banned_docsets" ("pattern");
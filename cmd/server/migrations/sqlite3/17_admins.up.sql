@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN "admin" tinyint(1) NOT NULL DEFAULT false;
+
+CREATE TABLE admin_actions (
+  "id" INTEGER primary key,
+  "actor_id" int(10) DEFAULT NULL,
+  "action" varchar(255) NOT NULL,
+  "source" varchar(255) NOT NULL,
+  "target_user_id" int(10) NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00'
+);
+
+CREATE INDEX "admin_actions_target_user_id_index" ON "admin_actions" ("target_user_id");
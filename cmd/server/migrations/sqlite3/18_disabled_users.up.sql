@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN "disabled" tinyint(1) NOT NULL DEFAULT false;
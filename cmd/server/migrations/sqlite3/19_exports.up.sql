@@ -0,0 +1,11 @@
+CREATE TABLE exports (
+  "id" INTEGER primary key,
+  "user_id" int(10) NOT NULL,
+  "status" varchar(255) NOT NULL,
+  "filename" varchar(255) DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "finished_at" timestamp DEFAULT NULL,
+  CONSTRAINT "exports_user_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+
+CREATE INDEX "exports_user_id_foreign" ON "exports" ("user_id");
@@ -0,0 +1,17 @@
+CREATE TABLE team_invitations (
+  "id" INTEGER primary key,
+  "team_id" int(10) NOT NULL,
+  "token" varchar(64) NOT NULL,
+  "created_by" int(10) NOT NULL,
+  "email" varchar(300) DEFAULT NULL,
+  "max_uses" int(10) NOT NULL,
+  "uses" int(10) NOT NULL DEFAULT 0,
+  "expires_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "revoked_at" timestamp DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "team_invitations_team_id_foreign" FOREIGN KEY ("team_id") REFERENCES "teams" ("id"),
+  CONSTRAINT "team_invitations_created_by_foreign" FOREIGN KEY ("created_by") REFERENCES "users" ("id")
+);
+
+CREATE UNIQUE INDEX "team_invitations_token_unique" ON "team_invitations" ("token");
+CREATE INDEX "team_invitations_team_id_foreign" ON "team_invitations" ("team_id");
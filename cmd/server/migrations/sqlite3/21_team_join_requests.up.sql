@@ -0,0 +1,15 @@
+ALTER TABLE teams ADD COLUMN "requires_join_approval" tinyint(1) NOT NULL DEFAULT false;
+
+CREATE TABLE team_join_requests (
+  "id" INTEGER primary key,
+  "team_id" int(10) NOT NULL,
+  "user_id" int(10) NOT NULL,
+  "status" varchar(255) NOT NULL,
+  "decided_by" int(10) DEFAULT NULL,
+  "decided_at" timestamp DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "team_join_requests_team_id_foreign" FOREIGN KEY ("team_id") REFERENCES "teams" ("id"),
+  CONSTRAINT "team_join_requests_user_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+
+CREATE INDEX "team_join_requests_team_id_foreign" ON "team_join_requests" ("team_id");
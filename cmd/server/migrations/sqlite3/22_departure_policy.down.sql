@@ -0,0 +1,34 @@
+-- sqlite cannot drop columns, so the affected tables are rebuilt without the departure columns
+CREATE TABLE teams_down (
+  "id" INTEGER primary key,
+  "name" varchar(191) NOT NULL,
+  "access_key" varchar(500) NOT NULL DEFAULT '',
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "requires_approval" tinyint(1) NOT NULL DEFAULT false,
+  "requires_join_approval" tinyint(1) NOT NULL DEFAULT false
+);
+INSERT INTO teams_down (id, name, access_key, created_at, updated_at, requires_approval, requires_join_approval)
+  SELECT id, name, access_key, created_at, updated_at, requires_approval, requires_join_approval FROM teams;
+DROP TABLE teams;
+ALTER TABLE teams_down RENAME TO teams;
+
+CREATE TABLE entry_team_down (
+  "id" INTEGER primary key,
+  "entry_id" int(10)  NOT NULL,
+  "team_id" int(10)  NOT NULL,
+  "removed_from_team" tinyint(1) NOT NULL DEFAULT false,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "approved" tinyint(1) NOT NULL DEFAULT true,
+  CONSTRAINT "entry_team_entry_id_foreign" FOREIGN KEY ("entry_id") REFERENCES "entries" ("id"),
+  CONSTRAINT "entry_team_team_id_foreign" FOREIGN KEY ("team_id") REFERENCES "teams" ("id")
+);
+INSERT INTO entry_team_down (id, entry_id, team_id, removed_from_team, created_at, updated_at, approved)
+  SELECT id, entry_id, team_id, removed_from_team, created_at, updated_at, approved FROM entry_team;
+DROP TABLE entry_team;
+ALTER TABLE entry_team_down RENAME TO entry_team;
+
+CREATE INDEX "teams_name_unique" ON "teams" ("name");
+CREATE INDEX "entry_team_entry_id_foreign" ON "entry_team" ("entry_id");
+CREATE INDEX "entry_team_team_id_foreign" ON "entry_team" ("team_id");
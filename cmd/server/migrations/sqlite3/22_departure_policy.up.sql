@@ -0,0 +1,2 @@
+ALTER TABLE teams ADD COLUMN "departure_policy" varchar(255) NOT NULL DEFAULT 'delete';
+ALTER TABLE entry_team ADD COLUMN "author_former_member" tinyint(1) NOT NULL DEFAULT false;
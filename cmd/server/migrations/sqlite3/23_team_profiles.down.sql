@@ -0,0 +1,17 @@
+-- sqlite cannot drop columns, so the teams table is rebuilt without the profile columns
+CREATE TABLE teams_down (
+  "id" INTEGER primary key,
+  "name" varchar(191) NOT NULL,
+  "access_key" varchar(500) NOT NULL DEFAULT '',
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "requires_approval" tinyint(1) NOT NULL DEFAULT false,
+  "requires_join_approval" tinyint(1) NOT NULL DEFAULT false,
+  "departure_policy" varchar(255) NOT NULL DEFAULT 'delete'
+);
+INSERT INTO teams_down (id, name, access_key, created_at, updated_at, requires_approval, requires_join_approval, departure_policy)
+  SELECT id, name, access_key, created_at, updated_at, requires_approval, requires_join_approval, departure_policy FROM teams;
+DROP TABLE teams;
+ALTER TABLE teams_down RENAME TO teams;
+
+CREATE INDEX "teams_name_unique" ON "teams" ("name");
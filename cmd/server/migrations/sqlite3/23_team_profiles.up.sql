@@ -0,0 +1,2 @@
+ALTER TABLE teams ADD COLUMN "description" varchar(1000) NOT NULL DEFAULT '';
+ALTER TABLE teams ADD COLUMN "avatar_url" varchar(2000) NOT NULL DEFAULT '';
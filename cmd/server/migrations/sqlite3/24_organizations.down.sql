@@ -0,0 +1,47 @@
+DROP TABLE organization_admins;
+DROP TABLE organizations;
+
+-- sqlite cannot drop columns, so the affected tables are rebuilt without the organization columns
+CREATE TABLE teams_down (
+  "id" INTEGER primary key,
+  "name" varchar(191) NOT NULL,
+  "access_key" varchar(500) NOT NULL DEFAULT '',
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "requires_approval" tinyint(1) NOT NULL DEFAULT false,
+  "requires_join_approval" tinyint(1) NOT NULL DEFAULT false,
+  "departure_policy" varchar(255) NOT NULL DEFAULT 'delete',
+  "description" varchar(1000) NOT NULL DEFAULT '',
+  "avatar_url" varchar(2000) NOT NULL DEFAULT ''
+);
+INSERT INTO teams_down (id, name, access_key, created_at, updated_at, requires_approval, requires_join_approval, departure_policy, description, avatar_url)
+  SELECT id, name, access_key, created_at, updated_at, requires_approval, requires_join_approval, departure_policy, description, avatar_url FROM teams;
+DROP TABLE teams;
+ALTER TABLE teams_down RENAME TO teams;
+
+CREATE TABLE entries_down (
+  "id" INTEGER primary key,
+  "title" varchar(340) NOT NULL,
+  "body" longtext NOT NULL,
+  "body_rendered" longtext NOT NULL,
+  "type" varchar(255) NOT NULL,
+  "identifier_id" int(10)  NOT NULL,
+  "anchor" varchar(2000) NOT NULL,
+  "user_id" int(10)  NOT NULL,
+  "public" tinyint(1) NOT NULL DEFAULT false,
+  "removed_from_public" tinyint(1) NOT NULL DEFAULT false,
+  "score" int(11) NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "draft" tinyint(1) NOT NULL DEFAULT false,
+  CONSTRAINT "entries_identifier_id_foreign" FOREIGN KEY ("identifier_id") REFERENCES "identifiers" ("id"),
+  CONSTRAINT "entries_user_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+INSERT INTO entries_down (id, title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score, created_at, updated_at, draft)
+  SELECT id, title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score, created_at, updated_at, draft FROM entries;
+DROP TABLE entries;
+ALTER TABLE entries_down RENAME TO entries;
+
+CREATE INDEX "teams_name_unique" ON "teams" ("name");
+CREATE INDEX "entries_identifier_id_foreign" ON "entries" ("identifier_id");
+CREATE INDEX "entries_user_id_foreign" ON "entries" ("user_id");
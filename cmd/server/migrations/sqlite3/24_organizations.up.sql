@@ -0,0 +1,24 @@
+CREATE TABLE organizations (
+  "id" INTEGER primary key,
+  "name" varchar(191) NOT NULL,
+  "default_access_key" varchar(500) NOT NULL DEFAULT '',
+  "default_visibility" varchar(255) NOT NULL DEFAULT 'team',
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00'
+);
+
+CREATE UNIQUE INDEX "organizations_name_unique" ON "organizations" ("name");
+
+CREATE TABLE organization_admins (
+  "id" INTEGER primary key,
+  "organization_id" int(10) NOT NULL,
+  "user_id" int(10) NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "organization_admins_organization_id_foreign" FOREIGN KEY ("organization_id") REFERENCES "organizations" ("id"),
+  CONSTRAINT "organization_admins_user_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+
+CREATE INDEX "organization_admins_organization_id_foreign" ON "organization_admins" ("organization_id");
+
+ALTER TABLE teams ADD COLUMN "organization_id" int(10) DEFAULT NULL;
+ALTER TABLE entries ADD COLUMN "organization_id" int(10) DEFAULT NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE team_roles (
+  "id" INTEGER primary key,
+  "team_id" int(10) NOT NULL,
+  "name" varchar(191) NOT NULL,
+  "capabilities" varchar(1000) NOT NULL DEFAULT '',
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "team_roles_team_id_foreign" FOREIGN KEY ("team_id") REFERENCES "teams" ("id")
+);
+
+CREATE UNIQUE INDEX "team_roles_team_id_name_unique" ON "team_roles" ("team_id", "name");
@@ -0,0 +1,19 @@
+-- sqlite cannot drop columns, so the events table is rebuilt without the target columns
+CREATE TABLE events_down (
+  "id" INTEGER primary key,
+  "kind" varchar(255) NOT NULL,
+  "actor_id" int(10)  NOT NULL,
+  "entry_id" int(10) DEFAULT NULL,
+  "identifier_id" int(10) DEFAULT NULL,
+  "team_id" int(10) DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00'
+);
+INSERT INTO events_down (id, kind, actor_id, entry_id, identifier_id, team_id, created_at)
+  SELECT id, kind, actor_id, entry_id, identifier_id, team_id, created_at FROM events;
+DROP TABLE events;
+ALTER TABLE events_down RENAME TO events;
+
+CREATE INDEX "events_entry_id_index" ON "events" ("entry_id");
+CREATE INDEX "events_identifier_id_index" ON "events" ("identifier_id");
+CREATE INDEX "events_team_id_index" ON "events" ("team_id");
+CREATE INDEX "events_created_at_index" ON "events" ("created_at");
@@ -0,0 +1,2 @@
+ALTER TABLE events ADD COLUMN "target_user_id" int(10) DEFAULT NULL;
+ALTER TABLE events ADD COLUMN "detail" varchar(255) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN "feed_token" varchar(64) DEFAULT NULL;
+CREATE INDEX "users_feed_token_index" ON "users" ("feed_token");
@@ -0,0 +1,9 @@
+CREATE TABLE team_docsets (
+  "id" INTEGER primary key,
+  "team_id" int(10) NOT NULL,
+  "pattern" varchar(191) NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  CONSTRAINT "team_docsets_team_id_foreign" FOREIGN KEY ("team_id") REFERENCES "teams" ("id")
+);
+
+CREATE UNIQUE INDEX "team_docsets_team_id_pattern_unique" ON "team_docsets" ("team_id", "pattern");
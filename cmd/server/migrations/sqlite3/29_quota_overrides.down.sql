@@ -0,0 +1 @@
+DROP TABLE quota_overrides;
@@ -0,0 +1,12 @@
+CREATE TABLE quota_overrides (
+  "id" INTEGER primary key,
+  "user_id" int(10) DEFAULT NULL,
+  "team_id" int(10) DEFAULT NULL,
+  "quota" varchar(64) NOT NULL,
+  "quota_limit" int(10) NOT NULL DEFAULT 0,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00'
+);
+
+CREATE INDEX "quota_overrides_user_id_index" ON "quota_overrides" ("user_id");
+CREATE INDEX "quota_overrides_team_id_index" ON "quota_overrides" ("team_id");
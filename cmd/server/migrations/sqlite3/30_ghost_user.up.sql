@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN "ghost" tinyint(1) NOT NULL DEFAULT false;
+UPDATE users SET "ghost" = true WHERE "username" = 'ghost' AND "password" = '' AND "disabled" = true;
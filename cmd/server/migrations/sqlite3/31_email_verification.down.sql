@@ -0,0 +1,24 @@
+-- sqlite cannot drop columns, so the users table is rebuilt without the email verification columns
+CREATE TABLE users_down (
+  "id" INTEGER primary key ,
+  "username" varchar(191) NOT NULL,
+  "email" varchar(300) DEFAULT NULL,
+  "password" varchar(500) NOT NULL,
+  "moderator" tinyint(1) NOT NULL DEFAULT false,
+  "remember_token" varchar(500) DEFAULT NULL,
+  "created_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "updated_at" timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
+  "notify_mentions" tinyint(1) NOT NULL DEFAULT true,
+  "notify_by_email" tinyint(1) NOT NULL DEFAULT false,
+  "admin" tinyint(1) NOT NULL DEFAULT false,
+  "disabled" tinyint(1) NOT NULL DEFAULT false,
+  "feed_token" varchar(64) DEFAULT NULL,
+  "ghost" tinyint(1) NOT NULL DEFAULT false
+);
+INSERT INTO users_down (id, username, email, password, moderator, remember_token, created_at, updated_at, notify_mentions, notify_by_email, admin, disabled, feed_token, ghost)
+  SELECT id, username, email, password, moderator, remember_token, created_at, updated_at, notify_mentions, notify_by_email, admin, disabled, feed_token, ghost FROM users;
+DROP TABLE users;
+ALTER TABLE users_down RENAME TO users;
+
+CREATE INDEX "users_username_unique" ON "users" ("username");
+CREATE INDEX "users_feed_token_index" ON "users" ("feed_token");
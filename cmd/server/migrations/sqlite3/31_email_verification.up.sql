@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN "email_verified" tinyint(1) NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN "email_verification_token" varchar(64) DEFAULT NULL;
@@ -0,0 +1,12 @@
+DROP INDEX "votes_entry_id_foreign";
+DROP INDEX "votes_user_id_foreign";
+DROP INDEX "password_reminders_email_index";
+DROP INDEX "password_reminders_token_index";
+DROP INDEX "users_username_unique";
+DROP INDEX "entries_identifier_id_foreign";
+DROP INDEX "entries_user_id_foreign";
+DROP INDEX "teams_name_unique";
+DROP INDEX "entry_team_entry_id_foreign";
+DROP INDEX "entry_team_team_id_foreign";
+DROP INDEX "team_user_team_id_foreign";
+DROP INDEX "team_user_user_id_foreign";
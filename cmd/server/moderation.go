@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrMissingReason is returned when an entry is flagged without giving a reason
+	ErrMissingReason = newAPIError(http.StatusUnprocessableEntity, "missing_reason", "Missing parameter: reason")
+	// ErrAlreadyFlagged is returned when the current user already has an open flag on the entry
+	ErrAlreadyFlagged = newAPIError(http.StatusConflict, "already_flagged", "You already flagged this entry")
+	// ErrFlagUnknown is returned when the flag_id cannot be matched to an open flag
+	ErrFlagUnknown = newAPIError(http.StatusNotFound, "flag_unknown", "Unknown flag")
+	// ErrInvalidResolution is returned when a flag should be resolved with an unknown action
+	ErrInvalidResolution = newAPIError(http.StatusUnprocessableEntity, "invalid_resolution", "Invalid parameter: action. Must either be dismiss, remove_from_public, remove_from_team or delete")
+	// ErrInvalidDate is returned when a date filter is not formatted as YYYY-MM-DD
+	ErrInvalidDate = newAPIError(http.StatusUnprocessableEntity, "invalid_date", "Invalid date. Must be formatted as YYYY-MM-DD")
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// visibilityState describes whether an entry was removed, for the moderation audit log
+func visibilityState(removed bool) string {
+	if removed {
+		return "removed"
+	}
+	return "visible"
+}
+
+// recordModerationAction adds the action to the moderation audit log
+func recordModerationAction(db execer, action dash.ModerationAction) error {
+	_, err := db.Exec(`INSERT INTO moderation_actions (actor_id, action, entry_id, entry_title, team_id, reason, before_state, after_state, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		action.ActorID, action.Action, action.EntryID, action.EntryTitle, nullableID(action.TeamID), action.Reason, action.Before, action.After, time.Now())
+	return err
+}
+
+type entryFlagRequest struct {
+	Reason string `json:"reason"`
+}
+
+// EntryFlag allows users to report an entry to the moderators
+func EntryFlag(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var entry = ctx.Value(EntryKey).(*dash.Entry)
+
+	var payload entryFlagRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if strings.TrimSpace(payload.Reason) == "" {
+		return ErrMissingReason
+	}
+	if !canSeeEntry(db, entry.ID, user.ID) {
+		return ErrEntryUnknown
+	}
+
+	var cnt = 0
+	db.QueryRow(`SELECT count(*) FROM flags WHERE entry_id = ? AND user_id = ? AND status = ?`, entry.ID, user.ID, dash.FlagOpen).Scan(&cnt)
+	if cnt != 0 {
+		return ErrAlreadyFlagged
+	}
+
+	if _, err := db.Exec(`INSERT INTO flags (entry_id, user_id, reason, status, created_at) VALUES (?, ?, ?, ?, ?)`, entry.ID, user.ID, payload.Reason, dash.FlagOpen, time.Now()); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// moderatedTeamIDs returns the ids of all teams in which the user may moderate entries
+func moderatedTeamIDs(user dash.User) []interface{} {
+	var teamIDs = make([]interface{}, 0)
+	for _, membership := range user.TeamMemberships {
+		if membership.Can(dash.CapabilityModerateEntries) {
+			teamIDs = append(teamIDs, membership.TeamID)
+		}
+	}
+	return teamIDs
+}
+
+type moderationQueueResponse struct {
+	Status string      `json:"status"`
+	Flags  []dash.Flag `json:"flags"`
+}
+
+// ModerationQueue lists all open flags the current user is able to resolve. Global moderators
+// see every flag, team moderators only flags of entries shared with their teams
+func ModerationQueue(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var query = `SELECT f.id, f.entry_id, e.title, u.username, f.reason, f.status, f.created_at
+		FROM flags f
+		INNER JOIN entries e ON e.id = f.entry_id
+		INNER JOIN users u ON u.id = f.user_id
+		WHERE f.status = ?`
+	var params = []interface{}{dash.FlagOpen}
+
+	if !user.Moderator {
+		var teamIDs = moderatedTeamIDs(*user)
+		if len(teamIDs) == 0 {
+			return ErrNotTeamModerator
+		}
+		query += fmt.Sprintf(` AND f.entry_id IN (SELECT entry_id FROM entry_team WHERE team_id IN (%s))`, strings.Join(strings.Split(strings.Repeat("?", len(teamIDs)), ""), ","))
+		params = append(params, teamIDs...)
+	}
+	query += ` ORDER BY f.id`
+
+	var rows, err = db.Query(query, params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var flags = make([]dash.Flag, 0)
+	for rows.Next() {
+		var flag = dash.Flag{}
+		var createdAt nullTime
+		if err := rows.Scan(&flag.ID, &flag.EntryID, &flag.EntryTitle, &flag.ReporterUsername, &flag.Reason, &flag.Status, &createdAt); err != nil {
+			return err
+		}
+		flag.CreatedAt = createdAt.Time
+		flags = append(flags, flag)
+	}
+
+	json.NewEncoder(w).Encode(moderationQueueResponse{
+		Status: "success",
+		Flags:  flags,
+	})
+	return nil
+}
+
+type moderationResolveRequest struct {
+	FlagID int    `json:"flag_id"`
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// resolveFlags marks the flag as resolved. Unless the flag is dismissed all other open flags of the entry
+// are resolved as well, since the moderator acted on the entry itself
+func resolveFlags(tx *sql.Tx, flagID, entryID int, action string, moderator dash.User) error {
+	var query = `UPDATE flags SET status = ?, resolution = ?, resolved_by = ?, resolved_at = ? WHERE status = ? AND `
+	var params = []interface{}{dash.FlagResolved, action, moderator.ID, time.Now(), dash.FlagOpen}
+	if action == dash.ResolutionDismiss {
+		query += `id = ?`
+		params = append(params, flagID)
+	} else {
+		query += `entry_id = ?`
+		params = append(params, entryID)
+	}
+	var _, err = tx.Exec(query, params...)
+	return err
+}
+
+// ModerationResolve allows moderators to decide on an open flag. The reason defaults to the reason of the flag
+func ModerationResolve(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var payload moderationResolveRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var entryID int
+	var flagReason string
+	if err := db.QueryRow(`SELECT entry_id, reason FROM flags WHERE id = ? AND status = ?`, payload.FlagID, dash.FlagOpen).Scan(&entryID, &flagReason); err != nil {
+		return ErrFlagUnknown
+	}
+	var entry, err = findEntryByID(db, entryID)
+	if err != nil {
+		return ErrEntryUnknown
+	}
+	if strings.TrimSpace(payload.Reason) == "" {
+		payload.Reason = flagReason
+	}
+
+	var teamIDs = entryTeamsWith(entry, *user, dash.CapabilityModerateEntries)
+	if !user.Moderator && len(teamIDs) == 0 {
+		return ErrFlagUnknown
+	}
+
+	switch payload.Action {
+	case dash.ResolutionDismiss:
+	case dash.ResolutionRemoveFromPublic, dash.ResolutionDelete:
+		if !user.Moderator {
+			return ErrNotModerator
+		}
+	case dash.ResolutionRemoveFromTeam:
+		if len(teamIDs) == 0 {
+			return ErrNotTeamModerator
+		}
+	default:
+		return ErrInvalidResolution
+	}
+
+	// the entry is changed in the same transaction resolving the flag, so neither happens without the other
+	var tx *sql.Tx
+	if tx, err = db.Begin(); err != nil {
+		return err
+	}
+	switch payload.Action {
+	case dash.ResolutionRemoveFromPublic:
+		err = setEntryRemovedFromPublic(tx, entry, true, *user, payload.Reason)
+	case dash.ResolutionRemoveFromTeam:
+		_, err = setEntryRemovedFromTeams(tx, entry, teamIDs, true, *user, payload.Reason)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := resolveFlags(tx, payload.FlagID, entry.ID, payload.Action, *user); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var action = dash.ModerationAction{ActorID: user.ID, EntryID: entry.ID, EntryTitle: entry.Title, Reason: payload.Reason}
+	switch payload.Action {
+	case dash.ResolutionDismiss:
+		action.Action, action.Before, action.After = dash.ModerationDismissFlag, dash.FlagOpen, dash.FlagResolved
+	case dash.ResolutionDelete:
+		action.Action, action.Before, action.After = dash.ModerationDelete, visibilityState(entry.RemovedFromPublic), "deleted"
+		if err := deleteEntries(tx, []interface{}{entry.ID}); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if action.Action != "" {
+		if err := recordModerationAction(tx, action); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type moderationLogRequest struct {
+	Moderator string `json:"moderator"`
+	Team      string `json:"team"`
+	Since     string `json:"since"`
+	Until     string `json:"until"`
+}
+
+type moderationLogResponse struct {
+	Status  string                  `json:"status"`
+	Actions []dash.ModerationAction `json:"actions"`
+}
+
+// ModerationLog lists recorded moderation actions, newest first. Results can be filtered by moderator username,
+// team name and an inclusive date range
+func ModerationLog(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Moderator {
+		return ErrNotModerator
+	}
+
+	var payload moderationLogRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var query = `SELECT ma.id, ma.action, ma.actor_id, u.username, ma.entry_id, ma.entry_title, ma.team_id, t.name, ma.reason, ma.before_state, ma.after_state, ma.created_at
+		FROM moderation_actions ma
+		INNER JOIN users u ON u.id = ma.actor_id
+		LEFT JOIN teams t ON t.id = ma.team_id
+		WHERE 1 = 1`
+	var params = make([]interface{}, 0)
+	if payload.Moderator != "" {
+		query += ` AND u.username = ?`
+		params = append(params, payload.Moderator)
+	}
+	if payload.Team != "" {
+		query += ` AND t.name = ?`
+		params = append(params, payload.Team)
+	}
+	if payload.Since != "" {
+		var since, err = time.ParseInLocation("2006-01-02", payload.Since, time.Local)
+		if err != nil {
+			return ErrInvalidDate
+		}
+		query += ` AND ma.created_at >= ?`
+		params = append(params, since)
+	}
+	if payload.Until != "" {
+		var until, err = time.ParseInLocation("2006-01-02", payload.Until, time.Local)
+		if err != nil {
+			return ErrInvalidDate
+		}
+		query += ` AND ma.created_at < ?`
+		params = append(params, until.AddDate(0, 0, 1))
+	}
+	query += ` ORDER BY ma.id DESC`
+
+	var rows, err = db.Query(query, params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var actions = make([]dash.ModerationAction, 0)
+	for rows.Next() {
+		var action dash.ModerationAction
+		var teamID sql.NullInt64
+		var teamName sql.NullString
+		var createdAt nullTime
+		if err := rows.Scan(&action.ID, &action.Action, &action.ActorID, &action.ModeratorUsername, &action.EntryID, &action.EntryTitle, &teamID, &teamName, &action.Reason, &action.Before, &action.After, &createdAt); err != nil {
+			return err
+		}
+		action.TeamID = int(teamID.Int64)
+		action.TeamName = teamName.String
+		action.CreatedAt = createdAt.Time
+		actions = append(actions, action)
+	}
+
+	json.NewEncoder(w).Encode(moderationLogResponse{
+		Status:  "success",
+		Actions: actions,
+	})
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestModerationResolve_RemoveFromPublic(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "flag-author", "b")
+	var reporterID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "flag-reporter", "b")
+	var moderatorID = exec(`INSERT INTO users (username, password, moderator) VALUES (?, ?, ?)`, "flag-moderator", "b", true)
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Flags", "Flags", "c", "d", "e", "f", "g", "h", false)
+	var entryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "spam", "b", "b", "comment", identifierID, "c", authorID, true, false, 0)
+
+	var reporter = dash.User{ID: reporterID, Username: "flag-reporter"}
+	var moderator = dash.User{ID: moderatorID, Username: "flag-moderator", Moderator: true}
+
+	var ctx = context.WithValue(rootCtx, UserKey, &reporter)
+	var flag = func() error {
+		req, _ := http.NewRequest("POST", "/entries/flag", strings.NewReader(fmt.Sprintf(`{"entry_id":%d,"reason":"spam"}`, entryID)))
+		return WithEntry(ContextHandlerFunc(EntryFlag)).ServeHTTPContext(ctx, httptest.NewRecorder(), req)
+	}
+	if err := flag(); err != nil {
+		t.Fatalf("EntryFlag errored with: %#v", err)
+	}
+	if err := flag(); err != ErrAlreadyFlagged {
+		t.Fatalf("Expected flagging twice to return %q, got %q", ErrAlreadyFlagged, err)
+	}
+
+	if err := ModerationQueue(ctx, httptest.NewRecorder(), &http.Request{}); err != ErrNotTeamModerator {
+		t.Fatalf("Expected regular users not to see the queue, got %q", err)
+	}
+
+	ctx = context.WithValue(rootCtx, UserKey, &moderator)
+	var w = httptest.NewRecorder()
+	if err := ModerationQueue(ctx, w, &http.Request{}); err != nil {
+		t.Fatalf("ModerationQueue errored with: %#v", err)
+	}
+	var queue moderationQueueResponse
+	json.NewDecoder(w.Body).Decode(&queue)
+	if len(queue.Flags) != 1 || queue.Flags[0].EntryID != entryID || queue.Flags[0].ReporterUsername != "flag-reporter" {
+		t.Fatalf("Expected the flag to be queued, got %#v", queue.Flags)
+	}
+
+	req, _ := http.NewRequest("POST", "/moderation/resolve", strings.NewReader(fmt.Sprintf(`{"flag_id":%d,"action":"remove_from_public"}`, queue.Flags[0].ID)))
+	if err := ModerationResolve(ctx, httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("ModerationResolve errored with: %#v", err)
+	}
+
+	var entry, _ = findEntryByID(db, entryID)
+	if !entry.RemovedFromPublic {
+		t.Errorf("Expected the entry to be removed from public")
+	}
+	var status, resolution string
+	var resolvedBy int
+	db.QueryRow(`SELECT status, resolution, resolved_by FROM flags WHERE id = ?`, queue.Flags[0].ID).Scan(&status, &resolution, &resolvedBy)
+	if status != dash.FlagResolved || resolution != dash.ResolutionRemoveFromPublic || resolvedBy != moderatorID {
+		t.Errorf("Expected the decision to be recorded, got %q %q %d", status, resolution, resolvedBy)
+	}
+}
+
+func TestEntryRestoreToTeams_AuditLog(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "audit-author", "b")
+	var teamModeratorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "audit-team-moderator", "b")
+	var moderatorID = exec(`INSERT INTO users (username, password, moderator) VALUES (?, ?, ?)`, "audit-moderator", "b", true)
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "audit-team")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, authorID, "owner")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, teamModeratorID, "moderator")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Audit", "Audit", "c", "d", "e", "f", "g", "h", false)
+	var entryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "audited", "b", "b", "comment", identifierID, "c", authorID, false, false, 0)
+	exec(`INSERT INTO entry_team (entry_id, team_id) VALUES (?, ?)`, entryID, teamID)
+
+	var teamModerator = dash.User{ID: teamModeratorID, Username: "audit-team-moderator", TeamMemberships: []dash.TeamMember{{TeamID: teamID, TeamName: "audit-team", Role: "moderator"}}}
+	var moderator = dash.User{ID: moderatorID, Username: "audit-moderator", Moderator: true}
+
+	var ctx = context.WithValue(rootCtx, UserKey, &teamModerator)
+	var call = func(handler ContextHandlerFunc) error {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(fmt.Sprintf(`{"entry_id":%d,"reason":"off topic"}`, entryID)))
+		return WithEntry(handler).ServeHTTPContext(ctx, httptest.NewRecorder(), req)
+	}
+	if err := call(EntryRestoreToTeams); err != ErrNothingToRestore {
+		t.Fatalf("Expected restoring a visible entry to return %q, got %q", ErrNothingToRestore, err)
+	}
+	if err := call(EntryRemoveFromTeams); err != nil {
+		t.Fatalf("EntryRemoveFromTeams errored with: %#v", err)
+	}
+	if err := call(EntryRestoreToTeams); err != nil {
+		t.Fatalf("EntryRestoreToTeams errored with: %#v", err)
+	}
+
+	var removed bool
+	db.QueryRow(`SELECT removed_from_team FROM entry_team WHERE entry_id = ? AND team_id = ?`, entryID, teamID).Scan(&removed)
+	if removed {
+		t.Errorf("Expected the entry to be restored to the team")
+	}
+
+	ctx = context.WithValue(rootCtx, UserKey, &moderator)
+	var today = time.Now().Format("2006-01-02")
+	req, _ := http.NewRequest("POST", "/moderation/log", strings.NewReader(fmt.Sprintf(`{"moderator":"audit-team-moderator","team":"audit-team","since":%q,"until":%q}`, today, today)))
+	var w = httptest.NewRecorder()
+	if err := ModerationLog(ctx, w, req); err != nil {
+		t.Fatalf("ModerationLog errored with: %#v", err)
+	}
+	var log moderationLogResponse
+	json.NewDecoder(w.Body).Decode(&log)
+	if len(log.Actions) != 2 {
+		t.Fatalf("Expected two recorded actions, got %#v", log.Actions)
+	}
+	var restore = log.Actions[0]
+	if restore.Action != dash.ModerationRestoreToTeam || restore.Reason != "off topic" || restore.Before != "removed" || restore.After != "visible" || restore.TeamName != "audit-team" {
+		t.Errorf("Expected the restore to be recorded, got %#v", restore)
+	}
+
+	req, _ = http.NewRequest("POST", "/moderation/log", strings.NewReader(`{"since":"yesterday"}`))
+	if err := ModerationLog(ctx, httptest.NewRecorder(), req); err != ErrInvalidDate {
+		t.Errorf("Expected invalid dates to return %q, got %q", ErrInvalidDate, err)
+	}
+}
+
+func TestEntryRemoveFromPublic_RecordsChangesOnly(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "remove-public-author", "b")
+	var moderatorID = exec(`INSERT INTO users (username, password, moderator) VALUES (?, ?, ?)`, "remove-public-moderator", "b", true)
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "RemovePublic", "RemovePublic", "c", "d", "e", "f", "g", "h", false)
+	var entryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "removed twice", "b", "b", "comment", identifierID, "c", authorID, true, false, 0)
+
+	var moderator = dash.User{ID: moderatorID, Username: "remove-public-moderator", Moderator: true}
+	var ctx = context.WithValue(rootCtx, UserKey, &moderator)
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(fmt.Sprintf(`{"entry_id":%d,"reason":"spam"}`, entryID)))
+		if err := WithEntry(ContextHandlerFunc(EntryRemoveFromPublic)).ServeHTTPContext(ctx, httptest.NewRecorder(), req); err != nil {
+			t.Fatalf("EntryRemoveFromPublic errored with: %#v", err)
+		}
+	}
+
+	var actions int
+	db.QueryRow(`SELECT count(*) FROM moderation_actions WHERE entry_id = ?`, entryID).Scan(&actions)
+	if actions != 1 {
+		t.Errorf("Expected removing an already removed entry not to be recorded, got %d actions", actions)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrMissingNotificationIDs is returned when notifications should be marked as read without specifying which
+	ErrMissingNotificationIDs = newAPIError(http.StatusUnprocessableEntity, "missing_notification_ids", "Missing parameter: ids")
+)
+
+// mentionPattern matches @username mentions which are not part of an email address
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([\w.-]*\w)`)
+
+// parseMentions returns all distinct usernames mentioned inside body
+func parseMentions(body string) []string {
+	var seen = map[string]bool{}
+	var usernames = make([]string, 0)
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		if seen[match[1]] {
+			continue
+		}
+		seen[match[1]] = true
+		usernames = append(usernames, match[1])
+	}
+	return usernames
+}
+
+// notifyMentions creates a notification for every user mentioned inside the entry body who is able
+// to see the entry. Users are only notified once per entry, and never about their own entries
+func notifyMentions(db *sql.DB, mailer Mailer, entry dash.Entry, author dash.User) error {
+	for _, username := range parseMentions(entry.Body) {
+		var target, err = findUserByUsername(db, username)
+		if err != nil || target.ID == author.ID || !target.NotifyMentions {
+			continue
+		}
+		if !canSeeEntry(db, entry.ID, target.ID) {
+			continue
+		}
+
+		var cnt = 0
+		db.QueryRow(`SELECT count(*) FROM notifications WHERE user_id = ? AND entry_id = ? AND kind = ?`, target.ID, entry.ID, dash.NotificationMention).Scan(&cnt)
+		if cnt != 0 {
+			continue
+		}
+
+		if _, err := db.Exec(`INSERT INTO notifications (user_id, actor_id, entry_id, kind, created_at) VALUES (?, ?, ?, ?, ?)`, target.ID, author.ID, entry.ID, dash.NotificationMention, time.Now()); err != nil {
+			return err
+		}
+
+		if target.NotifyByEmail && target.Email.String != "" {
+			var subject = fmt.Sprintf("%s mentioned you in %q", author.Username, entry.Title)
+			var body = fmt.Sprintf("%s mentioned you in the annotation %q:\n\n%s\n", author.Username, entry.Title, entry.Body)
+			if err := mailer.SendMail(target.Email.String, subject, body); err != nil {
+				log.Printf("failed to deliver mention notification to %q: %v\n", target.Username, err)
+			}
+		}
+	}
+	return nil
+}
+
+type userNotificationsRequest struct {
+	UnreadOnly bool `json:"unread_only"`
+}
+
+type userNotificationsResponse struct {
+	Status        string              `json:"status"`
+	Notifications []dash.Notification `json:"notifications"`
+}
+
+// UserNotifications lists the notifications of the current user, newest first
+func UserNotifications(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var payload userNotificationsRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var query = `SELECT n.id, n.kind, n.entry_id, e.title, u.username, n.read_at, n.created_at
+		FROM notifications n
+		INNER JOIN entries e ON e.id = n.entry_id
+		INNER JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = ?`
+	if payload.UnreadOnly {
+		query += ` AND n.read_at IS NULL`
+	}
+	query += ` ORDER BY n.id DESC`
+
+	var rows, err = db.Query(query, user.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var notifications = make([]dash.Notification, 0)
+	for rows.Next() {
+		var notification = dash.Notification{UserID: user.ID}
+		var readAt, createdAt nullTime
+		if err := rows.Scan(&notification.ID, &notification.Kind, &notification.EntryID, &notification.EntryTitle, &notification.ActorUsername, &readAt, &createdAt); err != nil {
+			return err
+		}
+		notification.Read = readAt.Valid
+		notification.CreatedAt = createdAt.Time
+		notifications = append(notifications, notification)
+	}
+
+	json.NewEncoder(w).Encode(userNotificationsResponse{
+		Status:        "success",
+		Notifications: notifications,
+	})
+	return nil
+}
+
+type userNotificationsReadRequest struct {
+	IDs []int `json:"ids"`
+	All bool  `json:"all"`
+}
+
+// UserNotificationsRead marks the requested notifications of the current user as read
+func UserNotificationsRead(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var payload userNotificationsReadRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var query = `UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`
+	var params = []interface{}{time.Now(), user.ID}
+	if !payload.All {
+		if len(payload.IDs) == 0 {
+			return ErrMissingNotificationIDs
+		}
+		query += fmt.Sprintf(` AND id IN (%s)`, strings.Join(strings.Split(strings.Repeat("?", len(payload.IDs)), ""), ","))
+		for _, id := range payload.IDs {
+			params = append(params, id)
+		}
+	}
+
+	if _, err := db.Exec(query, params...); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type userPreferencesRequest struct {
+	NotifyMentions *bool `json:"notify_mentions"`
+	NotifyByEmail  *bool `json:"notify_by_email"`
+}
+
+type userPreferencesResponse struct {
+	Status         string `json:"status"`
+	NotifyMentions bool   `json:"notify_mentions"`
+	NotifyByEmail  bool   `json:"notify_by_email"`
+}
+
+// UserPreferences updates the notification preferences of the current user. Omitted preferences
+// are left unchanged, so an empty request returns the current preferences
+func UserPreferences(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var payload userPreferencesRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.NotifyMentions != nil {
+		user.NotifyMentions = *payload.NotifyMentions
+	}
+	if payload.NotifyByEmail != nil {
+		user.NotifyByEmail = *payload.NotifyByEmail
+	}
+
+	if _, err := db.Exec(`UPDATE users SET notify_mentions = ?, notify_by_email = ?, updated_at = ? WHERE id = ?`, user.NotifyMentions, user.NotifyByEmail, time.Now(), user.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(userPreferencesResponse{
+		Status:         "success",
+		NotifyMentions: user.NotifyMentions,
+		NotifyByEmail:  user.NotifyByEmail,
+	})
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+type mockMailer struct {
+	recipients []string
+	bodies     []string
+}
+
+func (m *mockMailer) SendMail(to, subject, body string) error {
+	m.recipients = append(m.recipients, to)
+	m.bodies = append(m.bodies, body)
+	return nil
+}
+
+func TestParseMentions(t *testing.T) {
+	t.Parallel()
+
+	var mentions = parseMentions("@alice please check with @bob.smith and @alice. mail me at carol@example.com")
+	if !reflect.DeepEqual(mentions, []string{"alice", "bob.smith"}) {
+		t.Fatalf("Expected mentions of alice and bob.smith, got %#v", mentions)
+	}
+}
+
+func TestNotifyMentions_Visibility(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "mention-author", "b")
+	var teammateID = exec(`INSERT INTO users (username, password, email, notify_by_email) VALUES (?, ?, ?, ?)`, "mention-teammate", "b", "teammate@example.com", true)
+	var outsiderID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "mention-outsider", "b")
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "mention-team")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, authorID, "owner")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, teammateID, "member")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "a", "b", "c", "d", "e", "f", "g", "h", false)
+	var entryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "a", "b", "b", "comment", identifierID, "c", authorID, false, false, 1)
+	exec(`INSERT INTO entry_team (entry_id, team_id) VALUES (?, ?)`, entryID, teamID)
+
+	var mailer = &mockMailer{}
+	var entry = dash.Entry{ID: entryID, Title: "a", Body: "@mention-teammate @mention-outsider @mention-author"}
+	var author = dash.User{ID: authorID, Username: "mention-author"}
+	if err := notifyMentions(db, mailer, entry, author); err != nil {
+		t.Fatalf("Expected notifyMentions not to return an error, got %q", err)
+	}
+	if err := notifyMentions(db, mailer, entry, author); err != nil {
+		t.Fatalf("Expected notifyMentions not to return an error, got %q", err)
+	}
+
+	for _, tc := range []struct {
+		userID   int
+		expected int
+	}{
+		{teammateID, 1},
+		{outsiderID, 0},
+		{authorID, 0},
+	} {
+		var cnt = 0
+		db.QueryRow(`SELECT count(*) FROM notifications WHERE user_id = ? AND entry_id = ?`, tc.userID, entryID).Scan(&cnt)
+		if cnt != tc.expected {
+			t.Errorf("Expected user %d to have %d notifications, got %d", tc.userID, tc.expected, cnt)
+		}
+	}
+
+	if !reflect.DeepEqual(mailer.recipients, []string{"teammate@example.com"}) {
+		t.Errorf("Expected a single mail to the teammate, got %#v", mailer.recipients)
+	}
+
+	var readAt nullTime
+	db.QueryRow(`SELECT read_at FROM notifications WHERE user_id = ?`, teammateID).Scan(&readAt)
+	if readAt.Valid {
+		t.Errorf("Expected new notifications to be unread")
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrMissingOrganizationName is returned when an organization should be created or used without a name
+	ErrMissingOrganizationName = newAPIError(http.StatusUnprocessableEntity, "missing_organization_name", "Missing parameter: name")
+	// ErrOrganizationNameExists is returned when an organization should be created, and the name is already taken
+	ErrOrganizationNameExists = newAPIError(http.StatusConflict, "organization_name_exists", "An organization with this name already exists")
+	// ErrNotOrganizationAdmin is returned when an action requires you to be an admin of the organization
+	ErrNotOrganizationAdmin = newAPIError(http.StatusForbidden, "not_organization_admin", "You need to be an admin of the organization")
+	// ErrNotOrganizationMember is returned when an action requires you to be a member of the organization
+	ErrNotOrganizationMember = newAPIError(http.StatusForbidden, "not_organization_member", "You need to be a member of the organization")
+	// ErrLastOrganizationAdmin is returned when the last admin of an organization should lose the admin status
+	ErrLastOrganizationAdmin = newAPIError(http.StatusConflict, "last_organization_admin", "An organization needs at least one admin")
+	// ErrInvalidVisibility is returned when an organization should use an unknown visibility policy
+	ErrInvalidVisibility = newAPIError(http.StatusUnprocessableEntity, "invalid_visibility", "Invalid parameter: default_visibility. Must either be team or organization")
+	// ErrTeamInOtherOrganization is returned when a team should be added to an organization while belonging to another one
+	ErrTeamInOtherOrganization = newAPIError(http.StatusConflict, "team_in_other_organization", "The team already belongs to another organization")
+)
+
+// isOrganizationAdminOf reports whether the user is admin of the organization
+func isOrganizationAdminOf(user dash.User, organizationID int) bool {
+	for _, membership := range user.Organizations {
+		if membership.OrganizationID == organizationID && membership.Admin {
+			return true
+		}
+	}
+	return false
+}
+
+// isOrganizationMemberOf reports whether the user is admin of the organization or a member of one of its teams
+func isOrganizationMemberOf(user dash.User, organizationID int) bool {
+	for _, membership := range user.Organizations {
+		if membership.OrganizationID == organizationID {
+			return true
+		}
+	}
+	return false
+}
+
+// entryOrganization resolves the organization an entry is explicitly shared with. Sharing with an
+// organization requires membership, unless the entry already is shared with it
+func entryOrganization(db *sql.DB, user dash.User, name string, current string) (int, string, error) {
+	if name == "" {
+		return 0, "", nil
+	}
+	var organization, err = findOrganizationByName(db, name)
+	if err != nil {
+		return 0, "", ErrOrganizationUnknown
+	}
+	if name != current && !isOrganizationMemberOf(user, organization.ID) {
+		return 0, "", ErrNotOrganizationMember
+	}
+	return organization.ID, organization.Name, nil
+}
+
+// organizationVisibility returns the condition matching entries visible to the organizations: entries
+// explicitly shared with one of them, and entries approved in a team of one of them using the organization
+// visibility policy. Pending entries and entries removed from the team stay hidden
+func organizationVisibility(memberships []dash.OrganizationMembership) (string, []interface{}) {
+	var placeholders = strings.Join(strings.Split(strings.Repeat("?", len(memberships)), ""), ",")
+	var ids = make([]interface{}, 0, len(memberships))
+	for _, membership := range memberships {
+		ids = append(ids, membership.OrganizationID)
+	}
+
+	var params = append([]interface{}{}, ids...)
+	params = append(params, true, false, dash.VisibilityOrganization)
+	params = append(params, ids...)
+	return fmt.Sprintf(`(COALESCE(e.organization_id, 0) IN (%s) OR e.id IN (SELECT et.entry_id
+		FROM entry_team AS et
+		INNER JOIN teams AS t ON t.id = et.team_id
+		INNER JOIN organizations AS o ON o.id = t.organization_id
+		WHERE et.approved = ?
+			AND et.removed_from_team = ?
+			AND o.default_visibility = ?
+			AND o.id IN (%s)))`, placeholders, placeholders), params
+}
+
+type organizationCreateRequest struct {
+	Name string `json:"name"`
+}
+
+// OrganizationCreate creates a new organization with the current user as admin
+func OrganizationCreate(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var payload organizationCreateRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var name = strings.TrimSpace(payload.Name)
+	if name == "" {
+		return ErrMissingOrganizationName
+	}
+
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var cnt = 0
+	tx.QueryRow(`SELECT count(*) FROM organizations WHERE name = ?`, name).Scan(&cnt)
+	if cnt != 0 {
+		tx.Rollback()
+		return ErrOrganizationNameExists
+	}
+
+	var res sql.Result
+	if res, err = tx.Exec(`INSERT INTO organizations (name, default_access_key, default_visibility, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, name, "", dash.VisibilityTeam, time.Now(), time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var organizationID, _ = res.LastInsertId()
+	if _, err := tx.Exec(`INSERT INTO organization_admins (organization_id, user_id, created_at) VALUES (?, ?, ?)`, organizationID, user.ID, time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type organizationSetAdminRequest struct {
+	Username string `json:"username"`
+	Admin    bool   `json:"admin"`
+}
+
+// OrganizationSetAdmin allows organization admins to grant or revoke the admin status of a user
+func OrganizationSetAdmin(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var organization = ctx.Value(OrganizationKey).(*dash.Organization)
+
+	if !isOrganizationAdminOf(*user, organization.ID) {
+		return ErrNotOrganizationAdmin
+	}
+
+	var payload organizationSetAdminRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.Username == "" {
+		return ErrMissingUsernameParameter
+	}
+	var target, err = findUserByUsername(db, payload.Username)
+	if err != nil {
+		return ErrUnknownUser
+	}
+
+	if payload.Admin {
+		if !isOrganizationAdminOf(target, organization.ID) {
+			if _, err := db.Exec(`INSERT INTO organization_admins (organization_id, user_id, created_at) VALUES (?, ?, ?)`, organization.ID, target.ID, time.Now()); err != nil {
+				return err
+			}
+		}
+	} else {
+		var admins = 0
+		db.QueryRow(`SELECT count(*) FROM organization_admins WHERE organization_id = ? AND user_id != ?`, organization.ID, target.ID).Scan(&admins)
+		if admins == 0 {
+			return ErrLastOrganizationAdmin
+		}
+		if _, err := db.Exec(`DELETE FROM organization_admins WHERE organization_id = ? AND user_id = ?`, organization.ID, target.ID); err != nil {
+			return err
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type organizationSetDefaultsRequest struct {
+	DefaultAccessKey  string `json:"default_access_key"`
+	DefaultVisibility string `json:"default_visibility"`
+}
+
+// OrganizationSetDefaults allows organization admins to change the access key of new teams and the visibility
+// of entries shared with the teams of the organization
+func OrganizationSetDefaults(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var organization = ctx.Value(OrganizationKey).(*dash.Organization)
+
+	if !isOrganizationAdminOf(*user, organization.ID) {
+		return ErrNotOrganizationAdmin
+	}
+
+	var payload organizationSetDefaultsRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.DefaultVisibility == "" {
+		payload.DefaultVisibility = dash.VisibilityTeam
+	}
+	if payload.DefaultVisibility != dash.VisibilityTeam && payload.DefaultVisibility != dash.VisibilityOrganization {
+		return ErrInvalidVisibility
+	}
+
+	// the default access key is hashed just like team access keys, and copied to new teams as is
+	var defaults = dash.Team{}
+	defaults.ChangeAccessKey(payload.DefaultAccessKey)
+
+	if _, err := db.Exec(`UPDATE organizations SET default_access_key = ?, default_visibility = ?, updated_at = ? WHERE id = ?`, defaults.EncryptedAccessKey, payload.DefaultVisibility, time.Now(), organization.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type organizationAddTeamRequest struct {
+	Team string `json:"team"`
+}
+
+// OrganizationAddTeam allows organization admins to move a team they own into the organization
+func OrganizationAddTeam(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var organization = ctx.Value(OrganizationKey).(*dash.Organization)
+
+	if !isOrganizationAdminOf(*user, organization.ID) {
+		return ErrNotOrganizationAdmin
+	}
+
+	var payload organizationAddTeamRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.Team == "" {
+		return ErrMissingTeamName
+	}
+	var team, err = findTeamByName(db, payload.Team)
+	if err != nil {
+		return ErrTeamUnknown
+	}
+	if team.OrganizationID != 0 && team.OrganizationID != organization.ID {
+		return ErrTeamInOtherOrganization
+	}
+	if team.OwnerID != user.ID {
+		return ErrNotTeamOwner
+	}
+
+	if _, err := db.Exec(`UPDATE teams SET organization_id = ?, updated_at = ? WHERE id = ?`, organization.ID, time.Now(), team.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type organizationListMembersResponse struct {
+	Status  string                    `json:"status"`
+	Teams   []string                  `json:"teams"`
+	Members []dash.OrganizationMember `json:"members"`
+}
+
+// OrganizationListMembers returns the teams and the member directory of an organization to its members
+func OrganizationListMembers(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var organization = ctx.Value(OrganizationKey).(*dash.Organization)
+
+	if !isOrganizationMemberOf(*user, organization.ID) {
+		return ErrNotOrganizationMember
+	}
+
+	var teams = make([]string, 0)
+	var members = map[string]*dash.OrganizationMember{}
+	var member = func(username string) *dash.OrganizationMember {
+		if members[username] == nil {
+			members[username] = &dash.OrganizationMember{Username: username, Teams: make([]string, 0)}
+		}
+		return members[username]
+	}
+
+	var rows, err = db.Query(`SELECT name FROM teams WHERE organization_id = ? ORDER BY name`, organization.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		teams = append(teams, name)
+	}
+
+	var memberRows *sql.Rows
+	if memberRows, err = db.Query(`SELECT u.username, t.name
+		FROM team_user AS tm
+		INNER JOIN teams AS t ON t.id = tm.team_id
+		INNER JOIN users AS u ON u.id = tm.user_id
+		WHERE t.organization_id = ?
+		ORDER BY t.name`, organization.ID); err != nil {
+		return err
+	}
+	defer memberRows.Close()
+	for memberRows.Next() {
+		var username, team string
+		if err := memberRows.Scan(&username, &team); err != nil {
+			return err
+		}
+		member(username).Teams = append(member(username).Teams, team)
+	}
+
+	var adminRows *sql.Rows
+	if adminRows, err = db.Query(`SELECT u.username FROM organization_admins AS oa INNER JOIN users AS u ON u.id = oa.user_id WHERE oa.organization_id = ?`, organization.ID); err != nil {
+		return err
+	}
+	defer adminRows.Close()
+	for adminRows.Next() {
+		var username string
+		if err := adminRows.Scan(&username); err != nil {
+			return err
+		}
+		member(username).Admin = true
+	}
+
+	var directory = make([]dash.OrganizationMember, 0, len(members))
+	for _, member := range members {
+		directory = append(directory, *member)
+	}
+	sort.Slice(directory, func(i, j int) bool {
+		return directory[i].Username < directory[j].Username
+	})
+
+	json.NewEncoder(w).Encode(organizationListMembersResponse{
+		Status:  "success",
+		Teams:   teams,
+		Members: directory,
+	})
+	return nil
+}
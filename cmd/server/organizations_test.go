@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestOrganizations(t *testing.T) {
+	var adminID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "org-admin", "b")
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "org-author", "b")
+	var memberID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "org-member", "b")
+	var outsiderID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "org-outsider", "b")
+
+	if _, err := call(adminID, ContextHandlerFunc(OrganizationCreate), `{"name":"org"}`); err != nil {
+		t.Fatalf("OrganizationCreate errored with: %#v", err)
+	}
+	if _, err := call(outsiderID, WithOrganization(ContextHandlerFunc(OrganizationSetDefaults)), `{"name":"org","default_visibility":"organization"}`); err != ErrNotOrganizationAdmin {
+		t.Fatalf("Expected non admins to return %q, got %q", ErrNotOrganizationAdmin, err)
+	}
+	if _, err := call(adminID, WithOrganization(ContextHandlerFunc(OrganizationSetDefaults)), `{"name":"org","default_visibility":"everyone"}`); err != ErrInvalidVisibility {
+		t.Fatalf("Expected unknown visibilities to return %q, got %q", ErrInvalidVisibility, err)
+	}
+	if _, err := call(adminID, WithOrganization(ContextHandlerFunc(OrganizationSetDefaults)), `{"name":"org","default_access_key":"secret","default_visibility":"organization"}`); err != nil {
+		t.Fatalf("OrganizationSetDefaults errored with: %#v", err)
+	}
+	if _, err := call(adminID, WithOrganization(ContextHandlerFunc(OrganizationSetAdmin)), `{"name":"org","username":"org-admin","admin":false}`); err != ErrLastOrganizationAdmin {
+		t.Fatalf("Expected the last admin to stay with %q, got %q", ErrLastOrganizationAdmin, err)
+	}
+
+	for _, name := range []string{"org-team-a", "org-team-b"} {
+		if _, err := call(adminID, ContextHandlerFunc(TeamCreate), `{"name":"`+name+`","organization":"org"}`); err != nil {
+			t.Fatalf("TeamCreate errored with: %#v", err)
+		}
+	}
+	var teamA, _ = findTeamByName(db, "org-team-a")
+	var teamB, _ = findTeamByName(db, "org-team-b")
+	if !teamA.AccessKeysMatch("secret") {
+		t.Errorf("Expected new teams to use the default access key of the organization")
+	}
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamA.ID, memberID, "member")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamB.ID, authorID, "member")
+
+	var authorTeamID = exec(`INSERT INTO teams (name, organization_id) VALUES (?, ?)`, "org-team-c", teamA.OrganizationID)
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, authorTeamID, authorID, "owner")
+	if _, err := call(outsiderID, WithTeam(ContextHandlerFunc(TeamRename)), `{"name":"org-team-c","new_name":"hijacked"}`); err != ErrNotTeamOwner {
+		t.Fatalf("Expected outsiders not to manage the team, got %q", err)
+	}
+	if _, err := call(adminID, WithTeam(ContextHandlerFunc(TeamRename)), `{"name":"org-team-c","new_name":"org-team-d"}`); err != nil {
+		t.Fatalf("Expected organization admins to manage every team, got %q", err)
+	}
+
+	var w, err = call(authorID, ContextHandlerFunc(EntryCreate), `{"title":"org wide","body":"b","anchor":"a","teams":["org-team-b"],"identifier":{"docset_filename":"Organizations","page_path":"index.html"}}`)
+	if err != nil {
+		t.Fatalf("EntryCreate errored with: %#v", err)
+	}
+	var created entrySaveResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if _, err := call(outsiderID, ContextHandlerFunc(EntryCreate), `{"title":"t","body":"b","anchor":"a","organization":"org","identifier":{"docset_filename":"Organizations","page_path":"index.html"}}`); err != ErrNotOrganizationMember {
+		t.Errorf("Expected outsiders not to share with the organization, got %q", err)
+	}
+
+	var identifier = dash.Identifier{DocsetFilename: "Organizations", PagePath: "index.html"}
+	upsertIdentifier(db, &identifier)
+	for _, tc := range []struct {
+		userID   int
+		expected int
+	}{
+		{memberID, 1},
+		// entries shared with teams of the user are listed as team entries
+		{adminID, 0},
+		{outsiderID, 0},
+	} {
+		var user, _ = findUserByID(db, tc.userID)
+		var entries, err = findByOrganizationAndIdentifier(db, identifier, user)
+		if err != nil {
+			t.Fatalf("findByOrganizationAndIdentifier errored with: %#v", err)
+		}
+		if len(entries) != tc.expected {
+			t.Errorf("Expected user %q to see %d organization entries, got %d", user.Username, tc.expected, len(entries))
+		}
+	}
+
+	// references, backlinks and mentions follow the same visibility
+	if !canSeeEntry(db, created.Entry.ID, memberID) || canSeeEntry(db, created.Entry.ID, outsiderID) {
+		t.Errorf("Expected only organization members to see the entry")
+	}
+
+	// removing the entry from the team also hides it from the organization
+	var member, _ = findUserByID(db, memberID)
+	exec(`UPDATE entry_team SET removed_from_team = ? WHERE entry_id = ?`, true, created.Entry.ID)
+	if entries, _ := findByOrganizationAndIdentifier(db, identifier, member); len(entries) != 0 {
+		t.Errorf("Expected entries removed from the team to be hidden from the organization, got %d", len(entries))
+	}
+	if canSeeEntry(db, created.Entry.ID, memberID) {
+		t.Errorf("Expected entries removed from the team to be invisible to the organization")
+	}
+	exec(`UPDATE entry_team SET removed_from_team = ?, approved = ? WHERE entry_id = ?`, false, false, created.Entry.ID)
+	if entries, _ := findByOrganizationAndIdentifier(db, identifier, member); len(entries) != 0 {
+		t.Errorf("Expected pending entries to be hidden from the organization, got %d", len(entries))
+	}
+
+	// edits from Dash, which does not know about organizations, keep an explicitly chosen organization
+	w, err = call(authorID, ContextHandlerFunc(EntryCreate), `{"title":"explicit","body":"b","anchor":"a","organization":"org","identifier":{"docset_filename":"Organizations","page_path":"index.html"}}`)
+	if err != nil {
+		t.Fatalf("EntryCreate errored with: %#v", err)
+	}
+	json.NewDecoder(w.Body).Decode(&created)
+	if _, err := call(authorID, WithEntry(ContextHandlerFunc(EntrySave)), fmt.Sprintf(`{"entry_id":%d,"title":"edited","body":"b","anchor":"a"}`, created.Entry.ID)); err != nil {
+		t.Fatalf("EntrySave errored with: %#v", err)
+	}
+	if entry, _ := findEntryByID(db, created.Entry.ID); entry.Organization != "org" {
+		t.Errorf("Expected the organization to be kept, got %q", entry.Organization)
+	}
+
+	if _, err := call(outsiderID, WithOrganization(ContextHandlerFunc(OrganizationListMembers)), `{"name":"org"}`); err != ErrNotOrganizationMember {
+		t.Fatalf("Expected outsiders not to see the directory, got %q", err)
+	}
+	w, err = call(memberID, WithOrganization(ContextHandlerFunc(OrganizationListMembers)), `{"name":"org"}`)
+	if err != nil {
+		t.Fatalf("OrganizationListMembers errored with: %#v", err)
+	}
+	var list organizationListMembersResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Teams) != 3 || len(list.Members) != 3 {
+		t.Fatalf("Expected 3 teams and 3 members, got %#v", list)
+	}
+	if list.Members[0].Username != "org-admin" || !list.Members[0].Admin || len(list.Members[1].Teams) != 2 {
+		t.Errorf("Unexpected directory: %#v", list.Members)
+	}
+}
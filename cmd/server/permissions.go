@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrReservedRole is returned when a custom role should use the name of a built-in role
+	ErrReservedRole = newAPIError(http.StatusUnprocessableEntity, "reserved_role", "Invalid parameter: role. owner, moderator and member are reserved")
+	// ErrInvalidCapability is returned when a custom role should grant an unknown capability
+	ErrInvalidCapability = newAPIError(http.StatusUnprocessableEntity, "invalid_capability", "Invalid parameter: capabilities. Must be invite, remove_member, moderate_entries, edit_entries or view_members")
+	// ErrUnknownRole is returned when a custom role should be deleted which the team does not have
+	ErrUnknownRole = newAPIError(http.StatusNotFound, "unknown_role", "Invalid parameter: role. Unknown role")
+	// ErrRoleInUse is returned when a custom role should be deleted while members still hold it
+	ErrRoleInUse = newAPIError(http.StatusConflict, "role_in_use", "The role is still assigned to members of the team")
+)
+
+// splitCapabilities parses the capabilities stored for a custom role
+func splitCapabilities(capabilities string) []string {
+	if capabilities == "" {
+		return []string{}
+	}
+	return strings.Split(capabilities, ",")
+}
+
+// membershipCan reports whether the role of the user in the team grants the capability
+func membershipCan(user dash.User, teamID int, capability string) bool {
+	for _, membership := range user.TeamMemberships {
+		if membership.TeamID == teamID {
+			return membership.Can(capability)
+		}
+	}
+	return false
+}
+
+// isTeamMemberOf reports whether the user belongs to the team, either through a membership or as owner of the
+// team or admin of the organization owning the team
+func isTeamMemberOf(user dash.User, team dash.Team) bool {
+	for _, membership := range user.TeamMemberships {
+		if membership.TeamID == team.ID {
+			return true
+		}
+	}
+	return teamCan(user, team, dash.CapabilityManageTeam)
+}
+
+// teamCan reports whether the user holds the capability in the team, either through the role in the team or
+// as owner of the team or admin of the organization owning the team
+func teamCan(user dash.User, team dash.Team, capability string) bool {
+	if team.OwnerID == user.ID || (team.OrganizationID != 0 && isOrganizationAdminOf(user, team.OrganizationID)) {
+		return true
+	}
+	return membershipCan(user, team.ID, capability)
+}
+
+// requireTeamCapability returns the error for a user lacking the capability in the team, or nil
+func requireTeamCapability(user dash.User, team dash.Team, capability string) error {
+	if teamCan(user, team, capability) {
+		return nil
+	}
+	if capability == dash.CapabilityManageTeam {
+		return ErrNotTeamOwner
+	}
+	return ErrNotTeamModerator
+}
+
+// entryTeamsWith returns the ids of all teams of the entry in which the user holds the capability
+func entryTeamsWith(entry dash.Entry, user dash.User, capability string) []int {
+	var teamIDs = make([]int, 0)
+	for _, membership := range user.TeamMemberships {
+		for _, team := range entry.Teams {
+			if team == membership.TeamName && membership.Can(capability) {
+				teamIDs = append(teamIDs, membership.TeamID)
+			}
+		}
+	}
+	return teamIDs
+}
+
+// isTeamRole reports whether the role can be assigned to members of the team
+func isTeamRole(db *sql.DB, teamID int, role string) bool {
+	if role == dash.RoleMember || role == dash.RoleModerator {
+		return true
+	}
+	var cnt = 0
+	db.QueryRow(`SELECT count(*) FROM team_roles WHERE team_id = ? AND name = ?`, teamID, role).Scan(&cnt)
+	return cnt != 0
+}
+
+type teamRole struct {
+	Name         string   `json:"name"`
+	Capabilities []string `json:"capabilities"`
+	Builtin      bool     `json:"builtin"`
+}
+
+type teamRoleListResponse struct {
+	Status string     `json:"status"`
+	Roles  []teamRole `json:"roles"`
+}
+
+// TeamRoleList returns the built-in and custom roles of a team with the capabilities they grant
+func TeamRoleList(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityViewMembers); err != nil {
+		return err
+	}
+
+	var roles = make([]teamRole, 0)
+	for _, name := range []string{dash.RoleOwner, dash.RoleModerator, dash.RoleMember} {
+		roles = append(roles, teamRole{Name: name, Capabilities: dash.BuiltinRoles[name], Builtin: true})
+	}
+
+	var rows, err = db.Query(`SELECT name, capabilities FROM team_roles WHERE team_id = ? ORDER BY name`, team.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role teamRole
+		var capabilities string
+		if err := rows.Scan(&role.Name, &capabilities); err != nil {
+			return err
+		}
+		role.Capabilities = splitCapabilities(capabilities)
+		roles = append(roles, role)
+	}
+
+	json.NewEncoder(w).Encode(teamRoleListResponse{
+		Status: "success",
+		Roles:  roles,
+	})
+	return nil
+}
+
+type teamRoleSetRequest struct {
+	Role         string   `json:"role"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// TeamRoleSet allows the team owner to create a custom role or change the capabilities it grants
+func TeamRoleSet(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
+	}
+
+	var payload teamRoleSetRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var role = strings.TrimSpace(payload.Role)
+	if role == "" {
+		return ErrMissingRoleParameter
+	}
+	if _, builtin := dash.BuiltinRoles[role]; builtin {
+		return ErrReservedRole
+	}
+	var granted = map[string]bool{}
+	for _, capability := range payload.Capabilities {
+		var valid = false
+		for _, grantable := range dash.GrantableCapabilities {
+			valid = valid || capability == grantable
+		}
+		if !valid {
+			return ErrInvalidCapability
+		}
+		granted[capability] = true
+	}
+	var capabilities = make([]string, 0, len(granted))
+	for capability := range granted {
+		capabilities = append(capabilities, capability)
+	}
+	sort.Strings(capabilities)
+
+	var err error
+	if isTeamRole(db, team.ID, role) {
+		_, err = db.Exec(`UPDATE team_roles SET capabilities = ?, updated_at = ? WHERE team_id = ? AND name = ?`, strings.Join(capabilities, ","), time.Now(), team.ID, role)
+	} else {
+		_, err = db.Exec(`INSERT INTO team_roles (team_id, name, capabilities, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, team.ID, role, strings.Join(capabilities, ","), time.Now(), time.Now())
+	}
+	if err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type teamRoleDeleteRequest struct {
+	Role string `json:"role"`
+}
+
+// TeamRoleDelete allows the team owner to delete a custom role no member holds anymore
+func TeamRoleDelete(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
+	}
+
+	var payload teamRoleDeleteRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.Role == "" {
+		return ErrMissingRoleParameter
+	}
+	var members = 0
+	db.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ? AND role = ?`, team.ID, payload.Role).Scan(&members)
+	if members != 0 {
+		return ErrRoleInUse
+	}
+
+	var res, err = db.Exec(`DELETE FROM team_roles WHERE team_id = ? AND name = ?`, team.ID, payload.Role)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrUnknownRole
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestBuiltinRoles(t *testing.T) {
+	for _, tc := range []struct {
+		membership dash.TeamMember
+		capability string
+		expected   bool
+	}{
+		{dash.TeamMember{Role: dash.RoleOwner}, dash.CapabilityManageTeam, true},
+		{dash.TeamMember{Role: dash.RoleModerator}, dash.CapabilityModerateEntries, true},
+		{dash.TeamMember{Role: dash.RoleModerator}, dash.CapabilityRemoveMember, true},
+		{dash.TeamMember{Role: dash.RoleModerator}, dash.CapabilityManageTeam, false},
+		{dash.TeamMember{Role: dash.RoleMember}, dash.CapabilityViewMembers, false},
+		{dash.TeamMember{Role: "editor", Capabilities: []string{dash.CapabilityEditEntries}}, dash.CapabilityEditEntries, true},
+		{dash.TeamMember{Role: "editor", Capabilities: []string{dash.CapabilityEditEntries}}, dash.CapabilityManageTeam, false},
+	} {
+		if actual := tc.membership.Can(tc.capability); actual != tc.expected {
+			t.Errorf("Expected role %q to grant %q: %v, got %v", tc.membership.Role, tc.capability, tc.expected, actual)
+		}
+	}
+}
+
+func TestTeamCustomRoles(t *testing.T) {
+	var ownerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "roles-owner", "b")
+	var editorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "roles-editor", "b")
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "roles-team")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, ownerID, "owner")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, editorID, "member")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Roles", "Roles", "c", "d", "e", "f", "g", "h", false)
+	var entryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "owned", "b", "b", "comment", identifierID, "c", ownerID, false, false, 0)
+	exec(`INSERT INTO entry_team (entry_id, team_id) VALUES (?, ?)`, entryID, teamID)
+
+	var edit = fmt.Sprintf(`{"entry_id":%d,"title":"edited","body":"b","anchor":"c","teams":["roles-team"]}`, entryID)
+
+	if _, err := call(editorID, WithEntry(ContextHandlerFunc(EntrySave)), edit); err != ErrUpdateForbidden {
+		t.Fatalf("Expected members not to edit entries of others, got %q", err)
+	}
+	if _, err := call(editorID, WithTeam(ContextHandlerFunc(TeamRoleSet)), `{"name":"roles-team","role":"editor","capabilities":["edit_entries"]}`); err != ErrNotTeamOwner {
+		t.Fatalf("Expected members not to manage roles, got %q", err)
+	}
+	if _, err := call(ownerID, WithTeam(ContextHandlerFunc(TeamRoleSet)), `{"name":"roles-team","role":"moderator","capabilities":["invite"]}`); err != ErrReservedRole {
+		t.Fatalf("Expected built-in roles to return %q, got %q", ErrReservedRole, err)
+	}
+	if _, err := call(ownerID, WithTeam(ContextHandlerFunc(TeamRoleSet)), `{"name":"roles-team","role":"editor","capabilities":["manage_team"]}`); err != ErrInvalidCapability {
+		t.Fatalf("Expected ungrantable capabilities to return %q, got %q", ErrInvalidCapability, err)
+	}
+	if _, err := call(ownerID, WithTeam(ContextHandlerFunc(TeamRoleSet)), `{"name":"roles-team","role":"editor","capabilities":["edit_entries","view_members"]}`); err != nil {
+		t.Fatalf("TeamRoleSet errored with: %#v", err)
+	}
+	if _, err := call(ownerID, WithTeam(ContextHandlerFunc(TeamSetRole)), `{"name":"roles-team","username":"roles-editor","role":"writer"}`); err != ErrInvalidRoleParameter {
+		t.Fatalf("Expected unknown roles to return %q, got %q", ErrInvalidRoleParameter, err)
+	}
+	if _, err := call(ownerID, WithTeam(ContextHandlerFunc(TeamSetRole)), `{"name":"roles-team","username":"roles-editor","role":"editor"}`); err != nil {
+		t.Fatalf("TeamSetRole errored with: %#v", err)
+	}
+
+	var rescope = fmt.Sprintf(`{"entry_id":%d,"title":"edited","body":"b","anchor":"c","public":true,"teams":[]}`, entryID)
+	if _, err := call(editorID, WithEntry(ContextHandlerFunc(EntrySave)), rescope); err != nil {
+		t.Fatalf("Expected the editor role to allow editing, got %q", err)
+	}
+	if entry, _ := findEntryByID(db, entryID); entry.Title != "edited" || entry.Public || len(entry.Teams) != 1 {
+		t.Errorf("Expected editors to change the content but not the visibility, got %#v", entry)
+	}
+	var moderatorID = exec(`INSERT INTO users (username, password, moderator) VALUES (?, ?, ?)`, "roles-moderator", "b", true)
+	if _, err := call(moderatorID, WithEntry(ContextHandlerFunc(EntrySave)), rescope); err != nil {
+		t.Fatalf("Expected moderators to edit entries of others, got %q", err)
+	}
+	if entry, _ := findEntryByID(db, entryID); !entry.Public {
+		t.Errorf("Expected moderators to change the visibility, got %#v", entry)
+	}
+	if _, err := call(editorID, WithTeam(ContextHandlerFunc(TeamListMember)), `{"name":"roles-team"}`); err != nil {
+		t.Errorf("Expected the editor role to allow listing members, got %q", err)
+	}
+	if _, err := call(editorID, WithTeam(ContextHandlerFunc(TeamRemoveMember)), `{"name":"roles-team","username":"roles-owner"}`); err != ErrNotTeamModerator {
+		t.Errorf("Expected the editor role not to allow removing members, got %q", err)
+	}
+
+	if _, err := call(ownerID, WithTeam(ContextHandlerFunc(TeamRoleDelete)), `{"name":"roles-team","role":"editor"}`); err != ErrRoleInUse {
+		t.Fatalf("Expected assigned roles to return %q, got %q", ErrRoleInUse, err)
+	}
+}
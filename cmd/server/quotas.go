@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrEntryQuotaExceeded is returned when a user should create more entries than allowed per day
+	ErrEntryQuotaExceeded = newAPIError(http.StatusForbidden, "entry_quota_exceeded", "Quota exceeded: you created the maximum number of entries for today")
+	// ErrBodyTooLarge is returned when an entry body exceeds the maximum body size
+	ErrBodyTooLarge = newAPIError(http.StatusUnprocessableEntity, "body_too_large", "Invalid parameter: body. The body exceeds the maximum size")
+	// ErrTeamQuotaExceeded is returned when a user should create more teams than allowed
+	ErrTeamQuotaExceeded = newAPIError(http.StatusForbidden, "team_quota_exceeded", "Quota exceeded: you own the maximum number of teams")
+	// ErrTeamFull is returned when a user should join a team which has the maximum number of members
+	ErrTeamFull = newAPIError(http.StatusForbidden, "team_full", "Quota exceeded: the team has the maximum number of members")
+	// ErrInvalidQuota is returned when an override should be set for an unknown quota
+	ErrInvalidQuota = newAPIError(http.StatusUnprocessableEntity, "invalid_quota", "Invalid parameter: quota. Must be entries_per_day, max_body_size or teams_per_user for users, members_per_team for teams")
+	// ErrMissingQuotaTarget is returned when an override should be set without a username or team
+	ErrMissingQuotaTarget = newAPIError(http.StatusUnprocessableEntity, "missing_quota_target", "Missing parameter: username or team")
+)
+
+// defaultQuotas are used when the server is started without quota flags. Nothing is limited unless configured
+var defaultQuotas = dash.Quotas{}
+
+// quotasFromContext returns the configured quotas, falling back to the default quotas
+func quotasFromContext(ctx context.Context) dash.Quotas {
+	if q, ok := ctx.Value(QuotasKey).(dash.Quotas); ok {
+		return q
+	}
+	return defaultQuotas
+}
+
+// findQuotaOverrides returns the quota overrides of a user or team, by quota
+func findQuotaOverrides(db *sql.DB, column string, id int) map[string]int {
+	var overrides = map[string]int{}
+	var rows, err = db.Query(`SELECT quota, quota_limit FROM quota_overrides WHERE `+column+` = ?`, id)
+	if err != nil {
+		return overrides
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var quota string
+		var limit int
+		if err := rows.Scan(&quota, &limit); err == nil {
+			overrides[quota] = limit
+		}
+	}
+	return overrides
+}
+
+// userQuotas applies the overrides of the user to the configured quotas
+func userQuotas(db *sql.DB, quotas dash.Quotas, user dash.User) dash.Quotas {
+	var overrides = findQuotaOverrides(db, "user_id", user.ID)
+	if limit, ok := overrides[dash.QuotaEntriesPerDay]; ok {
+		quotas.EntriesPerDay = limit
+	}
+	if limit, ok := overrides[dash.QuotaMaxBodySize]; ok {
+		quotas.MaxBodySize = limit
+	}
+	if limit, ok := overrides[dash.QuotaTeamsPerUser]; ok {
+		quotas.TeamsPerUser = limit
+	}
+	return quotas
+}
+
+// checkBodySize makes sure the entry body fits the maximum body size of the user. Admins are exempt from quotas
+func checkBodySize(db *sql.DB, quotas dash.Quotas, user dash.User, body string) error {
+	if user.Admin {
+		return nil
+	}
+	quotas = userQuotas(db, quotas, user)
+	if quotas.MaxBodySize > 0 && len(body) > quotas.MaxBodySize {
+		return ErrBodyTooLarge
+	}
+	return nil
+}
+
+// checkEntryQuota makes sure the user created fewer entries within the last 24 hours than allowed
+func checkEntryQuota(db *sql.DB, quotas dash.Quotas, user dash.User) error {
+	if user.Admin {
+		return nil
+	}
+	quotas = userQuotas(db, quotas, user)
+	if quotas.EntriesPerDay == 0 {
+		return nil
+	}
+	var cnt = 0
+	db.QueryRow(`SELECT count(*) FROM entries WHERE user_id = ? AND created_at > ?`, user.ID, time.Now().Add(-24*time.Hour)).Scan(&cnt)
+	if cnt >= quotas.EntriesPerDay {
+		return ErrEntryQuotaExceeded
+	}
+	return nil
+}
+
+// checkTeamQuota makes sure the user owns fewer teams than allowed
+func checkTeamQuota(db *sql.DB, quotas dash.Quotas, user dash.User) error {
+	if user.Admin {
+		return nil
+	}
+	quotas = userQuotas(db, quotas, user)
+	if quotas.TeamsPerUser == 0 {
+		return nil
+	}
+	var cnt = 0
+	db.QueryRow(`SELECT count(*) FROM team_user WHERE user_id = ? AND role = ?`, user.ID, dash.RoleOwner).Scan(&cnt)
+	if cnt >= quotas.TeamsPerUser {
+		return ErrTeamQuotaExceeded
+	}
+	return nil
+}
+
+// checkTeamMemberQuota makes sure the team has fewer members than allowed before the actor adds another one
+func checkTeamMemberQuota(db *sql.DB, quotas dash.Quotas, teamID int, actor dash.User) error {
+	if actor.Admin {
+		return nil
+	}
+	var limit = quotas.MembersPerTeam
+	if override, ok := findQuotaOverrides(db, "team_id", teamID)[dash.QuotaMembersPerTeam]; ok {
+		limit = override
+	}
+	if limit == 0 {
+		return nil
+	}
+	var cnt = 0
+	db.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ?`, teamID).Scan(&cnt)
+	if cnt >= limit {
+		return ErrTeamFull
+	}
+	return nil
+}
+
+// listQuotaOverrides returns all quota overrides of users and teams
+func listQuotaOverrides(db *sql.DB) ([]dash.QuotaOverride, error) {
+	var rows, err = db.Query(`SELECT COALESCE(u.username, ''), COALESCE(t.name, ''), qo.quota, qo.quota_limit
+		FROM quota_overrides qo
+		LEFT JOIN users u ON u.id = qo.user_id
+		LEFT JOIN teams t ON t.id = qo.team_id
+		ORDER BY qo.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overrides = make([]dash.QuotaOverride, 0)
+	for rows.Next() {
+		var override dash.QuotaOverride
+		if err := rows.Scan(&override.Username, &override.Team, &override.Quota, &override.Limit); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+type adminQuotasResponse struct {
+	Status    string               `json:"status"`
+	Defaults  dash.Quotas          `json:"defaults"`
+	Overrides []dash.QuotaOverride `json:"overrides"`
+}
+
+// AdminQuotaList returns the configured quotas and all overrides
+func AdminQuotaList(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Admin {
+		return ErrNotAdmin
+	}
+
+	var overrides, err = listQuotaOverrides(db)
+	if err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(adminQuotasResponse{
+		Status:    "success",
+		Defaults:  quotasFromContext(ctx),
+		Overrides: overrides,
+	})
+	return nil
+}
+
+type adminQuotaSetRequest struct {
+	Username string `json:"username"`
+	Team     string `json:"team"`
+	Quota    string `json:"quota"`
+	Limit    int    `json:"limit"`
+	Reset    bool   `json:"reset"`
+}
+
+// AdminQuotaSet allows admins to override a quota for a single user or team, e.g. to raise the entry limit of
+// an import script. A limit of 0 means unlimited; reset removes the override again
+func AdminQuotaSet(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	if !user.Admin {
+		return ErrNotAdmin
+	}
+
+	var payload adminQuotaSetRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var column string
+	var id int
+	switch {
+	case payload.Username != "":
+		if payload.Quota != dash.QuotaEntriesPerDay && payload.Quota != dash.QuotaMaxBodySize && payload.Quota != dash.QuotaTeamsPerUser {
+			return ErrInvalidQuota
+		}
+		var target, err = findUserByUsername(db, payload.Username)
+		if err != nil {
+			return ErrUnknownUser
+		}
+		column, id = "user_id", target.ID
+	case payload.Team != "":
+		if payload.Quota != dash.QuotaMembersPerTeam {
+			return ErrInvalidQuota
+		}
+		var team, err = findTeamByName(db, payload.Team)
+		if err != nil {
+			return ErrTeamUnknown
+		}
+		column, id = "team_id", team.ID
+	default:
+		return ErrMissingQuotaTarget
+	}
+	if payload.Limit < 0 {
+		payload.Limit = 0
+	}
+
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM quota_overrides WHERE `+column+` = ? AND quota = ?`, id, payload.Quota); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !payload.Reset {
+		if _, err := tx.Exec(`INSERT INTO quota_overrides (`+column+`, quota, quota_limit, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, id, payload.Quota, payload.Limit, time.Now(), time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
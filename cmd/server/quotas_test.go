@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestQuotas(t *testing.T) {
+	var userID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "quota-user", "b")
+	var joinerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "quota-joiner", "b")
+	var adminID = exec(`INSERT INTO users (username, password, admin) VALUES (?, ?, ?)`, "quota-admin", "b", true)
+
+	var quotaCtx = context.WithValue(rootCtx, QuotasKey, dash.Quotas{EntriesPerDay: 1, MaxBodySize: 10, TeamsPerUser: 1, MembersPerTeam: 1})
+	var entry = func(body string) string {
+		return `{"title":"t","body":"` + body + `","anchor":"a","identifier":{"docset_filename":"Quotas","page_path":"index.html"}}`
+	}
+
+	if _, err := callWithContext(quotaCtx, userID, ContextHandlerFunc(EntryCreate), entry("way too long body")); err != ErrBodyTooLarge {
+		t.Fatalf("Expected large bodies to return %q, got %q", ErrBodyTooLarge, err)
+	}
+	if _, err := callWithContext(quotaCtx, userID, ContextHandlerFunc(EntryCreate), entry("short")); err != nil {
+		t.Fatalf("EntryCreate errored with: %#v", err)
+	}
+	if _, err := callWithContext(quotaCtx, userID, ContextHandlerFunc(EntryCreate), entry("short")); err != ErrEntryQuotaExceeded {
+		t.Fatalf("Expected the second entry of the day to return %q, got %q", ErrEntryQuotaExceeded, err)
+	}
+	if _, err := callWithContext(quotaCtx, adminID, ContextHandlerFunc(EntryCreate), entry("way too long body")); err != nil {
+		t.Fatalf("Expected admins to be exempt from quotas, got %q", err)
+	}
+
+	if _, err := callWithContext(quotaCtx, userID, ContextHandlerFunc(TeamCreate), `{"name":"quota-team"}`); err != nil {
+		t.Fatalf("TeamCreate errored with: %#v", err)
+	}
+	if _, err := callWithContext(quotaCtx, userID, ContextHandlerFunc(TeamCreate), `{"name":"quota-team-2"}`); err != ErrTeamQuotaExceeded {
+		t.Fatalf("Expected the second team to return %q, got %q", ErrTeamQuotaExceeded, err)
+	}
+	if _, err := callWithContext(quotaCtx, joinerID, WithTeam(ContextHandlerFunc(TeamJoin)), `{"name":"quota-team"}`); err != ErrTeamFull {
+		t.Fatalf("Expected joining a full team to return %q, got %q", ErrTeamFull, err)
+	}
+
+	if _, err := callWithContext(quotaCtx, userID, ContextHandlerFunc(AdminQuotaSet), `{"username":"quota-user","quota":"entries_per_day","limit":0}`); err != ErrNotAdmin {
+		t.Fatalf("Expected non admins to return %q, got %q", ErrNotAdmin, err)
+	}
+	if _, err := callWithContext(quotaCtx, adminID, ContextHandlerFunc(AdminQuotaSet), `{"team":"quota-team","quota":"entries_per_day","limit":0}`); err != ErrInvalidQuota {
+		t.Fatalf("Expected user quotas on teams to return %q, got %q", ErrInvalidQuota, err)
+	}
+	for _, body := range []string{
+		`{"username":"quota-user","quota":"entries_per_day","limit":0}`,
+		`{"username":"quota-user","quota":"teams_per_user","limit":2}`,
+		`{"team":"quota-team","quota":"members_per_team","limit":2}`,
+	} {
+		if _, err := callWithContext(quotaCtx, adminID, ContextHandlerFunc(AdminQuotaSet), body); err != nil {
+			t.Fatalf("AdminQuotaSet errored with: %#v", err)
+		}
+	}
+	if _, err := callWithContext(quotaCtx, userID, ContextHandlerFunc(EntryCreate), entry("short")); err != nil {
+		t.Fatalf("Expected the override to lift the entry quota, got %q", err)
+	}
+	if _, err := callWithContext(quotaCtx, userID, ContextHandlerFunc(TeamCreate), `{"name":"quota-team-2"}`); err != nil {
+		t.Fatalf("Expected the override to raise the team quota, got %q", err)
+	}
+	if _, err := callWithContext(quotaCtx, joinerID, WithTeam(ContextHandlerFunc(TeamJoin)), `{"name":"quota-team"}`); err != nil {
+		t.Fatalf("Expected the override to raise the member quota, got %q", err)
+	}
+
+	if _, err := callWithContext(quotaCtx, adminID, ContextHandlerFunc(AdminQuotaSet), `{"username":"quota-user","quota":"entries_per_day","reset":true}`); err != nil {
+		t.Fatalf("AdminQuotaSet errored with: %#v", err)
+	}
+	if overrides, _ := listQuotaOverrides(db); len(overrides) != 2 {
+		t.Errorf("Expected 2 remaining overrides, got %#v", overrides)
+	}
+	if _, err := callWithContext(quotaCtx, userID, ContextHandlerFunc(EntryCreate), entry("short")); err != ErrEntryQuotaExceeded {
+		t.Errorf("Expected the reset to restore the entry quota, got %q", err)
+	}
+
+	// entries stored before the body size limit was lowered stay editable as long as the body does not grow
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "a", "Quotas", "c", "d", "e", "f", "g", "h", false)
+	var entryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "t", "way too long body", "", "comment", identifierID, "a", userID, false, false, 0)
+	var save = func(body string) error {
+		var _, err = callWithContext(quotaCtx, userID, WithEntry(ContextHandlerFunc(EntrySave)), fmt.Sprintf(`{"entry_id":%d,"title":"renamed","body":%q,"anchor":"a"}`, entryID, body))
+		return err
+	}
+	if err := save("way too long body"); err != nil {
+		t.Errorf("Expected edits keeping the body size to pass, got %q", err)
+	}
+	if err := save("way too long body, even longer"); err != ErrBodyTooLarge {
+		t.Errorf("Expected edits growing the body to return %q, got %q", ErrBodyTooLarge, err)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+// referencePattern matches cross references inside annotation bodies. Supported forms are
+//
+//	[[entry:42]]                    references another annotation by id
+//	[[Go/net/http/index.html]]      references a docset page using docset_filename/page_path
+//	[[entry:42|a custom label]]     either form can carry a custom label
+var referencePattern = regexp.MustCompile(`\[\[([^\]|]+)(?:\|([^\]]+))?\]\]`)
+
+// dashURLScheme is used to create links which can be opened by dash
+const dashURLScheme = "dash-plugin"
+
+type reference struct {
+	Label       string
+	EntryID     int
+	Identifier  dash.Identifier
+	TargetTitle string
+	TargetURL   string
+}
+
+// identifierURL returns a link which opens the page of an identifier inside dash
+func identifierURL(identifier dash.Identifier) string {
+	var query = identifier.PageTitle
+	if query == "" {
+		var segments = strings.Split(strings.TrimSuffix(identifier.PagePath, "/"), "/")
+		query = strings.TrimSuffix(segments[len(segments)-1], ".html")
+	}
+	return fmt.Sprintf("%s://keys=%s&query=%s", dashURLScheme, url.QueryEscape(identifier.DocsetFilename), url.QueryEscape(query))
+}
+
+// canSeeEntry reports whether the user is allowed to read the entry, following the
+// public, team and organization visibility rules
+func canSeeEntry(db *sql.DB, entryID, userID int) bool {
+	var organizationCond = ""
+	var organizationParams []interface{}
+	if userID != 0 {
+		if memberships, err := findOrganizationMemberships(db, userID); err == nil && len(memberships) > 0 {
+			var visibility string
+			visibility, organizationParams = organizationVisibility(memberships)
+			organizationCond = ` OR ` + visibility
+		}
+	}
+
+	var cnt = 0
+	var params = []interface{}{false, true, userID, entryID, userID, false, true, false}
+	db.QueryRow(`SELECT count(*)
+		FROM entries e
+		LEFT JOIN entry_team et ON et.entry_id = e.id AND et.removed_from_team = ? AND et.approved = ?
+		LEFT JOIN team_user tu ON tu.team_id = et.team_id AND tu.user_id = ?
+		WHERE e.id = ?
+			AND (e.user_id = ? OR (e.draft = ? AND ((e.public = ? AND e.removed_from_public = ?) OR tu.id IS NOT NULL`+organizationCond+`)))`,
+		append(params, organizationParams...)...).Scan(&cnt)
+	return cnt > 0
+}
+
+func findIdentifierByID(db *sql.DB, identifierID int) (dash.Identifier, error) {
+	var identifier = dash.Identifier{ID: identifierID}
+	var err = db.QueryRow(`SELECT docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public FROM identifiers WHERE id = ?`, identifierID).Scan(
+		&identifier.DocsetName,
+		&identifier.DocsetFilename,
+		&identifier.DocsetPlatform,
+		&identifier.DocsetBundle,
+		&identifier.DocsetVersion,
+		&identifier.PagePath,
+		&identifier.PageTitle,
+		&identifier.HttrackSource,
+		&identifier.BannedFromPublic)
+	return identifier, err
+}
+
+// resolveReference looks up the target of a reference. References to entries the user
+// is not allowed to see are not resolved
+func resolveReference(db *sql.DB, ref *reference, userID int) bool {
+	if ref.EntryID != 0 {
+		if !canSeeEntry(db, ref.EntryID, userID) {
+			return false
+		}
+		var identifierID int
+		if err := db.QueryRow(`SELECT title, identifier_id FROM entries WHERE id = ?`, ref.EntryID).Scan(&ref.TargetTitle, &identifierID); err != nil {
+			return false
+		}
+		var identifier, err = findIdentifierByID(db, identifierID)
+		if err != nil {
+			return false
+		}
+		ref.TargetURL = identifierURL(identifier)
+		return true
+	}
+
+	// only pages known from listing annotations are resolved, so rendering never writes identifiers
+	findIdentifier(db, &ref.Identifier)
+	if ref.Identifier.ID == 0 {
+		return false
+	}
+	var identifier, err = findIdentifierByID(db, ref.Identifier.ID)
+	if err != nil {
+		return false
+	}
+	ref.Identifier = identifier
+	ref.TargetTitle = ref.Identifier.PageTitle
+	if ref.TargetTitle == "" {
+		ref.TargetTitle = ref.Identifier.DocsetFilename + "/" + ref.Identifier.PagePath
+	}
+	ref.TargetURL = identifierURL(ref.Identifier)
+	return true
+}
+
+func parseReference(target, label string) (reference, bool) {
+	var ref = reference{Label: strings.TrimSpace(label)}
+	target = strings.TrimSpace(target)
+	if strings.HasPrefix(target, "entry:") {
+		var id, err = strconv.Atoi(strings.TrimPrefix(target, "entry:"))
+		if err != nil || id <= 0 {
+			return ref, false
+		}
+		ref.EntryID = id
+		return ref, true
+	}
+
+	var parts = strings.SplitN(target, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return ref, false
+	}
+	ref.Identifier = dash.Identifier{
+		DocsetFilename: parts[0],
+		PagePath:       parts[1],
+	}
+	return ref, true
+}
+
+// resolveReferences replaces all cross references inside body the user is allowed to see with markdown
+// links dash is able to open. It returns the rewritten body as well as all resolved references
+func resolveReferences(db *sql.DB, body string, userID int) (string, []reference) {
+	var refs = make([]reference, 0)
+	var resolved = referencePattern.ReplaceAllStringFunc(body, func(match string) string {
+		var groups = referencePattern.FindStringSubmatch(match)
+		var ref, ok = parseReference(groups[1], groups[2])
+		if !ok || !resolveReference(db, &ref, userID) {
+			return match
+		}
+		refs = append(refs, ref)
+
+		var label = ref.Label
+		if label == "" {
+			label = ref.TargetTitle
+		}
+		return fmt.Sprintf("[%s](%s)", strings.NewReplacer("[", `\[`, "]", `\]`).Replace(label), ref.TargetURL)
+	})
+	return resolved, refs
+}
+
+// renderEntryBody renders the body of an entry to be stored. Cross references are left unresolved, since
+// what they resolve to depends on the reader. It returns the references visible to the author
+func renderEntryBody(db *sql.DB, r Renderer, body string, authorID int) (string, []reference) {
+	var _, refs = resolveReferences(db, body, authorID)
+	return r.Render(body), refs
+}
+
+// renderEntryBodyFor renders the body of an entry for a reader, resolving the cross references visible to them
+func renderEntryBodyFor(db *sql.DB, r Renderer, body string, userID int) string {
+	var resolved, _ = resolveReferences(db, body, userID)
+	return r.Render(resolved)
+}
+
+// saveEntryReferences replaces the outgoing references stored for an entry
+func saveEntryReferences(db *sql.DB, entryID int, refs []reference) error {
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM entry_references WHERE entry_id = ?`, entryID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, ref := range refs {
+		var targetIdentifierID = 0
+		if ref.EntryID == 0 {
+			targetIdentifierID = ref.Identifier.ID
+		}
+		if _, err := tx.Exec(`INSERT INTO entry_references (entry_id, target_entry_id, target_identifier_id, created_at) VALUES (?, ?, ?, ?)`, entryID, nullableID(ref.EntryID), nullableID(targetIdentifierID), time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// findReferencingEntries returns all entries visible to the user which reference the given entry
+func findReferencingEntries(db *sql.DB, entry dash.Entry, user dash.User) ([]dash.Entry, error) {
+	var rows, err = db.Query(`SELECT DISTINCT e.id, e.title, e.identifier_id
+		FROM entries e
+		INNER JOIN entry_references r ON r.entry_id = e.id
+		WHERE r.target_entry_id = ?
+		ORDER BY e.id`, entry.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates = make([]dash.Entry, 0)
+	for rows.Next() {
+		var candidate = dash.Entry{}
+		if err := rows.Scan(&candidate.ID, &candidate.Title, &candidate.IdentifierID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	rows.Close()
+
+	var entries = make([]dash.Entry, 0)
+	for _, candidate := range candidates {
+		if !canSeeEntry(db, candidate.ID, user.ID) {
+			continue
+		}
+		if candidate.Identifier, err = findIdentifierByID(db, candidate.IdentifierID); err != nil {
+			return nil, err
+		}
+		entries = append(entries, candidate)
+	}
+	return entries, nil
+}
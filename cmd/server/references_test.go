@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestResolveReferences_Entry(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "ref-author", "b")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Go", "Go", "go", "go", "1", "net/http/index.html", "http", "", false)
+	var targetID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Client.Do notes", "b", "b", "comment", identifierID, "c", authorID, true, false, 1)
+
+	var body, refs = resolveReferences(db, "see [[entry:"+strconv.Itoa(targetID)+"]]", authorID)
+	if len(refs) != 1 || refs[0].EntryID != targetID {
+		t.Fatalf("Expected a reference to entry %d, got %#v", targetID, refs)
+	}
+	if body != "see [Client.Do notes](dash-plugin://keys=Go&query=http)" {
+		t.Errorf("Expected reference to be replaced by a link, got %q", body)
+	}
+}
+
+func TestResolveReferences_InvisibleEntry(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "ref-private", "b")
+	var readerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "ref-reader", "b")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Go", "Go", "go", "go", "1", "fmt/index.html", "fmt", "", false)
+	var targetID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "secret", "b", "b", "comment", identifierID, "c", authorID, false, false, 1)
+
+	var input = "see [[entry:" + strconv.Itoa(targetID) + "]]"
+	var body, refs = resolveReferences(db, input, readerID)
+	if len(refs) != 0 {
+		t.Fatalf("Expected private entries not to be resolved, got %#v", refs)
+	}
+	if body != input {
+		t.Errorf("Expected body to be unchanged, got %q", body)
+	}
+}
+
+func TestEntryGet_ResolvesReferencesForReader(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "ref-get-author", "b")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Go", "Go", "go", "go", "1", "os/index.html", "os", "", false)
+	var targetID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "private plans", "b", "b", "comment", identifierID, "c", authorID, false, false, 1)
+	var body = "see [[entry:" + strconv.Itoa(targetID) + "]]"
+	if rendered, _ := renderEntryBody(db, defaultRenderer, body, authorID); strings.Contains(rendered, "private plans") {
+		t.Errorf("Expected stored bodies to leave references unresolved, got %q", rendered)
+	}
+	// bodies stored before references were resolved per reader contain the view of the author
+	var rendered = renderEntryBodyFor(db, defaultRenderer, body, authorID)
+	var sourceID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "public notes", body, rendered, "comment", identifierID, "c", authorID, true, false, 1)
+
+	var get = func(user *dash.User) string {
+		var entry, _ = findEntryByID(db, sourceID)
+		var ctx = context.WithValue(rootCtx, EntryKey, &entry)
+		if user != nil {
+			ctx = context.WithValue(ctx, UserKey, user)
+		}
+		var w = httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(""))
+		if err := EntryGet(ctx, w, req); err != nil {
+			t.Fatalf("EntryGet errored with: %#v", err)
+		}
+		var resp entryGetResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.BodyRendered
+	}
+
+	if strings.Contains(get(nil), "private plans") {
+		t.Errorf("Expected readers not to see titles of hidden entries")
+	}
+	if author, _ := findUserByID(db, authorID); !strings.Contains(get(&author), "private plans") {
+		t.Errorf("Expected the author to see the referenced title")
+	}
+}
+
+func TestResolveReferences_Page(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "ref-page", "b")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Go", "Go", "go", "go", "1", "net/url/index.html", "", "", false)
+
+	var body, refs = resolveReferences(db, "see [[Go/net/url/index.html|the url package]]", authorID)
+	if len(refs) != 1 || refs[0].Identifier.ID != identifierID {
+		t.Fatalf("Expected a reference to the stored identifier, got %#v", refs)
+	}
+	if body != "see [the url package](dash-plugin://keys=Go&query=index)" {
+		t.Errorf("Expected reference to be replaced by a link, got %q", body)
+	}
+
+	// references to unknown pages stay unresolved, rendering never creates identifiers
+	var input = "see [[Go/made/up.html]]"
+	if body, refs = resolveReferences(db, input, authorID); len(refs) != 0 || body != input {
+		t.Errorf("Expected unknown pages not to be resolved, got %q", body)
+	}
+	var cnt = 0
+	db.QueryRow(`SELECT count(*) FROM identifiers WHERE page_path = ?`, "made/up.html").Scan(&cnt)
+	if cnt != 0 {
+		t.Errorf("Expected no identifier to be created for unknown pages")
+	}
+}
+
+func TestFindReferencingEntries(t *testing.T) {
+	var authorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "ref-backlink", "b")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Go", "Go", "go", "go", "1", "io/index.html", "io", "", false)
+	var targetID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "target", "b", "b", "comment", identifierID, "c", authorID, true, false, 1)
+	var publicID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "public source", "b", "b", "comment", identifierID, "c", authorID, true, false, 1)
+	var privateID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "private source", "b", "b", "comment", identifierID, "c", authorID, false, false, 1)
+
+	for _, sourceID := range []int{publicID, privateID} {
+		if err := saveEntryReferences(db, sourceID, []reference{{EntryID: targetID}}); err != nil {
+			t.Fatalf("Failed to store references: %v", err)
+		}
+	}
+
+	var backlinks, err = findReferencingEntries(db, dash.Entry{ID: targetID}, dash.User{})
+	if err != nil {
+		t.Fatalf("Expected findReferencingEntries not to return an error, got %q", err)
+	}
+	if len(backlinks) != 1 || backlinks[0].ID != publicID {
+		t.Fatalf("Expected anonymous users to only see the public backlink, got %#v", backlinks)
+	}
+
+	backlinks, _ = findReferencingEntries(db, dash.Entry{ID: targetID}, dash.User{ID: authorID})
+	if len(backlinks) != 2 {
+		t.Fatalf("Expected the author to see both backlinks, got %#v", backlinks)
+	}
+	if !strings.HasPrefix(identifierURL(backlinks[0].Identifier), "dash-plugin://") {
+		t.Errorf("Expected backlinks to include their identifier")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+)
+
+// Renderer turns the markdown body of an entry into html which is safe to be
+// displayed inside dash
+type Renderer interface {
+	Render(body string) string
+}
+
+const (
+	extensionTables         = "tables"
+	extensionFootnotes      = "footnotes"
+	extensionTaskLists      = "tasklists"
+	extensionHeadingAnchors = "heading-anchors"
+	extensionAutolinks      = "autolinks"
+)
+
+// defaultMarkdownExtensions matches the extensions blackfriday.Run enables by default
+var defaultMarkdownExtensions = []string{extensionTables, extensionAutolinks}
+
+// baseMarkdownExtensions are always enabled, independent of the configuration
+const baseMarkdownExtensions = blackfriday.CommonExtensions &^ (blackfriday.Tables | blackfriday.Autolink)
+
+var taskListItem = regexp.MustCompile(`(<li>(?:\s*<p>)?)\[([ xX])\]\s`)
+
+type markdownRenderer struct {
+	extensions blackfriday.Extensions
+	taskLists  bool
+	policy     *bluemonday.Policy
+}
+
+func newSanitizerPolicy(name string) (*bluemonday.Policy, error) {
+	switch name {
+	case "", "ugc":
+		var policy = bluemonday.UGCPolicy()
+		policy.AllowURLSchemes(dashURLScheme)
+		return policy, nil
+	case "strict":
+		return bluemonday.StrictPolicy(), nil
+	default:
+		return nil, fmt.Errorf("unknown sanitizer policy %q. Must either be ugc or strict", name)
+	}
+}
+
+// newMarkdownRenderer returns a Renderer using blackfriday with the requested extensions,
+// sanitizing the output with the named bluemonday policy
+func newMarkdownRenderer(extensions []string, policyName string) (Renderer, error) {
+	var policy, err = newSanitizerPolicy(policyName)
+	if err != nil {
+		return nil, err
+	}
+
+	var r = &markdownRenderer{
+		extensions: baseMarkdownExtensions,
+		policy:     policy,
+	}
+	for _, ext := range extensions {
+		switch strings.TrimSpace(ext) {
+		case "":
+		case extensionTables:
+			r.extensions |= blackfriday.Tables
+		case extensionFootnotes:
+			r.extensions |= blackfriday.Footnotes
+		case extensionTaskLists:
+			r.taskLists = true
+		case extensionHeadingAnchors:
+			r.extensions |= blackfriday.AutoHeadingIDs
+		case extensionAutolinks:
+			r.extensions |= blackfriday.Autolink
+		default:
+			return nil, fmt.Errorf("unknown markdown extension %q", ext)
+		}
+	}
+	return r, nil
+}
+
+// Render converts the markdown body to html and sanitizes the result
+func (r *markdownRenderer) Render(body string) string {
+	var html = r.policy.SanitizeBytes(
+		blackfriday.Run([]byte(body), blackfriday.WithExtensions(r.extensions)),
+	)
+	if r.taskLists {
+		// checkboxes are added after sanitizing so the policy does not need to allow inputs
+		html = taskListItem.ReplaceAllFunc(html, func(match []byte) []byte {
+			var groups = taskListItem.FindSubmatch(match)
+			var checkbox = `<input type="checkbox" disabled> `
+			if string(groups[2]) != " " {
+				checkbox = `<input type="checkbox" checked disabled> `
+			}
+			return append(append([]byte{}, groups[1]...), checkbox...)
+		})
+	}
+	return string(html)
+}
+
+var defaultRenderer, _ = newMarkdownRenderer(defaultMarkdownExtensions, "ugc")
+
+// rendererFromContext returns the configured renderer, falling back to the default pipeline
+func rendererFromContext(ctx context.Context) Renderer {
+	if r, ok := ctx.Value(RendererKey).(Renderer); ok {
+		return r
+	}
+	return defaultRenderer
+}
+
+// rerenderEntries updates body_rendered and the cross references of all entries using the given renderer
+func rerenderEntries(db *sql.DB, r Renderer) (int, error) {
+	var rows, err = db.Query(`SELECT id, body, user_id FROM entries`)
+	if err != nil {
+		return 0, err
+	}
+
+	type renderedEntry struct {
+		id       int
+		body     string
+		authorID int
+	}
+	var entries = make([]renderedEntry, 0)
+	for rows.Next() {
+		var entry renderedEntry
+		if err := rows.Scan(&entry.id, &entry.body, &entry.authorID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+
+	for _, entry := range entries {
+		var rendered, refs = renderEntryBody(db, r, entry.body, entry.authorID)
+		if _, err := db.Exec(`UPDATE entries SET body_rendered = ? WHERE id = ?`, rendered, entry.id); err != nil {
+			return 0, err
+		}
+		if err := saveEntryReferences(db, entry.id, refs); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
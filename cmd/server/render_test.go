@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdownRenderer_Defaults(t *testing.T) {
+	t.Parallel()
+
+	var r, err = newMarkdownRenderer(defaultMarkdownExtensions, "ugc")
+	if err != nil {
+		t.Fatalf("Expected default renderer to be valid, got %q", err)
+	}
+
+	var html = r.Render("| a | b |\n|---|---|\n| 1 | 2 |\n\nsee https://kapeli.com\n\n<script>alert(1)</script>")
+	if !strings.Contains(html, "<table>") {
+		t.Errorf("Expected tables to be rendered, got %q", html)
+	}
+	if !strings.Contains(html, `<a href="https://kapeli.com"`) {
+		t.Errorf("Expected urls to be linked, got %q", html)
+	}
+	if strings.Contains(html, "<script>") {
+		t.Errorf("Expected scripts to be removed, got %q", html)
+	}
+}
+
+func TestMarkdownRenderer_Extensions(t *testing.T) {
+	t.Parallel()
+
+	var r, err = newMarkdownRenderer([]string{"footnotes", "tasklists", "heading-anchors"}, "ugc")
+	if err != nil {
+		t.Fatalf("Expected renderer to be valid, got %q", err)
+	}
+
+	var html = r.Render("# Usage notes\n\n- [ ] open\n- [x] done\n\ntext[^1]\n\n[^1]: footnote\n")
+	if !strings.Contains(html, `<h1 id="usage-notes">`) {
+		t.Errorf("Expected headings to have anchors, got %q", html)
+	}
+	if !strings.Contains(html, `<li><input type="checkbox" disabled> open</li>`) {
+		t.Errorf("Expected open task to be rendered, got %q", html)
+	}
+	if !strings.Contains(html, `<li><input type="checkbox" checked disabled> done</li>`) {
+		t.Errorf("Expected done task to be rendered, got %q", html)
+	}
+	if !strings.Contains(html, `href="#fn:1"`) {
+		t.Errorf("Expected footnotes to be rendered, got %q", html)
+	}
+	if strings.Contains(html, "<table>") || strings.Contains(r.Render("| a |\n|---|\n| 1 |"), "<table>") {
+		t.Errorf("Expected tables to be disabled, got %q", html)
+	}
+}
+
+func TestMarkdownRenderer_StrictPolicy(t *testing.T) {
+	t.Parallel()
+
+	var r, err = newMarkdownRenderer(defaultMarkdownExtensions, "strict")
+	if err != nil {
+		t.Fatalf("Expected renderer to be valid, got %q", err)
+	}
+
+	if html := r.Render("**bold**"); html != "bold\n" {
+		t.Errorf("Expected strict policy to remove all tags, got %q", html)
+	}
+}
+
+func TestMarkdownRenderer_InvalidConfiguration(t *testing.T) {
+	t.Parallel()
+
+	if _, err := newMarkdownRenderer([]string{"emoji"}, "ugc"); err == nil {
+		t.Errorf("Expected unknown extensions to be rejected")
+	}
+	if _, err := newMarkdownRenderer(defaultMarkdownExtensions, "anything-goes"); err == nil {
+		t.Errorf("Expected unknown policies to be rejected")
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+	"github.com/nicolai86/dash-annotations/scim"
+)
+
+// sqlSCIMProvider exposes users and teams to identity providers. Groups are teams, their members are the
+// team members. Teams created via SCIM are owned by their first member and stay hidden until they have one
+type sqlSCIMProvider struct {
+	db *sql.DB
+}
+
+// parseSCIMID converts resource ids back to database ids
+func parseSCIMID(id string) (int, error) {
+	var parsed, err = strconv.Atoi(id)
+	if err != nil {
+		return 0, scim.ErrNotFound
+	}
+	return parsed, nil
+}
+
+func (p *sqlSCIMProvider) queryUsers(cond string, params ...interface{}) ([]scim.User, error) {
+	var rows, err = p.db.Query(`SELECT id, username, email, disabled FROM users WHERE ghost = ?`+cond+` ORDER BY id`, append([]interface{}{false}, params...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users = []scim.User{}
+	for rows.Next() {
+		var id int
+		var email sql.NullString
+		var disabled bool
+		var user scim.User
+		if err := rows.Scan(&id, &user.UserName, &email, &disabled); err != nil {
+			return nil, err
+		}
+		user.ID = strconv.Itoa(id)
+		user.Active = !disabled
+		if email.Valid && email.String != "" {
+			user.Emails = []scim.Email{{Value: email.String, Primary: true}}
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (p *sqlSCIMProvider) Users(filter scim.Filter) ([]scim.User, error) {
+	switch filter.Attribute {
+	case "":
+		return p.queryUsers(``)
+	case "username":
+		return p.queryUsers(` AND username = ?`, filter.Value)
+	default:
+		return nil, scim.ErrInvalidFilter
+	}
+}
+
+func (p *sqlSCIMProvider) User(id string) (scim.User, error) {
+	var userID, err = parseSCIMID(id)
+	if err != nil {
+		return scim.User{}, err
+	}
+	var users []scim.User
+	if users, err = p.queryUsers(` AND id = ?`, userID); err != nil {
+		return scim.User{}, err
+	}
+	if len(users) == 0 {
+		return scim.User{}, scim.ErrNotFound
+	}
+	return users[0], nil
+}
+
+// emailTaken reports whether another user already uses the email address
+func (p *sqlSCIMProvider) emailTaken(email string, userID int) bool {
+	var cnt = 0
+	p.db.QueryRow(`SELECT count(*) FROM users WHERE email = ? AND id != ?`, email, userID).Scan(&cnt)
+	return cnt > 0
+}
+
+// updateUser applies email, password and suspension of the SCIM user to the stored user
+func (p *sqlSCIMProvider) updateUser(user scim.User) error {
+	var store = &sqlUserStorage{db: p.db}
+	if email := user.PrimaryEmail(); email != "" {
+		if err := store.UpdateUserWithEmail(user.UserName, email); err != nil {
+			return err
+		}
+		// the identity provider owns the address, so it does not need to be verified again
+		if _, err := p.db.Exec(`UPDATE users SET email_verified = ?, email_verification_token = NULL WHERE username = ?`, true, user.UserName); err != nil {
+			return err
+		}
+	} else if _, err := p.db.Exec(`UPDATE users SET email = NULL, updated_at = ? WHERE username = ?`, time.Now(), user.UserName); err != nil {
+		return err
+	}
+	if user.Password != "" {
+		if err := store.UpdateUserWithPassword(user.UserName, user.Password); err != nil {
+			return err
+		}
+	}
+	if err := setSuspended(p.db, user.UserName, !user.Active, dash.SourceSCIM, 0); err != nil {
+		if err == ErrSuspendAdmin {
+			return fmt.Errorf("%w: %v", scim.ErrInvalidValue, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateUser registers the user. Without password the user can only login after resetting it
+func (p *sqlSCIMProvider) CreateUser(user scim.User) (scim.User, error) {
+	if user.UserName == "" {
+		return scim.User{}, scim.ErrInvalidValue
+	}
+	if email := user.PrimaryEmail(); email != "" && p.emailTaken(email, 0) {
+		return scim.User{}, scim.ErrUniqueness
+	}
+
+	var password = user.Password
+	if password == "" {
+		var err error
+		if password, err = generateRandomString(32); err != nil {
+			return scim.User{}, err
+		}
+	}
+	var store = &sqlUserStorage{db: p.db}
+	if err := store.InsertUser(user.UserName, password); err != nil {
+		if err == ErrUsernameExists {
+			return scim.User{}, scim.ErrUniqueness
+		}
+		return scim.User{}, err
+	}
+
+	user.Password = ""
+	if err := p.updateUser(user); err != nil {
+		return scim.User{}, err
+	}
+	var created, err = findUserByUsername(p.db, user.UserName)
+	if err != nil {
+		return scim.User{}, err
+	}
+	return p.User(strconv.Itoa(created.ID))
+}
+
+// ReplaceUser renames, suspends or reinstates the user and updates the email address
+func (p *sqlSCIMProvider) ReplaceUser(id string, user scim.User) (scim.User, error) {
+	var existing, err = p.User(id)
+	if err != nil {
+		return scim.User{}, err
+	}
+	var userID, _ = strconv.Atoi(existing.ID)
+	if user.UserName == "" {
+		return scim.User{}, scim.ErrInvalidValue
+	}
+	if email := user.PrimaryEmail(); email != "" && p.emailTaken(email, userID) {
+		return scim.User{}, scim.ErrUniqueness
+	}
+
+	if user.UserName != existing.UserName {
+		if user.UserName == ghostUsername {
+			return scim.User{}, scim.ErrUniqueness
+		}
+		if _, err := findUserByUsername(p.db, user.UserName); err == nil {
+			return scim.User{}, scim.ErrUniqueness
+		}
+		if _, err := p.db.Exec(`UPDATE users SET username = ?, updated_at = ? WHERE id = ?`, user.UserName, time.Now(), userID); err != nil {
+			return scim.User{}, err
+		}
+	}
+	if err := p.updateUser(user); err != nil {
+		return scim.User{}, err
+	}
+	return p.User(id)
+}
+
+// DeleteUser deletes the account, handing its entries over to the ghost user
+func (p *sqlSCIMProvider) DeleteUser(id string) error {
+	var userID, err = parseSCIMID(id)
+	if err != nil {
+		return err
+	}
+	var user dash.User
+	if user, err = findUserByID(p.db, userID); err != nil || user.Ghost {
+		return scim.ErrNotFound
+	}
+	return deleteUserAccount(p.db, user, entriesReassign)
+}
+
+func (p *sqlSCIMProvider) queryGroups(cond string, params ...interface{}) ([]scim.Group, error) {
+	var rows, err = p.db.Query(`SELECT id, name FROM teams`+cond+` ORDER BY id`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups = []scim.Group{}
+	for rows.Next() {
+		var id int
+		var group scim.Group
+		if err := rows.Scan(&id, &group.DisplayName); err != nil {
+			return nil, err
+		}
+		group.ID = strconv.Itoa(id)
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range groups {
+		if groups[i].Members, err = p.groupMembers(groups[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+func (p *sqlSCIMProvider) groupMembers(teamID string) ([]scim.Member, error) {
+	var rows, err = p.db.Query(`SELECT u.id, u.username FROM team_user AS tm INNER JOIN users AS u ON u.id = tm.user_id WHERE tm.team_id = ? ORDER BY u.id`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members = []scim.Member{}
+	for rows.Next() {
+		var id int
+		var member scim.Member
+		if err := rows.Scan(&id, &member.Display); err != nil {
+			return nil, err
+		}
+		member.Value = strconv.Itoa(id)
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (p *sqlSCIMProvider) Groups(filter scim.Filter) ([]scim.Group, error) {
+	switch filter.Attribute {
+	case "":
+		return p.queryGroups(``)
+	case "displayname":
+		return p.queryGroups(` WHERE name = ?`, filter.Value)
+	default:
+		return nil, scim.ErrInvalidFilter
+	}
+}
+
+func (p *sqlSCIMProvider) Group(id string) (scim.Group, error) {
+	var teamID, err = parseSCIMID(id)
+	if err != nil {
+		return scim.Group{}, err
+	}
+	var groups []scim.Group
+	if groups, err = p.queryGroups(` WHERE id = ?`, teamID); err != nil {
+		return scim.Group{}, err
+	}
+	if len(groups) == 0 {
+		return scim.Group{}, scim.ErrNotFound
+	}
+	return groups[0], nil
+}
+
+// memberIDs resolves the members of the group to user ids, rejecting unknown users
+func (p *sqlSCIMProvider) memberIDs(group scim.Group) ([]int, error) {
+	var ids = []int{}
+	for _, member := range group.Members {
+		var userID, err = strconv.Atoi(member.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown member %q", scim.ErrInvalidValue, member.Value)
+		}
+		var user dash.User
+		if user, err = findUserByID(p.db, userID); err != nil || user.Ghost {
+			return nil, fmt.Errorf("%w: unknown member %q", scim.ErrInvalidValue, member.Value)
+		}
+		ids = append(ids, userID)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// syncTeamMembers adds and removes team members until they match userIDs. Teams without owner, or whose owner
+// is removed, are handed over to the longest standing moderator, or member. Removals apply the departure policy
+// of the team
+func syncTeamMembers(tx *sql.Tx, teamID int, userIDs []int) error {
+	var team = dash.Team{ID: teamID}
+	var ownerID sql.NullInt64
+	if err := tx.QueryRow(`SELECT t.departure_policy, tm.user_id FROM teams AS t LEFT JOIN team_user AS tm ON tm.team_id = t.id AND tm.role = ? WHERE t.id = ?`, "owner", teamID).Scan(&team.DeparturePolicy, &ownerID); err != nil {
+		return err
+	}
+	team.OwnerID = int(ownerID.Int64)
+
+	var current, err = queryIDs(tx, `SELECT user_id FROM team_user WHERE team_id = ? ORDER BY id`, teamID)
+	if err != nil {
+		return err
+	}
+	var desired = map[int]bool{}
+	for _, userID := range userIDs {
+		desired[userID] = true
+	}
+	var existing = map[int]bool{}
+	var removed = []int{}
+	for _, id := range current {
+		var userID = id.(int)
+		existing[userID] = true
+		if !desired[userID] {
+			removed = append(removed, userID)
+		}
+	}
+
+	for _, userID := range userIDs {
+		if existing[userID] {
+			continue
+		}
+		if err := addTeamMember(tx, teamID, userID); err != nil {
+			return err
+		}
+	}
+
+	if len(userIDs) > 0 && !desired[team.OwnerID] {
+		var newOwnerID = userIDs[0]
+		var placeholders = strings.Join(strings.Split(strings.Repeat("?", len(userIDs)), ""), ",")
+		tx.QueryRow(fmt.Sprintf(`SELECT user_id FROM team_user WHERE team_id = ? AND user_id IN (%s) ORDER BY CASE role WHEN ? THEN 0 ELSE 1 END, id LIMIT 1`, placeholders),
+			append(append([]interface{}{teamID}, intsToInterfaces(userIDs)...), "moderator")...).Scan(&newOwnerID)
+		if _, err := tx.Exec(`UPDATE team_user SET role = ? WHERE team_id = ? AND user_id = ?`, "owner", teamID, newOwnerID); err != nil {
+			return err
+		}
+		team.OwnerID = newOwnerID
+	}
+
+	for _, userID := range removed {
+		if err := removeTeamMember(tx, team, userID); err != nil {
+			return err
+		}
+		if err := recordEvent(tx, dash.Event{Kind: dash.EventMemberLeft, ActorID: userID, TeamID: teamID, Detail: "scim"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func intsToInterfaces(ids []int) []interface{} {
+	var params = make([]interface{}, len(ids))
+	for i, id := range ids {
+		params[i] = id
+	}
+	return params
+}
+
+// teamNameTaken reports whether another team already uses the name
+func (p *sqlSCIMProvider) teamNameTaken(name string, teamID int) bool {
+	var cnt = 0
+	p.db.QueryRow(`SELECT count(*) FROM teams WHERE name = ? AND id != ?`, name, teamID).Scan(&cnt)
+	return cnt > 0
+}
+
+// CreateGroup creates a team with the members of the group
+func (p *sqlSCIMProvider) CreateGroup(group scim.Group) (scim.Group, error) {
+	if group.DisplayName == "" {
+		return scim.Group{}, scim.ErrInvalidValue
+	}
+	if p.teamNameTaken(group.DisplayName, 0) {
+		return scim.Group{}, scim.ErrUniqueness
+	}
+	var userIDs, err = p.memberIDs(group)
+	if err != nil {
+		return scim.Group{}, err
+	}
+
+	var tx *sql.Tx
+	if tx, err = p.db.Begin(); err != nil {
+		return scim.Group{}, err
+	}
+	var res sql.Result
+	if res, err = tx.Exec(`INSERT INTO teams (name, access_key, created_at, updated_at) VALUES (?, ?, ?, ?)`, group.DisplayName, "", time.Now(), time.Now()); err != nil {
+		tx.Rollback()
+		return scim.Group{}, err
+	}
+	var teamID int64
+	if teamID, err = res.LastInsertId(); err != nil {
+		tx.Rollback()
+		return scim.Group{}, err
+	}
+	if err := syncTeamMembers(tx, int(teamID), userIDs); err != nil {
+		tx.Rollback()
+		return scim.Group{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return scim.Group{}, err
+	}
+	return p.Group(strconv.FormatInt(teamID, 10))
+}
+
+// ReplaceGroup renames the team and syncs its members
+func (p *sqlSCIMProvider) ReplaceGroup(id string, group scim.Group) (scim.Group, error) {
+	var teamID, err = parseSCIMID(id)
+	if err != nil {
+		return scim.Group{}, err
+	}
+	if _, err := p.Group(id); err != nil {
+		return scim.Group{}, err
+	}
+	if group.DisplayName == "" {
+		return scim.Group{}, scim.ErrInvalidValue
+	}
+	if p.teamNameTaken(group.DisplayName, teamID) {
+		return scim.Group{}, scim.ErrUniqueness
+	}
+	var userIDs []int
+	if userIDs, err = p.memberIDs(group); err != nil {
+		return scim.Group{}, err
+	}
+
+	var tx *sql.Tx
+	if tx, err = p.db.Begin(); err != nil {
+		return scim.Group{}, err
+	}
+	if _, err := tx.Exec(`UPDATE teams SET name = ?, updated_at = ? WHERE id = ?`, group.DisplayName, time.Now(), teamID); err != nil {
+		tx.Rollback()
+		return scim.Group{}, err
+	}
+	if err := syncTeamMembers(tx, teamID, userIDs); err != nil {
+		tx.Rollback()
+		return scim.Group{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return scim.Group{}, err
+	}
+	return p.Group(id)
+}
+
+// DeleteGroup deletes the team. Entries shared with the team are kept for their authors
+func (p *sqlSCIMProvider) DeleteGroup(id string) error {
+	if _, err := p.Group(id); err != nil {
+		return err
+	}
+	var teamID, _ = strconv.Atoi(id)
+
+	var tx, err = p.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := deleteTeam(tx, teamID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
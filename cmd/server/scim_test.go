@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+	"github.com/nicolai86/dash-annotations/scim"
+)
+
+func TestSCIMProvisioning(t *testing.T) {
+	var handler = scim.NewHandler(&sqlSCIMProvider{db: db}, "provisioning-token")
+	var call = func(method, path, body string, status int) map[string]interface{} {
+		var req = httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer provisioning-token")
+		var w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, status, w.Code, w.Body)
+		}
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	var alice = call("POST", "/Users", `{"userName":"scim-alice","emails":[{"value":"alice@scim.test","primary":true}]}`, http.StatusCreated)
+	var bob = call("POST", "/Users", `{"userName":"scim-bob","active":true}`, http.StatusCreated)
+	call("POST", "/Users", `{"userName":"scim-carol","emails":[{"value":"alice@scim.test"}]}`, http.StatusConflict)
+	if user, _ := findUserByUsername(db, "scim-alice"); user.Email.String != "alice@scim.test" || user.Disabled {
+		t.Errorf("Expected an active user with email, got %#v", user)
+	}
+
+	call("PATCH", "/Users/"+bob["id"].(string), `{"Operations":[{"op":"replace","path":"active","value":false}]}`, http.StatusOK)
+	if user, _ := findUserByUsername(db, "scim-bob"); !user.Disabled {
+		t.Errorf("Expected the user to be suspended")
+	}
+	var actions = 0
+	db.QueryRow(`SELECT count(*) FROM admin_actions WHERE source = ? AND action = ?`, dash.SourceSCIM, dash.AdminSuspendUser).Scan(&actions)
+	if actions != 1 {
+		t.Errorf("Expected the suspension to be recorded, got %d records", actions)
+	}
+
+	var group = call("POST", "/Groups", `{"displayName":"scim-team","members":[{"value":"`+alice["id"].(string)+`"},{"value":"`+bob["id"].(string)+`"}]}`, http.StatusCreated)
+	var team, err = findTeamByName(db, "scim-team")
+	if err != nil {
+		t.Fatalf("Expected the team to be created with an owner, got %v", err)
+	}
+	if strconv.Itoa(team.OwnerID) != alice["id"].(string) {
+		t.Errorf("Expected the first member to own the team, got %d", team.OwnerID)
+	}
+	call("PATCH", "/Groups/"+group["id"].(string), `{"Operations":[{"op":"add","path":"members","value":[{"value":"424242"}]}]}`, http.StatusBadRequest)
+
+	call("PATCH", "/Groups/"+group["id"].(string), `{"Operations":[{"op":"remove","path":"members[value eq \"`+alice["id"].(string)+`\"]"}]}`, http.StatusOK)
+	if team, _ = findTeamByName(db, "scim-team"); strconv.Itoa(team.OwnerID) != bob["id"].(string) {
+		t.Errorf("Expected the remaining member to take over the team, got %d", team.OwnerID)
+	}
+	var departures = 0
+	db.QueryRow(`SELECT count(*) FROM events WHERE team_id = ? AND kind = ? AND detail = ?`, team.ID, dash.EventMemberLeft, "scim").Scan(&departures)
+	if departures != 1 {
+		t.Errorf("Expected the removal to be recorded, got %d events", departures)
+	}
+
+	var list = call("GET", `/Users?filter=userName%20eq%20%22scim-alice%22`, "", http.StatusOK)
+	if list["totalResults"].(float64) != 1 {
+		t.Errorf("Expected the filter to match one user, got %#v", list)
+	}
+
+	call("DELETE", "/Users/"+alice["id"].(string), "", http.StatusNoContent)
+	if _, err := findUserByUsername(db, "scim-alice"); err == nil {
+		t.Errorf("Expected the user to be deleted")
+	}
+	call("DELETE", "/Groups/"+group["id"].(string), "", http.StatusNoContent)
+	call("GET", "/Groups/"+group["id"].(string), "", http.StatusNotFound)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var sqlTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05Z",
+	"2006-01-02 15:04:05",
+}
+
+// nullTime scans nullable timestamp columns. Unlike sql.NullTime it does not depend on the
+// driver parsing timestamps, which the mysql driver only does when parseTime is set
+type nullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+// Scan implements the sql.Scanner interface
+func (nt *nullTime) Scan(value interface{}) error {
+	nt.Time, nt.Valid = time.Time{}, false
+
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		nt.Time, nt.Valid = v, !v.IsZero()
+		return nil
+	case []byte:
+		raw = string(v)
+	case string:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported timestamp value %T", value)
+	}
+
+	if raw == "" || raw == "0000-00-00 00:00:00" {
+		return nil
+	}
+	for _, format := range sqlTimeFormats {
+		if t, err := time.ParseInLocation(format, raw, time.Local); err == nil {
+			nt.Time, nt.Valid = t, true
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported timestamp format %q", raw)
+}
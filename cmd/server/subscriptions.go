@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+var (
+	// ErrMissingSubscriptionTarget is returned when a subscription has neither a docset nor a page
+	ErrMissingSubscriptionTarget = newAPIError(http.StatusUnprocessableEntity, "missing_subscription_target", "Missing parameter: docset_filename or identifier")
+	// ErrInvalidFrequency is returned when the requested digest frequency is unknown
+	ErrInvalidFrequency = newAPIError(http.StatusUnprocessableEntity, "invalid_frequency", "Invalid parameter: frequency. Must either be daily or weekly")
+	// ErrSubscriptionUnknown is returned when the subscription id cannot be matched to a subscription of the current user
+	ErrSubscriptionUnknown = newAPIError(http.StatusNotFound, "subscription_unknown", "Unknown subscription")
+)
+
+type subscriptionListResponse struct {
+	Status        string              `json:"status"`
+	Subscriptions []dash.Subscription `json:"subscriptions"`
+}
+
+func findSubscriptionsByUser(db *sql.DB, userID int) ([]dash.Subscription, error) {
+	var rows, err = db.Query(`SELECT id, docset_filename, identifier_id, frequency, last_digest_at, created_at FROM subscriptions WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscriptions = make([]dash.Subscription, 0)
+	for rows.Next() {
+		var subscription = dash.Subscription{UserID: userID}
+		var identifierID sql.NullInt64
+		var lastDigestAt, createdAt nullTime
+		if err := rows.Scan(&subscription.ID, &subscription.DocsetFilename, &identifierID, &subscription.Frequency, &lastDigestAt, &createdAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		subscription.IdentifierID = int(identifierID.Int64)
+		subscription.LastDigestAt = lastDigestAt.Time
+		subscription.CreatedAt = createdAt.Time
+		subscriptions = append(subscriptions, subscription)
+	}
+	rows.Close()
+
+	for i, subscription := range subscriptions {
+		if subscription.IdentifierID == 0 {
+			continue
+		}
+		var identifier, err = findIdentifierByID(db, subscription.IdentifierID)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions[i].Identifier = &identifier
+	}
+	return subscriptions, nil
+}
+
+// SubscriptionList returns all subscriptions of the current user
+func SubscriptionList(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var subscriptions, err = findSubscriptionsByUser(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(subscriptionListResponse{
+		Status:        "success",
+		Subscriptions: subscriptions,
+	})
+	return nil
+}
+
+type subscriptionCreateRequest struct {
+	DocsetFilename string           `json:"docset_filename"`
+	Identifier     *dash.Identifier `json:"identifier"`
+	Frequency      string           `json:"frequency"`
+}
+
+type subscriptionCreateResponse struct {
+	Status       string            `json:"status"`
+	Subscription dash.Subscription `json:"subscription"`
+}
+
+// SubscriptionCreate subscribes the current user to a docset, or a single page if an identifier is given
+func SubscriptionCreate(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var payload subscriptionCreateRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var subscription = dash.Subscription{
+		UserID:         user.ID,
+		DocsetFilename: payload.DocsetFilename,
+		Frequency:      payload.Frequency,
+		CreatedAt:      time.Now(),
+	}
+	if subscription.Frequency == "" {
+		subscription.Frequency = dash.DigestDaily
+	}
+	if subscription.Frequency != dash.DigestDaily && subscription.Frequency != dash.DigestWeekly {
+		return ErrInvalidFrequency
+	}
+
+	if payload.Identifier != nil && !payload.Identifier.IsEmpty() {
+		if err := upsertIdentifier(db, payload.Identifier); err != nil {
+			return err
+		}
+		subscription.Identifier = payload.Identifier
+		subscription.IdentifierID = payload.Identifier.ID
+		subscription.DocsetFilename = payload.Identifier.DocsetFilename
+	}
+	if subscription.DocsetFilename == "" {
+		return ErrMissingSubscriptionTarget
+	}
+
+	var res, err = db.Exec(`INSERT INTO subscriptions (user_id, docset_filename, identifier_id, frequency, created_at) VALUES (?, ?, ?, ?, ?)`,
+		subscription.UserID, subscription.DocsetFilename, nullableID(subscription.IdentifierID), subscription.Frequency, subscription.CreatedAt)
+	if err != nil {
+		return err
+	}
+	var subscriptionID int64
+	if subscriptionID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	subscription.ID = int(subscriptionID)
+
+	json.NewEncoder(w).Encode(subscriptionCreateResponse{
+		Status:       "success",
+		Subscription: subscription,
+	})
+	return nil
+}
+
+type subscriptionDeleteRequest struct {
+	SubscriptionID int `json:"subscription_id"`
+}
+
+// SubscriptionDelete removes a subscription of the current user
+func SubscriptionDelete(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var payload subscriptionDeleteRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var res, err = db.Exec(`DELETE FROM subscriptions WHERE id = ? AND user_id = ?`, payload.SubscriptionID, user.ID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrSubscriptionUnknown
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+// ErrDocsetNotAllowed is returned when an entry should be shared with a team whose docset allow-list does not
+// contain the docset of the entry
+var ErrDocsetNotAllowed = newAPIError(http.StatusForbidden, "docset_not_allowed", "Invalid parameter: teams. The docset is not allowed in one of the teams")
+
+// findTeamDocsets returns the docset patterns a team is restricted to. An empty list allows all docsets
+func findTeamDocsets(db *sql.DB, teamID int) ([]string, error) {
+	var rows, err = db.Query(`SELECT pattern FROM team_docsets WHERE team_id = ? ORDER BY pattern`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var patterns = make([]string, 0)
+	for rows.Next() {
+		var pattern string
+		if err := rows.Scan(&pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// docsetAllowed reports whether the docset filename or bundle of the identifier matches any of the patterns
+func docsetAllowed(patterns []string, identifier dash.Identifier) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, identifier.DocsetFilename); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, identifier.DocsetBundle); identifier.DocsetBundle != "" && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTeamDocsets makes sure the identifier is allowed in all of the teams
+func checkTeamDocsets(db *sql.DB, teams []string, identifier dash.Identifier) error {
+	for _, name := range teams {
+		var team, err = findTeamByName(db, name)
+		if err != nil {
+			continue
+		}
+		var patterns []string
+		if patterns, err = findTeamDocsets(db, team.ID); err != nil {
+			return err
+		}
+		if !docsetAllowed(patterns, identifier) {
+			return ErrDocsetNotAllowed
+		}
+	}
+	return nil
+}
+
+// allowedTeamIDs returns the ids of the teams of the user whose docset allow-list contains the identifier
+func allowedTeamIDs(db *sql.DB, user dash.User, identifier dash.Identifier) ([]int, error) {
+	var teamIDs = make([]int, 0, len(user.TeamMemberships))
+	for _, membership := range user.TeamMemberships {
+		var patterns, err = findTeamDocsets(db, membership.TeamID)
+		if err != nil {
+			return nil, err
+		}
+		if docsetAllowed(patterns, identifier) {
+			teamIDs = append(teamIDs, membership.TeamID)
+		}
+	}
+	return teamIDs, nil
+}
+
+type teamSetDocsetsRequest struct {
+	Docsets []string `json:"docsets"`
+}
+
+// TeamSetDocsets allows the team owner to restrict the team to docsets whose filename or bundle matches one of
+// the given patterns, e.g. "Django*". An empty list allows all docsets again
+func TeamSetDocsets(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
+	}
+
+	var payload teamSetDocsetsRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var patterns = make([]string, 0, len(payload.Docsets))
+	var seen = map[string]bool{}
+	for _, docset := range payload.Docsets {
+		var pattern, err = validDocsetPattern(docset)
+		if err != nil {
+			return err
+		}
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM team_docsets WHERE team_id = ?`, team.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, pattern := range patterns {
+		if _, err := tx.Exec(`INSERT INTO team_docsets (team_id, pattern, created_at) VALUES (?, ?, ?)`, team.ID, pattern, time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
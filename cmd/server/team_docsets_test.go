@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestDocsetAllowed(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		docset   dash.Identifier
+		expected bool
+	}{
+		{[]string{}, dash.Identifier{DocsetFilename: "Ruby"}, true},
+		{[]string{"Django*"}, dash.Identifier{DocsetFilename: "Django 1.9"}, true},
+		{[]string{"Django*"}, dash.Identifier{DocsetFilename: "Ruby"}, false},
+		{[]string{"Ruby", "com.djangoproject.*"}, dash.Identifier{DocsetFilename: "Django", DocsetBundle: "com.djangoproject.django"}, true},
+		{[]string{"*"}, dash.Identifier{DocsetFilename: ""}, true},
+	} {
+		if actual := docsetAllowed(tc.patterns, tc.docset); actual != tc.expected {
+			t.Errorf("Expected %v to allow %#v: %v, got %v", tc.patterns, tc.docset, tc.expected, actual)
+		}
+	}
+}
+
+func TestTeamSetDocsets(t *testing.T) {
+	var ownerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "docsets-owner", "b")
+	var memberID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "docsets-member", "b")
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "docsets-team")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, ownerID, "owner")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, memberID, "member")
+
+	// entries shared before the allow-list was configured are hidden once it excludes their docset
+	var w, err = call(ownerID, ContextHandlerFunc(EntryCreate), `{"title":"early","body":"b","anchor":"a","teams":["docsets-team"],"identifier":{"docset_filename":"Ruby","page_path":"index.html"}}`)
+	if err != nil {
+		t.Fatalf("EntryCreate errored with: %#v", err)
+	}
+	var early entrySaveResponse
+	json.NewDecoder(w.Body).Decode(&early)
+
+	if _, err := call(memberID, WithTeam(ContextHandlerFunc(TeamSetDocsets)), `{"name":"docsets-team","docsets":["Django*"]}`); err != ErrNotTeamOwner {
+		t.Fatalf("Expected members not to change the allow-list, got %q", err)
+	}
+	if _, err := call(ownerID, WithTeam(ContextHandlerFunc(TeamSetDocsets)), `{"name":"docsets-team","docsets":["[Django"]}`); err != ErrInvalidPattern {
+		t.Fatalf("Expected malformed patterns to return %q, got %q", ErrInvalidPattern, err)
+	}
+	if _, err := call(ownerID, WithTeam(ContextHandlerFunc(TeamSetDocsets)), `{"name":"docsets-team","docsets":["Django*","com.djangoproject.*","Django*"]}`); err != nil {
+		t.Fatalf("TeamSetDocsets errored with: %#v", err)
+	}
+	if docsets, _ := findTeamDocsets(db, teamID); strings.Join(docsets, ",") != "Django*,com.djangoproject.*" {
+		t.Errorf("Unexpected allow-list: %v", docsets)
+	}
+
+	if _, err := call(memberID, ContextHandlerFunc(EntryCreate), `{"title":"t","body":"b","anchor":"a","teams":["docsets-team"],"identifier":{"docset_filename":"Ruby","page_path":"index.html"}}`); err != ErrDocsetNotAllowed {
+		t.Fatalf("Expected entries on other docsets to return %q, got %q", ErrDocsetNotAllowed, err)
+	}
+	if _, err := call(ownerID, WithEntry(ContextHandlerFunc(EntrySave)), fmt.Sprintf(`{"entry_id":%d,"title":"early","body":"b","anchor":"a","teams":["docsets-team"]}`, early.Entry.ID)); err != ErrDocsetNotAllowed {
+		t.Fatalf("Expected saving entries on other docsets to return %q, got %q", ErrDocsetNotAllowed, err)
+	}
+	if _, err := call(memberID, ContextHandlerFunc(EntryCreate), `{"title":"t","body":"b","anchor":"a","teams":["docsets-team"],"identifier":{"docset_filename":"Django","docset_bundle":"com.djangoproject.django","page_path":"index.html"}}`); err != nil {
+		t.Fatalf("EntryCreate errored with: %#v", err)
+	}
+
+	var owner, _ = findUserByID(db, ownerID)
+	for _, tc := range []struct {
+		identifier dash.Identifier
+		expected   int
+	}{
+		{dash.Identifier{DocsetFilename: "Ruby", PagePath: "index.html"}, 0},
+		{dash.Identifier{DocsetFilename: "Django", DocsetBundle: "com.djangoproject.django", PagePath: "index.html"}, 1},
+	} {
+		findIdentifier(db, &tc.identifier)
+		var entries, err = findByTeamAndIdentifier(db, tc.identifier, owner)
+		if err != nil {
+			t.Fatalf("findByTeamAndIdentifier errored with: %#v", err)
+		}
+		if len(entries) != tc.expected {
+			t.Errorf("Expected %d team entries on %q, got %d", tc.expected, tc.identifier.DocsetFilename, len(entries))
+		}
+	}
+}
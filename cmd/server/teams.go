@@ -4,11 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/nicolai86/dash-annotations/dash"
 )
@@ -16,21 +17,37 @@ import (
 var (
 	// ErrInvalidAccessKey is returned from a join request handler when the given access key
 	// does not match the teams access key
-	ErrInvalidAccessKey = errors.New("Invalid access key")
+	ErrInvalidAccessKey = newAPIError(http.StatusForbidden, "invalid_access_key", "Invalid access key")
 	// ErrMissingRoleParameter is returned from a set_role handler when no role parameter is present
-	ErrMissingRoleParameter = errors.New("Missing parameter: role")
+	ErrMissingRoleParameter = newAPIError(http.StatusUnprocessableEntity, "missing_role_parameter", "Missing parameter: role")
 	// ErrInvalidRoleParameter is returned from the set_role handler when the role is unknown
-	ErrInvalidRoleParameter = errors.New("Invalid parameter: role. Must either be member or moderator")
+	ErrInvalidRoleParameter = newAPIError(http.StatusUnprocessableEntity, "invalid_role_parameter", "Invalid parameter: role. Must either be member, moderator or a custom role of the team")
 	// ErrMissingUsernameParameter is returned when a target username parameter is required, but missing
-	ErrMissingUsernameParameter = errors.New("Missing parameter: username")
+	ErrMissingUsernameParameter = newAPIError(http.StatusUnprocessableEntity, "missing_username_parameter", "Missing parameter: username")
 	// ErrNotTeamOwner is returned when an action requires you to be the team owner, but you are not
-	ErrNotTeamOwner = errors.New("You need to be the teams owner")
+	ErrNotTeamOwner = newAPIError(http.StatusForbidden, "not_team_owner", "You need to be the teams owner")
 	// ErrUnknownUser is returned when an action requires a target user, but the given username is unknown
-	ErrUnknownUser = errors.New("Invalid parameter: username. Unknown user")
+	ErrUnknownUser = newAPIError(http.StatusNotFound, "unknown_user", "Invalid parameter: username. Unknown user")
 	// ErrTeamNameExists is returned when a team should be created, and the name is already taken
-	ErrTeamNameExists = errors.New("A team with this name already exists")
+	ErrTeamNameExists = newAPIError(http.StatusConflict, "team_name_exists", "A team with this name already exists")
 	// ErrMissingTeamName is returned when a team should be created and the name parameter is missing
-	ErrMissingTeamName = errors.New("Missing parameter: name")
+	ErrMissingTeamName = newAPIError(http.StatusUnprocessableEntity, "missing_team_name", "Missing parameter: name")
+	// ErrNotTeamMember is returned when an action requires the target user to be a member of the team
+	ErrNotTeamMember = newAPIError(http.StatusNotFound, "not_team_member", "Invalid parameter: username. The user is not a member of the team")
+	// ErrOwnerMustTransfer is returned when the owner tries to leave a team which still has other members
+	ErrOwnerMustTransfer = newAPIError(http.StatusConflict, "owner_must_transfer", "You need to transfer the ownership before leaving the team")
+	// ErrMissingNewTeamName is returned when a team should be renamed without a new name
+	ErrMissingNewTeamName = newAPIError(http.StatusUnprocessableEntity, "missing_new_team_name", "Missing parameter: new_name")
+	// ErrDescriptionTooLong is returned when a team description exceeds maxTeamDescriptionLength
+	ErrDescriptionTooLong = newAPIError(http.StatusUnprocessableEntity, "description_too_long", "Invalid parameter: description. Must not be longer than 1000 characters")
+	// ErrInvalidAvatarURL is returned when a team avatar is not an absolute http or https url
+	ErrInvalidAvatarURL = newAPIError(http.StatusUnprocessableEntity, "invalid_avatar_url", "Invalid parameter: avatar_url. Must be an http or https url")
+	// ErrInvalidDeparturePolicy is returned when a team should use an unknown departure policy
+	ErrInvalidDeparturePolicy = newAPIError(http.StatusUnprocessableEntity, "invalid_departure_policy", "Invalid parameter: departure_policy. Must either be delete, reassign or keep")
+	// ErrRemovePrivilegedMember is returned when a moderator tries to remove a member holding another role than member
+	ErrRemovePrivilegedMember = newAPIError(http.StatusForbidden, "remove_privileged_member", "Only the owner can remove members holding another role than member")
+	// ErrChangeOwnerRole is returned when the role of the owner should be changed without transferring the ownership
+	ErrChangeOwnerRole = newAPIError(http.StatusConflict, "change_owner_role", "The owner role can only be changed by transferring the ownership")
 )
 
 type teamListResponse struct {
@@ -63,6 +80,22 @@ func TeamCreate(ctx context.Context, w http.ResponseWriter, req *http.Request) e
 	if team.Name == "" {
 		return ErrMissingTeamName
 	}
+	if err := checkTeamQuota(db, quotasFromContext(ctx), *user); err != nil {
+		return err
+	}
+
+	// teams created inside an organization start with the access key of the organization
+	if organizationName, ok := payload["organization"].(string); ok && organizationName != "" {
+		var organization, err = findOrganizationByName(db, organizationName)
+		if err != nil {
+			return ErrOrganizationUnknown
+		}
+		if !isOrganizationAdminOf(*user, organization.ID) {
+			return ErrNotOrganizationAdmin
+		}
+		team.OrganizationID = organization.ID
+		team.EncryptedAccessKey = organization.DefaultEncryptedAccessKey
+	}
 
 	var tx, err = db.Begin()
 	if err != nil {
@@ -76,7 +109,7 @@ func TeamCreate(ctx context.Context, w http.ResponseWriter, req *http.Request) e
 		return ErrTeamNameExists
 	}
 
-	var res, _ = tx.Exec(`INSERT INTO teams (name, access_key, created_at, updated_at) VALUES (?, ?, ?, ?)`, team.Name, "", time.Now(), time.Now())
+	var res, _ = tx.Exec(`INSERT INTO teams (name, access_key, organization_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, team.Name, team.EncryptedAccessKey, nullableID(team.OrganizationID), time.Now(), time.Now())
 
 	var teamID int64
 	teamID, err = res.LastInsertId()
@@ -112,10 +145,24 @@ func TeamJoin(ctx context.Context, w http.ResponseWriter, req *http.Request) err
 	dec.Decode(&payload)
 
 	if !targetTeam.AccessKeysMatch(payload.AccessKey) {
-		return errors.New("Invalid access key")
+		return ErrInvalidAccessKey
+	}
+	if err := checkTeamMemberQuota(db, quotasFromContext(ctx), targetTeam.ID, *user); err != nil {
+		return err
 	}
 
-	if _, err := db.Exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, targetTeam.ID, user.ID, "member"); err != nil {
+	if targetTeam.RequiresJoinApproval {
+		if err := requestToJoin(db, mailerFromContext(ctx), *targetTeam, *user); err != nil {
+			return err
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":     "success",
+			"membership": dash.JoinRequestPending,
+		})
+		return nil
+	}
+
+	if err := addTeamMember(db, targetTeam.ID, user.ID); err != nil {
 		return err
 	}
 
@@ -125,6 +172,78 @@ func TeamJoin(ctx context.Context, w http.ResponseWriter, req *http.Request) err
 	return nil
 }
 
+// addTeamMember adds the user to the team as member. Entries kept after the user left the team before
+// are no longer marked as by a former member
+func addTeamMember(db execer, teamID, userID int) error {
+	if _, err := db.Exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, userID, "member"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE entry_team SET author_former_member = ? WHERE team_id = ? AND entry_id IN (SELECT id FROM entries WHERE user_id = ?)`, false, teamID, userID); err != nil {
+		return err
+	}
+	return recordEvent(db, dash.Event{Kind: dash.EventMemberJoined, ActorID: userID, TeamID: teamID})
+}
+
+// removeTeamMember ends the membership of the user and applies the departure policy of the team to the
+// entries the user shared only with the team. Entries which are also public or shared elsewhere stay with
+// their author; they are unshared from the team, or kept and marked as by a former member
+func removeTeamMember(tx *sql.Tx, team dash.Team, userID int) error {
+	if _, err := tx.Exec(`DELETE FROM team_user WHERE team_id = ? AND user_id = ?`, team.ID, userID); err != nil {
+		return err
+	}
+
+	var entryIDs, err = queryIDs(tx, `SELECT e.id FROM entries e INNER JOIN entry_team et ON et.entry_id = e.id AND et.team_id = ? WHERE e.user_id = ?`, team.ID, userID)
+	if err != nil || len(entryIDs) == 0 {
+		return err
+	}
+	var exclusiveIDs []interface{}
+	if exclusiveIDs, err = queryIDs(tx, fmt.Sprintf(`SELECT e.id FROM entries e
+		WHERE e.id IN (%s)
+			AND e.public = ?
+			AND e.organization_id IS NULL
+			AND NOT EXISTS (SELECT 1 FROM entry_team et WHERE et.entry_id = e.id AND et.team_id != ?)`, strings.Join(strings.Split(strings.Repeat("?", len(entryIDs)), ""), ",")),
+		append(append([]interface{}{}, entryIDs...), false, team.ID)...); err != nil {
+		return err
+	}
+	var exclusive = map[interface{}]bool{}
+	for _, id := range exclusiveIDs {
+		exclusive[id] = true
+	}
+	var sharedIDs = make([]interface{}, 0, len(entryIDs))
+	for _, id := range entryIDs {
+		if !exclusive[id] {
+			sharedIDs = append(sharedIDs, id)
+		}
+	}
+
+	var markDeparted = func(ids []interface{}) error {
+		if len(ids) == 0 {
+			return nil
+		}
+		var _, err = tx.Exec(fmt.Sprintf(`UPDATE entry_team SET author_former_member = ? WHERE team_id = ? AND entry_id IN (%s)`, strings.Join(strings.Split(strings.Repeat("?", len(ids)), ""), ",")), append([]interface{}{true, team.ID}, ids...)...)
+		return err
+	}
+
+	switch team.DeparturePolicy {
+	case dash.DepartureReassign:
+		if len(exclusiveIDs) > 0 {
+			if _, err := tx.Exec(fmt.Sprintf(`UPDATE entries SET user_id = ? WHERE id IN (%s)`, strings.Join(strings.Split(strings.Repeat("?", len(exclusiveIDs)), ""), ",")), append([]interface{}{team.OwnerID}, exclusiveIDs...)...); err != nil {
+				return err
+			}
+		}
+		return markDeparted(sharedIDs)
+	case dash.DepartureKeep:
+		return markDeparted(entryIDs)
+	default:
+		if len(sharedIDs) > 0 {
+			if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM entry_team WHERE team_id = ? AND entry_id IN (%s)`, strings.Join(strings.Split(strings.Repeat("?", len(sharedIDs)), ""), ",")), append([]interface{}{team.ID}, sharedIDs...)...); err != nil {
+				return err
+			}
+		}
+		return deleteEntries(tx, exclusiveIDs)
+	}
+}
+
 // TeamLeave removes the current user from the requested team
 func TeamLeave(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
 	var db = ctx.Value(DBKey).(*sql.DB)
@@ -138,46 +257,288 @@ func TeamLeave(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 		return err
 	}
 
-	tx.Exec(`DELETE FROM team_user WHERE team_id = ? AND user_id = ?`, team.ID, user.ID)
+	// the owner is looked up within the transaction so a concurrent transfer cannot leave the team without owner
+	var owners, others = 0, 0
+	tx.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ? AND user_id = ? AND role = ?`, team.ID, user.ID, dash.RoleOwner).Scan(&owners)
+	tx.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ? AND user_id != ?`, team.ID, user.ID).Scan(&others)
+	if owners > 0 && others > 0 {
+		tx.Rollback()
+		return ErrOwnerMustTransfer
+	}
 
-	var entryIDs = make([]interface{}, 0)
-	var rows *sql.Rows
-	rows, err = tx.Query(`SELECT e.id FROM entries e INNER JOIN entry_team et ON et.entry_id = e.id AND et.team_id = ? WHERE e.user_id = ?`, team.ID, user.ID)
-	defer rows.Close()
-	for rows.Next() {
-		var entryID int
-		if err := rows.Scan(&entryID); err != nil {
+	if err := removeTeamMember(tx, *team, user.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordEvent(tx, dash.Event{Kind: dash.EventMemberLeft, ActorID: user.ID, TeamID: team.ID}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var membershipCount = -1
+	tx.QueryRow(`SELECT count(*) from team_user WHERE team_id = ?`, team.ID).Scan(&membershipCount)
+	if membershipCount == 0 {
+		if err := deleteTeam(tx, team.ID); err != nil {
+			tx.Rollback()
 			return err
 		}
-		entryIDs = append(entryIDs, entryID)
 	}
 
-	params := append([]interface{}{user.ID}, entryIDs...)
-	var query = fmt.Sprintf(`DELETE FROM votes WHERE user_id = ? AND entry_id IN (%s) `, strings.Join(strings.Split(strings.Repeat("?", len(entryIDs)), ""), ","))
-	tx.Exec(query, params...)
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	enc.Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// transferTeamOwnership makes the member the new owner of the team. The previous owner stays on as moderator.
+// The actor is recorded in the activity of the team
+func transferTeamOwnership(db *sql.DB, team dash.Team, newOwner dash.User, actorID int) error {
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var cnt = 0
+	tx.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ? AND user_id = ?`, team.ID, newOwner.ID).Scan(&cnt)
+	if cnt == 0 {
+		tx.Rollback()
+		return ErrNotTeamMember
+	}
+	var ownerID = 0
+	tx.QueryRow(`SELECT user_id FROM team_user WHERE team_id = ? AND role = ?`, team.ID, dash.RoleOwner).Scan(&ownerID)
+	if newOwner.ID == ownerID {
+		tx.Rollback()
+		return nil
+	}
 
-	query = fmt.Sprintf(`DELETE FROM entry_team WHERE entry_id IN (%s) `, strings.Join(strings.Split(strings.Repeat("?", len(entryIDs)), ""), ","))
-	tx.Exec(query, entryIDs...)
+	if _, err := tx.Exec(`UPDATE team_user SET role = ? WHERE team_id = ? AND user_id = ?`, "moderator", team.ID, ownerID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE team_user SET role = ? WHERE team_id = ? AND user_id = ?`, "owner", team.ID, newOwner.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordEvent(tx, dash.Event{Kind: dash.EventOwnershipTransferred, ActorID: actorID, TeamID: team.ID, TargetUserID: newOwner.ID}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
 
-	query = fmt.Sprintf(`DELETE FROM entries WHERE id IN (%s) `, strings.Join(strings.Split(strings.Repeat("?", len(entryIDs)), ""), ","))
-	tx.Exec(query, entryIDs...)
+type teamRenameRequest struct {
+	NewName string `json:"new_name"`
+}
 
-	var membershipCount = -1
-	tx.QueryRow(`SELECT count(*) from team_user WHERE team_id = ?`, team.ID).Scan(&membershipCount)
-	if membershipCount == 0 {
-		tx.Exec(`DELETE FROM teams WHERE id = ?`, team.ID)
+// TeamRename allows the team owner to change the name of the team. Memberships and shared entries are kept
+func TeamRename(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
+	}
+
+	var payload teamRenameRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var newName = strings.TrimSpace(payload.NewName)
+	if newName == "" {
+		return ErrMissingNewTeamName
+	}
+
+	var cnt = 0
+	db.QueryRow(`SELECT count(*) FROM teams WHERE name = ? AND id != ?`, newName, team.ID).Scan(&cnt)
+	if cnt != 0 {
+		return ErrTeamNameExists
 	}
 
+	if _, err := db.Exec(`UPDATE teams SET name = ?, updated_at = ? WHERE id = ?`, newName, time.Now(), team.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// maxTeamDescriptionLength is the maximum number of characters of a team description
+const maxTeamDescriptionLength = 1000
+
+type teamSetProfileRequest struct {
+	Description string `json:"description"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// TeamSetProfile allows the team owner to change the description and avatar of the team
+func TeamSetProfile(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
+	}
+
+	var payload teamSetProfileRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	var description = strings.TrimSpace(payload.Description)
+	if utf8.RuneCountInString(description) > maxTeamDescriptionLength {
+		return ErrDescriptionTooLong
+	}
+	var avatarURL = strings.TrimSpace(payload.AvatarURL)
+	if avatarURL != "" {
+		var u, err = url.Parse(avatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidAvatarURL
+		}
+	}
+
+	if _, err := db.Exec(`UPDATE teams SET description = ?, avatar_url = ?, updated_at = ? WHERE id = ?`, description, avatarURL, time.Now(), team.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// TeamDelete allows the team owner to delete the team. Entries shared with the team are kept for their authors
+func TeamDelete(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
+	}
+
+	var tx, err = db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := deleteTeam(tx, team.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
 	if err := tx.Commit(); err != nil {
 		return err
 	}
 
-	enc.Encode(map[string]string{
+	json.NewEncoder(w).Encode(map[string]string{
 		"status": "success",
 	})
 	return nil
 }
 
+type teamSetDeparturePolicyRequest struct {
+	DeparturePolicy string `json:"departure_policy"`
+}
+
+// TeamSetDeparturePolicy allows the team owner to decide what happens to the entries of departing members:
+// delete them, reassign them to the owner or keep them marked as by a former member
+func TeamSetDeparturePolicy(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
+	}
+
+	var payload teamSetDeparturePolicyRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	switch payload.DeparturePolicy {
+	case dash.DepartureDelete, dash.DepartureReassign, dash.DepartureKeep:
+	default:
+		return ErrInvalidDeparturePolicy
+	}
+
+	if _, err := db.Exec(`UPDATE teams SET departure_policy = ?, updated_at = ? WHERE id = ?`, payload.DeparturePolicy, time.Now(), team.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+type teamTransferOwnershipRequest struct {
+	Username string `json:"username"`
+}
+
+// TeamTransferOwnership allows the owner or an admin to hand the team over to another member. The previous
+// owner stays on as moderator
+func TeamTransferOwnership(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+	var team = ctx.Value(TeamKey).(*dash.Team)
+
+	if !teamCan(*user, *team, dash.CapabilityManageTeam) && !user.Admin {
+		return ErrNotTeamOwner
+	}
+
+	var payload teamTransferOwnershipRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+
+	if payload.Username == "" {
+		return ErrMissingUsernameParameter
+	}
+	var newOwner, err = findUserByUsername(db, payload.Username)
+	if err != nil {
+		return ErrUnknownUser
+	}
+
+	if err := transferTeamOwnership(db, *team, newOwner, user.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// deleteTeam removes the team with all memberships. Entries shared with the team are kept for their authors
+func deleteTeam(tx *sql.Tx, teamID int) error {
+	if _, err := tx.Exec(`DELETE FROM entry_team WHERE team_id = ?`, teamID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM team_user WHERE team_id = ?`, teamID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM team_invitations WHERE team_id = ?`, teamID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM team_join_requests WHERE team_id = ?`, teamID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM team_roles WHERE team_id = ?`, teamID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM quota_overrides WHERE team_id = ?`, teamID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM team_docsets WHERE team_id = ?`, teamID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM events WHERE team_id = ?`, teamID); err != nil {
+		return err
+	}
+	var _, err = tx.Exec(`DELETE FROM teams WHERE id = ?`, teamID)
+	return err
+}
+
 type teamSetRoleRequest struct {
 	Role     string `json:"role"`
 	Username string `json:"username"`
@@ -189,8 +550,8 @@ func TeamSetRole(ctx context.Context, w http.ResponseWriter, req *http.Request)
 	var user = ctx.Value(UserKey).(*dash.User)
 	var team = ctx.Value(TeamKey).(*dash.Team)
 
-	if team.OwnerID != user.ID {
-		return ErrNotTeamOwner
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
 	}
 
 	var dec = json.NewDecoder(req.Body)
@@ -201,20 +562,26 @@ func TeamSetRole(ctx context.Context, w http.ResponseWriter, req *http.Request)
 	if payload.Role == "" {
 		return ErrMissingRoleParameter
 	}
-	if payload.Role != "member" && payload.Role != "moderator" {
-		return ErrInvalidRoleParameter
-	}
 	if payload.Username == "" {
 		return ErrMissingUsernameParameter
 	}
+	if !isTeamRole(db, team.ID, payload.Role) {
+		return ErrInvalidRoleParameter
+	}
 	var target, err = findUserByUsername(db, payload.Username)
 	if err != nil {
 		return ErrUnknownUser
 	}
+	if target.ID == team.OwnerID {
+		return ErrChangeOwnerRole
+	}
 
 	if _, err := db.Exec(`UPDATE team_user SET role = ? WHERE team_id = ? AND user_id = ?`, payload.Role, team.ID, target.ID); err != nil {
 		return err
 	}
+	if err := recordEvent(db, dash.Event{Kind: dash.EventRoleChanged, ActorID: user.ID, TeamID: team.ID, TargetUserID: target.ID, Detail: payload.Role}); err != nil {
+		return err
+	}
 
 	json.NewEncoder(w).Encode(map[string]string{
 		"status": "success",
@@ -226,14 +593,15 @@ type teamRemoveMemberRequest struct {
 	Username string `json:"username"`
 }
 
-// TeamRemoveMember allows a moderator to remove a member from a team
+// TeamRemoveMember allows a moderator to remove a member from a team. Only the owner can remove members holding
+// another role than member
 func TeamRemoveMember(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
 	var db = ctx.Value(DBKey).(*sql.DB)
 	var user = ctx.Value(UserKey).(*dash.User)
 	var team = ctx.Value(TeamKey).(*dash.Team)
 
-	if team.OwnerID != user.ID {
-		return ErrNotTeamOwner
+	if err := requireTeamCapability(*user, *team, dash.CapabilityRemoveMember); err != nil {
+		return err
 	}
 
 	var payload teamRemoveMemberRequest
@@ -247,39 +615,31 @@ func TeamRemoveMember(ctx context.Context, w http.ResponseWriter, req *http.Requ
 	if err != nil {
 		return ErrUnknownUser
 	}
+	if target.ID == team.OwnerID {
+		return ErrOwnerMustTransfer
+	}
+	var role string
+	if err := db.QueryRow(`SELECT role FROM team_user WHERE team_id = ? AND user_id = ?`, team.ID, target.ID).Scan(&role); err != nil {
+		return ErrNotTeamMember
+	}
+	if role != dash.RoleMember && !teamCan(*user, *team, dash.CapabilityManageTeam) {
+		return ErrRemovePrivilegedMember
+	}
 
 	var tx *sql.Tx
 	if tx, err = db.Begin(); err != nil {
 		return err
 	}
 
-	tx.Exec(`DELETE FROM team_user WHERE team_id = ? AND user_id = ?`, team.ID, target.ID)
-
-	var entryIDs = make([]interface{}, 0)
-	var rows *sql.Rows
-	rows, err = tx.Query(`SELECT e.id FROM entries e INNER JOIN entry_team et ON et.entry_id = e.id AND et.team_id = ? WHERE e.user_id = ?`, team.ID, target.ID)
-	defer rows.Close()
-	if err != nil {
+	if err := removeTeamMember(tx, *team, target.ID); err != nil {
+		tx.Rollback()
 		return err
 	}
-	for rows.Next() {
-		var entryID int
-		if err := rows.Scan(&entryID); err != nil {
-			return err
-		}
-		entryIDs = append(entryIDs, entryID)
+	if err := recordEvent(tx, dash.Event{Kind: dash.EventMemberRemoved, ActorID: user.ID, TeamID: team.ID, TargetUserID: target.ID}); err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	params := append([]interface{}{target.ID}, entryIDs...)
-	var query = fmt.Sprintf(`DELETE FROM votes WHERE user_id = ? AND entry_id IN (%s) `, strings.Join(strings.Split(strings.Repeat("?", len(entryIDs)), ""), ","))
-	tx.Exec(query, params...)
-
-	query = fmt.Sprintf(`DELETE FROM entry_team WHERE entry_id IN (%s) `, strings.Join(strings.Split(strings.Repeat("?", len(entryIDs)), ""), ","))
-	tx.Exec(query, entryIDs...)
-
-	query = fmt.Sprintf(`DELETE FROM entries WHERE id IN (%s) `, strings.Join(strings.Split(strings.Repeat("?", len(entryIDs)), ""), ","))
-	tx.Exec(query, entryIDs...)
-
 	if err := tx.Commit(); err != nil {
 		return err
 	}
@@ -300,8 +660,8 @@ func TeamSetAccessKey(ctx context.Context, w http.ResponseWriter, req *http.Requ
 	var user = ctx.Value(UserKey).(*dash.User)
 	var team = ctx.Value(TeamKey).(*dash.Team)
 
-	if team.OwnerID != user.ID {
-		return ErrNotTeamOwner
+	if err := requireTeamCapability(*user, *team, dash.CapabilityManageTeam); err != nil {
+		return err
 	}
 
 	var enc = json.NewEncoder(w)
@@ -327,19 +687,24 @@ type membership struct {
 }
 
 type teamListMembersResponse struct {
-	Status       string       `json:"status"`
-	Members      []membership `json:"members"`
-	HasAccessKey bool         `json:"has_access_key"`
+	Status          string             `json:"status"`
+	Description     string             `json:"description"`
+	AvatarURL       string             `json:"avatar_url"`
+	Members         []membership       `json:"members"`
+	PendingRequests []dash.JoinRequest `json:"pending_requests"`
+	HasAccessKey    bool               `json:"has_access_key"`
+	Docsets         []string           `json:"docsets"`
 }
 
-// TeamListMember allows moderators to list all members of a requested team
+// TeamListMember lists all members of a requested team to members allowed to view them, together with the
+// pending join requests
 func TeamListMember(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
 	var db = ctx.Value(DBKey).(*sql.DB)
 	var user = ctx.Value(UserKey).(*dash.User)
 	var team = ctx.Value(TeamKey).(*dash.Team)
 
-	if team.OwnerID != user.ID {
-		return ErrNotTeamOwner
+	if err := requireTeamCapability(*user, *team, dash.CapabilityViewMembers); err != nil {
+		return err
 	}
 
 	var payload map[string]interface{}
@@ -360,10 +725,24 @@ func TeamListMember(ctx context.Context, w http.ResponseWriter, req *http.Reques
 		memberships = append(memberships, membership)
 	}
 
+	var pending []dash.JoinRequest
+	if pending, err = listJoinRequests(db, team.ID); err != nil {
+		return err
+	}
+
+	var docsets []string
+	if docsets, err = findTeamDocsets(db, team.ID); err != nil {
+		return err
+	}
+
 	var resp = teamListMembersResponse{
-		Status:       "success",
-		Members:      memberships,
-		HasAccessKey: team.EncryptedAccessKey != "",
+		Status:          "success",
+		Description:     team.Description,
+		AvatarURL:       team.AvatarURL,
+		Members:         memberships,
+		PendingRequests: pending,
+		HasAccessKey:    team.EncryptedAccessKey != "",
+		Docsets:         docsets,
 	}
 	json.NewEncoder(w).Encode(resp)
 	return nil
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nicolai86/dash-annotations/dash"
+)
+
+func TestTeamTransferOwnership(t *testing.T) {
+	var ownerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "transfer-owner", "b")
+	var memberID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "transfer-member", "b")
+	var outsiderID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "transfer-outsider", "b")
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "transfer-team")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, ownerID, "owner")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, memberID, "member")
+
+	var call = func(user dash.User, handler ContextHandlerFunc, body string) error {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+		return WithTeam(handler).ServeHTTPContext(context.WithValue(rootCtx, UserKey, &user), httptest.NewRecorder(), req)
+	}
+	var owner = dash.User{ID: ownerID, Username: "transfer-owner"}
+
+	if err := call(owner, TeamLeave, `{"name":"transfer-team"}`); err != ErrOwnerMustTransfer {
+		t.Fatalf("Expected the owner not to leave with %q, got %q", ErrOwnerMustTransfer, err)
+	}
+	if err := call(owner, TeamSetRole, `{"name":"transfer-team","username":"transfer-owner","role":"member"}`); err != ErrChangeOwnerRole {
+		t.Fatalf("Expected the owner role not to change with %q, got %q", ErrChangeOwnerRole, err)
+	}
+	if err := call(dash.User{ID: outsiderID}, TeamTransferOwnership, `{"name":"transfer-team","username":"transfer-outsider"}`); err != ErrNotTeamOwner {
+		t.Fatalf("Expected outsiders to be rejected with %q, got %q", ErrNotTeamOwner, err)
+	}
+	if err := call(owner, TeamTransferOwnership, `{"name":"transfer-team","username":"transfer-outsider"}`); err != ErrNotTeamMember {
+		t.Fatalf("Expected transfers to non-members to return %q, got %q", ErrNotTeamMember, err)
+	}
+	if err := call(owner, TeamTransferOwnership, `{"name":"transfer-team","username":"transfer-member"}`); err != nil {
+		t.Fatalf("TeamTransferOwnership errored with: %#v", err)
+	}
+
+	var team, _ = findTeamByName(db, "transfer-team")
+	if team.OwnerID != memberID {
+		t.Errorf("Expected the member to own the team, got owner %d", team.OwnerID)
+	}
+	var transfers = 0
+	db.QueryRow(`SELECT count(*) FROM events WHERE team_id = ? AND kind = ? AND actor_id = ? AND target_user_id = ?`, teamID, dash.EventOwnershipTransferred, ownerID, memberID).Scan(&transfers)
+	if transfers != 1 {
+		t.Errorf("Expected the transfer to be recorded in the team activity, got %d events", transfers)
+	}
+
+	if err := call(owner, TeamLeave, `{"name":"transfer-team"}`); err != nil {
+		t.Fatalf("Expected the previous owner to leave, got %q", err)
+	}
+	var members = 0
+	db.QueryRow(`SELECT count(*) FROM team_user WHERE team_id = ?`, teamID).Scan(&members)
+	if members != 1 {
+		t.Errorf("Expected only the new owner to remain, got %d members", members)
+	}
+}
+
+func TestTeamRemoveMember_DeparturePolicy(t *testing.T) {
+	var ownerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "departure-owner", "b")
+	var memberID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "departure-member", "b")
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "departure-team")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, ownerID, "owner")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Departure", "Departure", "c", "d", "e", "f", "g", "h", false)
+	var entryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "knowledge", "b", "b", "comment", identifierID, "c", memberID, false, false, 0)
+	exec(`INSERT INTO entry_team (entry_id, team_id) VALUES (?, ?)`, entryID, teamID)
+	// entries which are also public stay with their author
+	var publicEntryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "public knowledge", "b", "b", "comment", identifierID, "c", memberID, true, false, 0)
+	exec(`INSERT INTO entry_team (entry_id, team_id) VALUES (?, ?)`, publicEntryID, teamID)
+
+	var owner = dash.User{ID: ownerID, Username: "departure-owner"}
+	var call = func(handler ContextHandlerFunc, body string) error {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+		return WithTeam(handler).ServeHTTPContext(context.WithValue(rootCtx, UserKey, &owner), httptest.NewRecorder(), req)
+	}
+
+	if err := call(TeamSetDeparturePolicy, `{"name":"departure-team","departure_policy":"archive"}`); err != ErrInvalidDeparturePolicy {
+		t.Fatalf("Expected unknown policies to return %q, got %q", ErrInvalidDeparturePolicy, err)
+	}
+	for _, tc := range []struct {
+		policy         string
+		expectedUserID int
+		departed       bool
+	}{
+		{dash.DepartureKeep, memberID, true},
+		{dash.DepartureReassign, ownerID, false},
+	} {
+		if err := call(TeamSetDeparturePolicy, fmt.Sprintf(`{"name":"departure-team","departure_policy":%q}`, tc.policy)); err != nil {
+			t.Fatalf("TeamSetDeparturePolicy errored with: %#v", err)
+		}
+		if err := addTeamMember(db, teamID, memberID); err != nil {
+			t.Fatalf("addTeamMember errored with: %#v", err)
+		}
+		if entry, _ := findEntryByID(db, entryID); entry.AuthorDeparted {
+			t.Errorf("Expected rejoining to clear the former member mark")
+		}
+		if err := call(TeamRemoveMember, `{"name":"departure-team","username":"departure-member"}`); err != nil {
+			t.Fatalf("TeamRemoveMember errored with: %#v", err)
+		}
+
+		var entry, err = findEntryByID(db, entryID)
+		if err != nil {
+			t.Fatalf("Expected the entry to be kept with policy %q, got %v", tc.policy, err)
+		}
+		if entry.UserID != tc.expectedUserID || entry.AuthorDeparted != tc.departed || len(entry.Teams) != 1 {
+			t.Errorf("Expected policy %q to keep the entry for user %d, got %#v", tc.policy, tc.expectedUserID, entry)
+		}
+		if entry, _ := findEntryByID(db, publicEntryID); entry.UserID != memberID || !entry.AuthorDeparted || len(entry.Teams) != 1 {
+			t.Errorf("Expected policy %q to keep the public entry with its author, got %#v", tc.policy, entry)
+		}
+	}
+
+	if err := call(TeamSetDeparturePolicy, `{"name":"departure-team","departure_policy":"delete"}`); err != nil {
+		t.Fatalf("TeamSetDeparturePolicy errored with: %#v", err)
+	}
+	addTeamMember(db, teamID, memberID)
+	if err := call(TeamRemoveMember, `{"name":"departure-team","username":"departure-member"}`); err != nil {
+		t.Fatalf("TeamRemoveMember errored with: %#v", err)
+	}
+	if entry, err := findEntryByID(db, publicEntryID); err != nil || entry.UserID != memberID || len(entry.Teams) != 0 {
+		t.Errorf("Expected the public entry to only be unshared from the team, got %#v (%v)", entry, err)
+	}
+}
+
+func TestTeamRenameAndDelete(t *testing.T) {
+	var ownerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "rename-owner", "b")
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "rename-team")
+	var otherTeamID = exec(`INSERT INTO teams (name) VALUES (?)`, "rename-taken")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, ownerID, "owner")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, otherTeamID, ownerID, "owner")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Rename", "Rename", "c", "d", "e", "f", "g", "h", false)
+	var entryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "shared", "b", "b", "comment", identifierID, "c", ownerID, false, false, 0)
+	exec(`INSERT INTO entry_team (entry_id, team_id) VALUES (?, ?)`, entryID, teamID)
+
+	var owner = dash.User{ID: ownerID, Username: "rename-owner"}
+	var call = func(handler ContextHandlerFunc, body string) (*httptest.ResponseRecorder, error) {
+		var w = httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+		return w, WithTeam(handler).ServeHTTPContext(context.WithValue(rootCtx, UserKey, &owner), w, req)
+	}
+
+	if _, err := call(TeamRename, `{"name":"rename-team","new_name":"rename-taken"}`); err != ErrTeamNameExists {
+		t.Fatalf("Expected taken names to return %q, got %q", ErrTeamNameExists, err)
+	}
+	if _, err := call(TeamRename, `{"name":"rename-team","new_name":"renamed-team"}`); err != nil {
+		t.Fatalf("TeamRename errored with: %#v", err)
+	}
+	if entry, _ := findEntryByID(db, entryID); len(entry.Teams) != 1 || entry.Teams[0] != "renamed-team" {
+		t.Errorf("Expected the entry to stay shared with the renamed team, got %v", entry.Teams)
+	}
+
+	if _, err := call(TeamSetProfile, `{"name":"renamed-team","avatar_url":"javascript:alert(1)"}`); err != ErrInvalidAvatarURL {
+		t.Fatalf("Expected invalid avatars to return %q, got %q", ErrInvalidAvatarURL, err)
+	}
+	if _, err := call(TeamSetProfile, `{"name":"renamed-team","description":"docs people","avatar_url":"https://example.com/a.png"}`); err != nil {
+		t.Fatalf("TeamSetProfile errored with: %#v", err)
+	}
+	var w, err = call(TeamListMember, `{"name":"renamed-team"}`)
+	if err != nil {
+		t.Fatalf("TeamListMember errored with: %#v", err)
+	}
+	var list teamListMembersResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if list.Description != "docs people" || list.AvatarURL != "https://example.com/a.png" {
+		t.Errorf("Expected the profile to be listed, got %#v", list)
+	}
+
+	if _, err := call(TeamDelete, `{"name":"renamed-team"}`); err != nil {
+		t.Fatalf("TeamDelete errored with: %#v", err)
+	}
+	if _, err := findTeamByName(db, "renamed-team"); err == nil {
+		t.Errorf("Expected the team to be deleted")
+	}
+	if entry, err := findEntryByID(db, entryID); err != nil || len(entry.Teams) != 0 {
+		t.Errorf("Expected the entry to be kept without team, got %#v", entry)
+	}
+}
+
+func TestTeamModerator_ActivityLog(t *testing.T) {
+	var ownerID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "activity-owner", "b")
+	var moderatorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "activity-moderator", "b")
+	var otherModeratorID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "activity-other-moderator", "b")
+	var memberID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "activity-member", "b")
+	var teamID = exec(`INSERT INTO teams (name) VALUES (?)`, "activity-team")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, ownerID, "owner")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, moderatorID, "moderator")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, otherModeratorID, "moderator")
+	exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, memberID, "member")
+	var identifierID = exec(`INSERT INTO identifiers (docset_name, docset_filename, docset_platform, docset_bundle, docset_version, page_path, page_title, httrack_source, banned_from_public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, "Activity", "Activity", "c", "d", "e", "f", "g", "h", false)
+	var entryID = exec(`INSERT INTO entries (title, body, body_rendered, type, identifier_id, anchor, user_id, public, removed_from_public, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "shared", "b", "b", "comment", identifierID, "c", ownerID, false, false, 0)
+	exec(`INSERT INTO entry_team (entry_id, team_id) VALUES (?, ?)`, entryID, teamID)
+
+	if _, err := call(moderatorID, WithEntry(ContextHandlerFunc(EntrySave)), fmt.Sprintf(`{"entry_id":%d,"title":"edited","body":"b","anchor":"c","teams":["activity-team"]}`, entryID)); err != nil {
+		t.Fatalf("Expected moderators to edit team entries, got %q", err)
+	}
+	if _, err := call(moderatorID, WithTeam(ContextHandlerFunc(TeamRemoveMember)), `{"name":"activity-team","username":"activity-other-moderator"}`); err != ErrRemovePrivilegedMember {
+		t.Fatalf("Expected moderators not to remove moderators, got %q", err)
+	}
+	if _, err := call(moderatorID, WithTeam(ContextHandlerFunc(TeamRemoveMember)), `{"name":"activity-team","username":"activity-member"}`); err != nil {
+		t.Fatalf("Expected moderators to remove plain members, got %q", err)
+	}
+	if _, err := call(moderatorID, WithTeam(ContextHandlerFunc(TeamRemoveMember)), `{"name":"activity-team","username":"activity-member"}`); err != ErrNotTeamMember {
+		t.Fatalf("Expected removing a non-member to return %q, got %q", ErrNotTeamMember, err)
+	}
+	if _, err := call(ownerID, WithTeam(ContextHandlerFunc(TeamSetRole)), `{"name":"activity-team","username":"activity-other-moderator","role":"member"}`); err != nil {
+		t.Fatalf("TeamSetRole errored with: %#v", err)
+	}
+
+	if _, err := call(memberID, WithTeam(ContextHandlerFunc(TeamActivity)), `{"name":"activity-team"}`); err != ErrNotInTeam {
+		t.Fatalf("Expected former members not to see the activity log, got %q", err)
+	}
+	var w, err = call(moderatorID, WithTeam(ContextHandlerFunc(TeamActivity)), `{"name":"activity-team"}`)
+	if err != nil {
+		t.Fatalf("TeamActivity errored with: %#v", err)
+	}
+	var log teamActivityResponse
+	json.NewDecoder(w.Body).Decode(&log)
+
+	var expected = []dash.Activity{
+		{Kind: dash.EventRoleChanged, Actor: "activity-owner", Target: "activity-other-moderator", Detail: "member"},
+		{Kind: dash.EventMemberRemoved, Actor: "activity-moderator", Target: "activity-member"},
+		{Kind: dash.EventEntryUpdated, Actor: "activity-moderator", EntryID: entryID, EntryTitle: "edited"},
+	}
+	if len(log.Activities) != len(expected) {
+		t.Fatalf("Expected %d activities, got %#v", len(expected), log.Activities)
+	}
+	for i, activity := range log.Activities {
+		activity.ID, activity.CreatedAt = 0, expected[i].CreatedAt
+		if activity != expected[i] {
+			t.Errorf("Expected activity %d to be %#v, got %#v", i, expected[i], activity)
+		}
+	}
+}
@@ -59,6 +59,10 @@ func (store *sqlUserStorage) UpdateUserWithPassword(username, password string) e
 }
 
 func (store *sqlUserStorage) InsertUser(username, password string) error {
+	if username == ghostUsername {
+		return ErrUsernameExists
+	}
+
 	var existingUserID = -1
 	store.db.QueryRow(`SELECT id FROM users WHERE username = ?`, username).Scan(&existingUserID)
 	if existingUserID != -1 {
@@ -79,7 +83,12 @@ func (store *sqlUserStorage) UpdateUserWithEmail(username, email string) error {
 		return ErrEmailExists
 	}
 
-	if _, err := store.db.Exec(`UPDATE users SET email = ?, updated_at = ? WHERE username = ?`, email, time.Now(), username); err != nil {
+	// changing the address resets its verification; the verification state is updated before the email
+	// so both databases compare against the previous address
+	if _, err := store.db.Exec(`UPDATE users SET
+		email_verified = CASE WHEN email = ? THEN email_verified ELSE ? END,
+		email_verification_token = CASE WHEN email = ? THEN email_verification_token ELSE NULL END,
+		email = ?, updated_at = ? WHERE username = ?`, email, false, email, email, time.Now(), username); err != nil {
 		return err
 	}
 
@@ -90,17 +99,32 @@ func findUserByUsername(db *sql.DB, username string) (dash.User, error) {
 	return findUserByCondition(db, `username = ?`, username)
 }
 
+func findUserByID(db *sql.DB, id int) (dash.User, error) {
+	return findUserByCondition(db, `id = ?`, id)
+}
+
 func findUserByRememberToken(db *sql.DB, token string) (dash.User, error) {
 	return findUserByCondition(db, `remember_token = ?`, token)
 }
 
+// findUserByFeedToken returns the user the feed token was issued to. Only hashes of feed tokens are stored
+func findUserByFeedToken(db *sql.DB, token string) (dash.User, error) {
+	return findUserByCondition(db, `feed_token = ?`, hashFeedToken(token))
+}
+
 func findUserByCondition(db *sql.DB, cond string, param interface{}) (dash.User, error) {
 	var user = dash.User{}
-	if err := db.QueryRow(`SELECT id, username, email, password, remember_token, moderator FROM users WHERE `+cond, param).Scan(&user.ID, &user.Username, &user.Email, &user.EncryptedPassword, &user.RememberToken, &user.Moderator); err != nil {
+	if err := db.QueryRow(`SELECT id, username, email, email_verified, password, remember_token, moderator, admin, disabled, ghost, notify_mentions, notify_by_email FROM users WHERE `+cond, param).Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.EncryptedPassword, &user.RememberToken, &user.Moderator, &user.Admin, &user.Disabled, &user.Ghost, &user.NotifyMentions, &user.NotifyByEmail); err != nil {
 		return user, err
 	}
-
-	var rows, err = db.Query(`SELECT t.id, t.name, tm.role FROM team_user AS tm INNER JOIN teams AS t ON t.id = tm.team_id WHERE tm.user_id = ?`, user.ID)
+	// admins always have moderator rights
+	user.Moderator = user.Moderator || user.Admin
+
+	var rows, err = db.Query(`SELECT t.id, t.name, tm.role, COALESCE(tr.capabilities, '')
+		FROM team_user AS tm
+		INNER JOIN teams AS t ON t.id = tm.team_id
+		LEFT JOIN team_roles AS tr ON tr.team_id = tm.team_id AND tr.name = tm.role
+		WHERE tm.user_id = ?`, user.ID)
 	if err != nil {
 		return user, err
 	}
@@ -109,12 +133,41 @@ func findUserByCondition(db *sql.DB, cond string, param interface{}) (dash.User,
 	var memberships = make([]dash.TeamMember, 0)
 	for rows.Next() {
 		var membership = dash.TeamMember{}
-		if err := rows.Scan(&membership.TeamID, &membership.TeamName, &membership.Role); err != nil {
+		var capabilities string
+		if err := rows.Scan(&membership.TeamID, &membership.TeamName, &membership.Role, &capabilities); err != nil {
 			return user, err
 		}
+		membership.Capabilities = splitCapabilities(capabilities)
 		memberships = append(memberships, membership)
 	}
 
 	user.TeamMemberships = memberships
-	return user, nil
+
+	user.Organizations, err = findOrganizationMemberships(db, user.ID)
+	return user, err
+}
+
+// findOrganizationMemberships returns the organizations the user administers or is a member of through one of its teams
+func findOrganizationMemberships(db *sql.DB, userID int) ([]dash.OrganizationMembership, error) {
+	var rows, err = db.Query(`SELECT o.id, o.name, count(oa.id)
+		FROM organizations AS o
+		LEFT JOIN organization_admins AS oa ON oa.organization_id = o.id AND oa.user_id = ?
+		WHERE oa.id IS NOT NULL OR o.id IN (SELECT t.organization_id FROM teams AS t INNER JOIN team_user AS tm ON tm.team_id = t.id WHERE tm.user_id = ?)
+		GROUP BY o.id, o.name`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships = make([]dash.OrganizationMembership, 0)
+	for rows.Next() {
+		var membership = dash.OrganizationMembership{}
+		var admins int
+		if err := rows.Scan(&membership.OrganizationID, &membership.OrganizationName, &admins); err != nil {
+			return nil, err
+		}
+		membership.Admin = admins > 0
+		memberships = append(memberships, membership)
+	}
+	return memberships, nil
 }
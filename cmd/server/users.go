@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -14,15 +17,19 @@ import (
 
 var (
 	// ErrMissingUsername is returned for registration if missing the username parameter
-	ErrMissingUsername = errors.New("Missing parameter: username")
+	ErrMissingUsername = newAPIError(http.StatusUnprocessableEntity, "missing_username", "Missing parameter: username")
 	// ErrMissingPassword is returned for registration is missing the password parameter
-	ErrMissingPassword = errors.New("Missing parameter: password")
+	ErrMissingPassword = newAPIError(http.StatusUnprocessableEntity, "missing_password", "Missing parameter: password")
 	// ErrUsernameExists is returned for registration attempts where the username is taken
-	ErrUsernameExists = errors.New("A user with this username already exists")
+	ErrUsernameExists = newAPIError(http.StatusConflict, "username_exists", "A user with this username already exists")
 	// ErrInvalidLogin is returned if the login request fails, either because the username or password is wrong
-	ErrInvalidLogin = errors.New("Login failed: invalid username or password")
+	ErrInvalidLogin = newAPIError(http.StatusUnauthorized, "invalid_login", "Login failed: invalid username or password")
 	// ErrEmailExists is returned when a user wants to change his email to an already taken email address
-	ErrEmailExists = errors.New("A user with this email already exists")
+	ErrEmailExists = newAPIError(http.StatusConflict, "email_exists", "A user with this email already exists")
+	// ErrUserDisabled is returned when a disabled user tries to login or use an existing session
+	ErrUserDisabled = newAPIError(http.StatusForbidden, "user_disabled", "This account has been disabled")
+	// ErrInvalidVerificationToken is returned when an email verification token is unknown or was issued for a previous address
+	ErrInvalidVerificationToken = newAPIError(http.StatusUnprocessableEntity, "invalid_verification_token", "The verification token is invalid")
 )
 
 type userRegisterRequest struct {
@@ -98,6 +105,9 @@ func UserLogin(ctx context.Context, w http.ResponseWriter, req *http.Request) er
 	if !user.PasswordsMatch(payload.Password) {
 		return ErrInvalidLogin
 	}
+	if user.Disabled {
+		return ErrUserDisabled
+	}
 
 	var sessionID, _ = generateRandomString(32)
 
@@ -200,9 +210,91 @@ func UserChangeEmail(ctx context.Context, w http.ResponseWriter, req *http.Reque
 	if err := emailUpdater.UpdateUserWithEmail(user.Username, payload.Email); err != nil {
 		return err
 	}
+	if payload.Email != "" && (payload.Email != user.Email.String || !user.EmailVerified) {
+		if err := sendEmailVerification(ctx, user.ID, payload.Email); err != nil {
+			return err
+		}
+	}
 
 	json.NewEncoder(w).Encode(map[string]string{
 		"status": "success",
 	})
 	return nil
 }
+
+// sendEmailVerification issues a new verification token for the email address of the user and mails it to
+// that address. Only the hash of the token is stored
+func sendEmailVerification(ctx context.Context, userID int, email string) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+
+	var token, err = generateRandomString(24)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE users SET email_verification_token = ?, updated_at = ? WHERE id = ?`, hashFeedToken(token), time.Now(), userID); err != nil {
+		return err
+	}
+	return mailerFromContext(ctx).SendMail(email, "Verify your email address",
+		fmt.Sprintf("Use the following token to verify your email address via /users/email/verify:\n\n%s\n", token))
+}
+
+type userVerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// UserVerifyEmail marks the email address of the current user as verified using the token mailed to it
+func UserVerifyEmail(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var payload userVerifyEmailRequest
+	json.NewDecoder(req.Body).Decode(&payload)
+	if payload.Token == "" {
+		return ErrInvalidVerificationToken
+	}
+
+	var res, err = db.Exec(`UPDATE users SET email_verified = ?, email_verification_token = NULL, updated_at = ? WHERE id = ? AND email_verification_token = ?`, true, time.Now(), user.ID, hashFeedToken(payload.Token))
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrInvalidVerificationToken
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+	return nil
+}
+
+// hashFeedToken returns the value stored for a feed token or an email verification token
+func hashFeedToken(token string) string {
+	var sum = sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type userFeedTokenResponse struct {
+	Status    string `json:"status"`
+	FeedToken string `json:"feed_token"`
+}
+
+// UserFeedToken issues a new feed token for the current user, used to authenticate feed readers. Previously
+// issued feed tokens stop working
+func UserFeedToken(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	var db = ctx.Value(DBKey).(*sql.DB)
+	var user = ctx.Value(UserKey).(*dash.User)
+
+	var token, err = generateRandomString(24)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE users SET feed_token = ?, updated_at = ? WHERE id = ?`, hashFeedToken(token), time.Now(), user.ID); err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(userFeedTokenResponse{
+		Status:    "success",
+		FeedToken: token,
+	})
+	return nil
+}
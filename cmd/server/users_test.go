@@ -260,3 +260,43 @@ func TestUserChangeEmail_HappyPath(t *testing.T) {
 		t.Errorf("Expected status of %q to be %q", data["status"], "success")
 	}
 }
+
+func TestUserVerifyEmail(t *testing.T) {
+	var userID = exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "verify-tester", "b")
+	var user, _ = findUserByID(db, userID)
+
+	var mailer = &mockMailer{}
+	var ctx = context.WithValue(rootCtx, UserKey, &user)
+	ctx = context.WithValue(ctx, UserStoreKey, &sqlUserStorage{db: db})
+	ctx = context.WithValue(ctx, MailerKey, mailer)
+
+	req, _ := http.NewRequest("POST", "/users/email", strings.NewReader(`{"email":"verify@example.com"}`))
+	if err := UserChangeEmail(ctx, httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("UserChangeEmail errored with: %#v", err)
+	}
+	if len(mailer.bodies) != 1 || mailer.recipients[0] != "verify@example.com" {
+		t.Fatalf("Expected a verification mail to the new address, got %#v", mailer.recipients)
+	}
+	var lines = strings.Split(strings.TrimSpace(mailer.bodies[0]), "\n")
+	var token = lines[len(lines)-1]
+
+	req, _ = http.NewRequest("POST", "/users/email/verify", strings.NewReader(`{"token":"wrong"}`))
+	if err := UserVerifyEmail(ctx, httptest.NewRecorder(), req); err != ErrInvalidVerificationToken {
+		t.Errorf("Expected unknown tokens to be rejected with %q, got %q", ErrInvalidVerificationToken, err)
+	}
+	req, _ = http.NewRequest("POST", "/users/email/verify", strings.NewReader(`{"token":"`+token+`"}`))
+	if err := UserVerifyEmail(ctx, httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("UserVerifyEmail errored with: %#v", err)
+	}
+	if user, _ = findUserByID(db, userID); !user.EmailVerified {
+		t.Errorf("Expected the email address to be verified")
+	}
+
+	req, _ = http.NewRequest("POST", "/users/email", strings.NewReader(`{"email":"other@example.com"}`))
+	if err := UserChangeEmail(ctx, httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("UserChangeEmail errored with: %#v", err)
+	}
+	if user, _ = findUserByID(db, userID); user.EmailVerified {
+		t.Errorf("Expected changing the email address to reset its verification")
+	}
+}
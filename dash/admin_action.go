@@ -0,0 +1,37 @@
+package dash
+
+import "time"
+
+const (
+	// AdminPromoteModerator grants global moderation rights
+	AdminPromoteModerator = "promote_moderator"
+	// AdminDemoteModerator revokes global moderation rights
+	AdminDemoteModerator = "demote_moderator"
+	// AdminGrantAdmin grants the admin role
+	AdminGrantAdmin = "grant_admin"
+	// AdminSuspendUser prevents a user from logging in
+	AdminSuspendUser = "suspend_user"
+	// AdminUnsuspendUser allows a suspended user to login again
+	AdminUnsuspendUser = "unsuspend_user"
+)
+
+const (
+	// SourceAPI marks changes done via the http api
+	SourceAPI = "api"
+	// SourceCLI marks changes done via command line subcommands
+	SourceCLI = "cli"
+	// SourceBootstrap marks changes done while starting the server
+	SourceBootstrap = "bootstrap"
+	// SourceSCIM marks changes done by an identity provider via the SCIM provisioning api
+	SourceSCIM = "scim"
+)
+
+// AdminAction is an audit log record of a change to the global roles or the suspension of a user
+type AdminAction struct {
+	ID             int       `json:"id"`
+	Action         string    `json:"action"`
+	Source         string    `json:"source"`
+	ActorUsername  string    `json:"actor,omitempty"`
+	TargetUsername string    `json:"target"`
+	CreatedAt      time.Time `json:"created_at"`
+}
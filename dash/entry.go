@@ -8,13 +8,16 @@ type Entry struct {
 	Body              string     `json:"-"`
 	BodyRendered      string     `json:"-"`
 	Public            bool       `json:"public"`
+	Draft             bool       `json:"draft"`
 	Type              string     `json:"type"`
 	Teams             []string   `json:"teams"`
+	Organization      string     `json:"organization,omitempty"`
 	Identifier        Identifier `json:"-"`
 	IdentifierID      int        `json:"-"`
 	Anchor            string     `json:"anchor"`
 	UserID            int        `json:"-"`
 	AuthorUsername    string     `json:"-"`
+	AuthorDeparted    bool       `json:"-"`
 	Score             int        `json:"score"`
 	RemovedFromPublic bool       `json:"-"`
 	UpdatedAt         time.Time  `json:"updated_at"`
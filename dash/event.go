@@ -0,0 +1,57 @@
+package dash
+
+import "time"
+
+const (
+	// EventEntryCreated is recorded when a new entry was created
+	EventEntryCreated = "entry_created"
+	// EventEntryUpdated is recorded when an existing entry was changed
+	EventEntryUpdated = "entry_updated"
+	// EventEntryPublished is recorded when a draft was published
+	EventEntryPublished = "entry_published"
+	// EventEntryVoted is recorded when a user voted on an entry
+	EventEntryVoted = "entry_voted"
+	// EventMemberRemoved is recorded when a member was removed from a team
+	EventMemberRemoved = "member_removed"
+	// EventRoleChanged is recorded when the role of a team member was changed
+	EventRoleChanged = "role_changed"
+	// EventOwnershipTransferred is recorded when a team was handed over to another member
+	EventOwnershipTransferred = "ownership_transferred"
+	// EventInvitationCreated is recorded when an invitation to a team was created
+	EventInvitationCreated = "invitation_created"
+	// EventInvitationRevoked is recorded when an invitation to a team was revoked
+	EventInvitationRevoked = "invitation_revoked"
+	// EventJoinRequestApproved is recorded when a request to join a team was approved
+	EventJoinRequestApproved = "join_request_approved"
+	// EventJoinRequestRejected is recorded when a request to join a team was rejected
+	EventJoinRequestRejected = "join_request_rejected"
+	// EventMemberJoined is recorded when a user joined a team
+	EventMemberJoined = "member_joined"
+	// EventMemberLeft is recorded when a member left a team
+	EventMemberLeft = "member_left"
+)
+
+// Event records activity of users, e.g. creating or voting on entries
+type Event struct {
+	ID           int
+	Kind         string
+	ActorID      int
+	EntryID      int
+	IdentifierID int
+	TeamID       int
+	TargetUserID int
+	Detail       string
+	CreatedAt    time.Time
+}
+
+// Activity is an event as listed in the team activity feed
+type Activity struct {
+	ID         int       `json:"id"`
+	Kind       string    `json:"kind"`
+	Actor      string    `json:"actor"`
+	Target     string    `json:"target,omitempty"`
+	EntryID    int       `json:"entry_id,omitempty"`
+	EntryTitle string    `json:"entry_title,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package dash
+
+import "time"
+
+const (
+	// ExportPending marks exports which are still being generated
+	ExportPending = "pending"
+	// ExportReady marks exports which can be downloaded
+	ExportReady = "ready"
+	// ExportFailed marks exports which could not be generated
+	ExportFailed = "failed"
+	// ExportExpired marks exports whose archive was removed after the download link expired
+	ExportExpired = "expired"
+)
+
+// Export is an archive of all personal data the server holds about a user
+type Export struct {
+	ID          int        `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,32 @@
+package dash
+
+import "time"
+
+const (
+	// FlagOpen marks flags which still need a moderator decision
+	FlagOpen = "open"
+	// FlagResolved marks flags a moderator decided on
+	FlagResolved = "resolved"
+)
+
+const (
+	// ResolutionDismiss keeps the flagged entry unchanged
+	ResolutionDismiss = "dismiss"
+	// ResolutionRemoveFromPublic hides the flagged entry from the public
+	ResolutionRemoveFromPublic = "remove_from_public"
+	// ResolutionRemoveFromTeam hides the flagged entry from the teams of the moderator
+	ResolutionRemoveFromTeam = "remove_from_team"
+	// ResolutionDelete removes the flagged entry entirely
+	ResolutionDelete = "delete"
+)
+
+// Flag is a report of an entry by a user, which needs to be reviewed by moderators
+type Flag struct {
+	ID               int       `json:"id"`
+	EntryID          int       `json:"entry_id"`
+	EntryTitle       string    `json:"entry_title"`
+	ReporterUsername string    `json:"reporter"`
+	Reason           string    `json:"reason"`
+	Status           string    `json:"status"`
+	CreatedAt        time.Time `json:"created_at"`
+}
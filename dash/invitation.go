@@ -0,0 +1,15 @@
+package dash
+
+import "time"
+
+// Invitation allows users to join a team without knowing its access key
+type Invitation struct {
+	ID        int        `json:"id"`
+	CreatedBy string     `json:"created_by"`
+	Email     string     `json:"email,omitempty"`
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package dash
+
+import "time"
+
+const (
+	// JoinRequestPending marks requests waiting for a team moderator decision
+	JoinRequestPending = "pending"
+	// JoinRequestApproved marks requests which turned into a membership
+	JoinRequestApproved = "approved"
+	// JoinRequestRejected marks requests a team moderator declined
+	JoinRequestRejected = "rejected"
+)
+
+// JoinRequest is a pending membership of a team requiring join approval
+type JoinRequest struct {
+	Username  string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,34 @@
+package dash
+
+import "time"
+
+const (
+	// ModerationRemoveFromPublic hides an entry from the public
+	ModerationRemoveFromPublic = "remove_from_public"
+	// ModerationRestoreToPublic undoes ModerationRemoveFromPublic
+	ModerationRestoreToPublic = "restore_to_public"
+	// ModerationRemoveFromTeam hides an entry from a team
+	ModerationRemoveFromTeam = "remove_from_team"
+	// ModerationRestoreToTeam undoes ModerationRemoveFromTeam
+	ModerationRestoreToTeam = "restore_to_team"
+	// ModerationDismissFlag closes a flag without touching the entry
+	ModerationDismissFlag = "dismiss_flag"
+	// ModerationDelete removes an entry entirely
+	ModerationDelete = "delete"
+)
+
+// ModerationAction is an audit log record of a single moderator decision
+type ModerationAction struct {
+	ID                int       `json:"id"`
+	Action            string    `json:"action"`
+	ActorID           int       `json:"-"`
+	ModeratorUsername string    `json:"moderator"`
+	EntryID           int       `json:"entry_id"`
+	EntryTitle        string    `json:"entry_title"`
+	TeamID            int       `json:"-"`
+	TeamName          string    `json:"team,omitempty"`
+	Reason            string    `json:"reason"`
+	Before            string    `json:"before"`
+	After             string    `json:"after"`
+	CreatedAt         time.Time `json:"created_at"`
+}
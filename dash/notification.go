@@ -0,0 +1,20 @@
+package dash
+
+import "time"
+
+const (
+	// NotificationMention is used when a user was mentioned inside an entry
+	NotificationMention = "mention"
+)
+
+// Notification informs a user about activity concerning him
+type Notification struct {
+	ID            int       `json:"id"`
+	UserID        int       `json:"-"`
+	Kind          string    `json:"kind"`
+	EntryID       int       `json:"entry_id"`
+	EntryTitle    string    `json:"entry_title"`
+	ActorUsername string    `json:"actor"`
+	Read          bool      `json:"read"`
+	CreatedAt     time.Time `json:"created_at"`
+}
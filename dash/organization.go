@@ -0,0 +1,34 @@
+package dash
+
+import "time"
+
+const (
+	// VisibilityTeam keeps entries shared with the teams of an organization visible to these teams only
+	VisibilityTeam = "team"
+	// VisibilityOrganization makes entries shared with the teams of an organization visible to the whole organization
+	VisibilityOrganization = "organization"
+)
+
+// Organization groups teams under shared administration
+type Organization struct {
+	ID                        int
+	Name                      string
+	DefaultEncryptedAccessKey string
+	DefaultVisibility         string
+	CreatedAt                 time.Time
+	UpdatedAt                 time.Time
+}
+
+// OrganizationMembership is the membership of a user in an organization, either through a team or as admin
+type OrganizationMembership struct {
+	OrganizationID   int    `json:"-"`
+	OrganizationName string `json:"name"`
+	Admin            bool   `json:"admin"`
+}
+
+// OrganizationMember is an entry of the organization wide member directory
+type OrganizationMember struct {
+	Username string   `json:"name"`
+	Admin    bool     `json:"admin"`
+	Teams    []string `json:"teams"`
+}
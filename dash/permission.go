@@ -0,0 +1,56 @@
+package dash
+
+const (
+	// RoleOwner is the role of the team owner, granting every capability
+	RoleOwner = "owner"
+	// RoleModerator is the built-in role of team moderators
+	RoleModerator = "moderator"
+	// RoleMember is the built-in role of team members without further capabilities
+	RoleMember = "member"
+)
+
+const (
+	// CapabilityManageTeam allows changing the settings, roles and ownership of a team. Only owners hold it
+	CapabilityManageTeam = "manage_team"
+	// CapabilityInvite allows inviting users and deciding on join requests
+	CapabilityInvite = "invite"
+	// CapabilityRemoveMember allows removing members with the plain member role from the team
+	CapabilityRemoveMember = "remove_member"
+	// CapabilityModerateEntries allows approving entries shared with the team and removing them from it
+	CapabilityModerateEntries = "moderate_entries"
+	// CapabilityEditEntries allows editing entries of other members shared with the team
+	CapabilityEditEntries = "edit_entries"
+	// CapabilityViewMembers allows listing the members and pending join requests of the team
+	CapabilityViewMembers = "view_members"
+)
+
+// GrantableCapabilities lists the capabilities custom team roles can grant
+var GrantableCapabilities = []string{
+	CapabilityInvite,
+	CapabilityRemoveMember,
+	CapabilityModerateEntries,
+	CapabilityEditEntries,
+	CapabilityViewMembers,
+}
+
+// BuiltinRoles maps the roles every team has to the capabilities they grant
+var BuiltinRoles = map[string][]string{
+	RoleOwner:     append([]string{CapabilityManageTeam}, GrantableCapabilities...),
+	RoleModerator: GrantableCapabilities,
+	RoleMember:    {},
+}
+
+// Can reports whether the role of the membership grants the capability. Custom roles grant the
+// capabilities configured for the team
+func (m TeamMember) Can(capability string) bool {
+	var capabilities, builtin = BuiltinRoles[m.Role]
+	if !builtin {
+		capabilities = m.Capabilities
+	}
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
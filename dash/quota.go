@@ -0,0 +1,28 @@
+package dash
+
+const (
+	// QuotaEntriesPerDay limits how many entries a user can create within 24 hours
+	QuotaEntriesPerDay = "entries_per_day"
+	// QuotaMaxBodySize limits the size of entry bodies in bytes
+	QuotaMaxBodySize = "max_body_size"
+	// QuotaTeamsPerUser limits how many teams a user can own
+	QuotaTeamsPerUser = "teams_per_user"
+	// QuotaMembersPerTeam limits how many members a team can have
+	QuotaMembersPerTeam = "members_per_team"
+)
+
+// Quotas limits the resources users and teams can use. A limit of 0 means unlimited
+type Quotas struct {
+	EntriesPerDay  int `json:"entries_per_day"`
+	MaxBodySize    int `json:"max_body_size"`
+	TeamsPerUser   int `json:"teams_per_user"`
+	MembersPerTeam int `json:"members_per_team"`
+}
+
+// QuotaOverride replaces a quota for a single user or team
+type QuotaOverride struct {
+	Username string `json:"username,omitempty"`
+	Team     string `json:"team,omitempty"`
+	Quota    string `json:"quota"`
+	Limit    int    `json:"limit"`
+}
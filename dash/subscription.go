@@ -0,0 +1,22 @@
+package dash
+
+import "time"
+
+const (
+	// DigestDaily sends a digest once per day
+	DigestDaily = "daily"
+	// DigestWeekly sends a digest once per week
+	DigestWeekly = "weekly"
+)
+
+// Subscription allows users to follow either a whole docset or a single page of a docset
+type Subscription struct {
+	ID             int         `json:"id"`
+	UserID         int         `json:"-"`
+	DocsetFilename string      `json:"docset_filename"`
+	IdentifierID   int         `json:"-"`
+	Identifier     *Identifier `json:"identifier,omitempty"`
+	Frequency      string      `json:"frequency"`
+	LastDigestAt   time.Time   `json:"last_digest_at"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
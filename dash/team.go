@@ -6,6 +6,15 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// DepartureDelete deletes the entries a departing member shared only with the team, and unshares the others
+	DepartureDelete = "delete"
+	// DepartureReassign hands the entries a departing member shared only with the team over to the team owner
+	DepartureReassign = "reassign"
+	// DepartureKeep keeps the entries a departing member shared with the team, marked as by a former member
+	DepartureKeep = "keep"
+)
+
 type Team struct {
 	ID                 int
 	Name               string
@@ -13,6 +22,15 @@ type Team struct {
 	OwnerID            int
 	CreatedAt          time.Time
 	UpdatedAt          time.Time
+
+	// RequiresJoinApproval turns joining into a request moderators need to approve
+	RequiresJoinApproval bool
+	// DeparturePolicy decides what happens to the entries of members leaving the team
+	DeparturePolicy string
+	Description     string
+	AvatarURL       string
+	// OrganizationID is the organization owning the team, or 0
+	OrganizationID int
 }
 
 func (t *Team) ChangeAccessKey(newKey string) {
@@ -8,15 +8,26 @@ import (
 )
 
 type User struct {
-	ID                int
-	Username          string
-	Email             sql.NullString
+	ID       int
+	Username string
+	Email    sql.NullString
+	// EmailVerified is set once the user confirmed the email address with the token mailed to it
+	EmailVerified     bool
 	EncryptedPassword string
 	RememberToken     sql.NullString
 	TeamMemberships   []TeamMember
 	Moderator         bool
-	UpdatedAt         time.Time
-	CreatedAt         time.Time
+	Admin             bool
+	Disabled          bool
+	// Ghost marks the reserved user taking over entries and audit records of deleted accounts
+	Ghost          bool
+	NotifyMentions bool
+	NotifyByEmail  bool
+	UpdatedAt      time.Time
+	CreatedAt      time.Time
+
+	// Organizations lists the organizations the user belongs to through a team or as admin
+	Organizations []OrganizationMembership
 }
 
 func (u *User) ChangePassword(newPassword string) {
@@ -34,4 +45,6 @@ type TeamMember struct {
 	TeamName string `json:"name"`
 	Role     string `json:"role"`
 	UserID   int    `json:"-"`
+	// Capabilities are granted by custom roles of the team
+	Capabilities []string `json:"-"`
 }
@@ -0,0 +1,29 @@
+package scim
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFilter is returned for filters other than a single equality comparison
+var ErrInvalidFilter = errors.New("Only filters of the form attribute eq \"value\" are supported")
+
+// ParseFilter parses filters of the form `userName eq "jane"`, the only filters identity providers use to look
+// up existing resources. Attribute names are case insensitive and returned in lower case
+func ParseFilter(filter string) (Filter, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return Filter{}, nil
+	}
+
+	var parts = strings.SplitN(filter, " ", 3)
+	if len(parts) != 3 || !strings.EqualFold(parts[1], "eq") {
+		return Filter{}, ErrInvalidFilter
+	}
+	var value, err = strconv.Unquote(strings.TrimSpace(parts[2]))
+	if err != nil {
+		return Filter{}, ErrInvalidFilter
+	}
+	return Filter{Attribute: strings.ToLower(parts[0]), Value: value}, nil
+}
@@ -0,0 +1,360 @@
+package scim
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxResults is the maximum number of resources returned per list request
+const maxResults = 200
+
+// ErrUnauthorized is returned for requests without the provisioning token
+var ErrUnauthorized = errors.New("Missing or invalid provisioning token")
+
+type errorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+type listResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// Handler serves the /Users, /Groups and /ServiceProviderConfig endpoints. Mount it with the base path
+// stripped, e.g. via http.StripPrefix("/scim/v2", handler)
+type Handler struct {
+	provider Provider
+	token    string
+}
+
+// NewHandler returns a handler storing resources in the provider. Requests need to authenticate with the
+// token as bearer token
+func NewHandler(provider Provider, token string) *Handler {
+	return &Handler{provider: provider, token: token}
+}
+
+// writeJSON encodes the value as SCIM response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError maps errors to SCIM error responses. Errors not caused by the request are logged and hidden
+func writeError(w http.ResponseWriter, err error) {
+	var status, scimType, detail = http.StatusInternalServerError, "", "Internal server error"
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		status, detail = http.StatusUnauthorized, err.Error()
+	case errors.Is(err, ErrNotFound):
+		status, detail = http.StatusNotFound, err.Error()
+	case errors.Is(err, ErrUniqueness):
+		status, scimType, detail = http.StatusConflict, "uniqueness", err.Error()
+	case errors.Is(err, ErrInvalidFilter):
+		status, scimType, detail = http.StatusBadRequest, "invalidFilter", err.Error()
+	case errors.Is(err, ErrInvalidPatch):
+		status, scimType, detail = http.StatusBadRequest, "invalidSyntax", err.Error()
+	case errors.Is(err, ErrInvalidValue):
+		status, scimType, detail = http.StatusBadRequest, "invalidValue", err.Error()
+	default:
+		log.Printf("scim: %v\n", err)
+	}
+	writeJSON(w, status, errorResponse{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+// authorized reports whether the request carries the provisioning token
+func (h *Handler) authorized(req *http.Request) bool {
+	var header = req.Header.Get("Authorization")
+	if h.token == "" || !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(h.token)) == 1
+}
+
+// ServeHTTP routes the request to the resource endpoints
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !h.authorized(req) {
+		writeError(w, ErrUnauthorized)
+		return
+	}
+
+	var parts = strings.SplitN(strings.Trim(req.URL.Path, "/"), "/", 2)
+	var id = ""
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+
+	var err error
+	switch parts[0] {
+	case "Users":
+		err = h.serveUsers(w, req, id)
+	case "Groups":
+		err = h.serveGroups(w, req, id)
+	case "ServiceProviderConfig":
+		h.serveServiceProviderConfig(w)
+	default:
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+// page returns the requested page of the resources, using the 1-based startIndex and count parameters
+func page(req *http.Request, total int) (int, int, int) {
+	var startIndex, err = strconv.Atoi(req.URL.Query().Get("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	var count int
+	if count, err = strconv.Atoi(req.URL.Query().Get("count")); err != nil || count > maxResults {
+		count = maxResults
+	}
+	if count < 0 {
+		count = 0
+	}
+	var from = startIndex - 1
+	if from > total {
+		from = total
+	}
+	var to = from + count
+	if to > total {
+		to = total
+	}
+	return startIndex, from, to
+}
+
+func userResponse(user User) User {
+	user.Schemas = []string{SchemaUser}
+	user.Password = ""
+	user.Meta = &Meta{ResourceType: "User"}
+	return user
+}
+
+func groupResponse(group Group) Group {
+	group.Schemas = []string{SchemaGroup}
+	if group.Members == nil {
+		group.Members = []Member{}
+	}
+	group.Meta = &Meta{ResourceType: "Group"}
+	return group
+}
+
+// decodeUser reads a user from the request body. Users are active unless stated otherwise
+func decodeUser(req *http.Request) (User, error) {
+	var user = User{Active: true}
+	if err := json.NewDecoder(req.Body).Decode(&user); err != nil {
+		return user, ErrInvalidValue
+	}
+	return user, nil
+}
+
+func (h *Handler) serveUsers(w http.ResponseWriter, req *http.Request, id string) error {
+	switch {
+	case req.Method == http.MethodGet && id == "":
+		var filter, err = ParseFilter(req.URL.Query().Get("filter"))
+		if err != nil {
+			return err
+		}
+		var users []User
+		if users, err = h.provider.Users(filter); err != nil {
+			return err
+		}
+		var startIndex, from, to = page(req, len(users))
+		var resources = make([]User, 0, to-from)
+		for _, user := range users[from:to] {
+			resources = append(resources, userResponse(user))
+		}
+		writeJSON(w, http.StatusOK, listResponse{
+			Schemas:      []string{SchemaListResponse},
+			TotalResults: len(users),
+			StartIndex:   startIndex,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		})
+	case req.Method == http.MethodPost && id == "":
+		var user, err = decodeUser(req)
+		if err != nil {
+			return err
+		}
+		if user, err = h.provider.CreateUser(user); err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusCreated, userResponse(user))
+	case req.Method == http.MethodGet:
+		var user, err = h.provider.User(id)
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, userResponse(user))
+	case req.Method == http.MethodPut:
+		var user, err = decodeUser(req)
+		if err != nil {
+			return err
+		}
+		if user, err = h.provider.ReplaceUser(id, user); err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, userResponse(user))
+	case req.Method == http.MethodPatch:
+		var patch PatchRequest
+		if err := json.NewDecoder(req.Body).Decode(&patch); err != nil {
+			return ErrInvalidPatch
+		}
+		var user, err = h.provider.User(id)
+		if err != nil {
+			return err
+		}
+		if err := ApplyUserPatch(&user, patch.Operations); err != nil {
+			return err
+		}
+		if user, err = h.provider.ReplaceUser(id, user); err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, userResponse(user))
+	case req.Method == http.MethodDelete:
+		if err := h.provider.DeleteUser(id); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (h *Handler) serveGroups(w http.ResponseWriter, req *http.Request, id string) error {
+	switch {
+	case req.Method == http.MethodGet && id == "":
+		var filter, err = ParseFilter(req.URL.Query().Get("filter"))
+		if err != nil {
+			return err
+		}
+		var groups []Group
+		if groups, err = h.provider.Groups(filter); err != nil {
+			return err
+		}
+		var startIndex, from, to = page(req, len(groups))
+		var resources = make([]Group, 0, to-from)
+		for _, group := range groups[from:to] {
+			resources = append(resources, groupResponse(group))
+		}
+		writeJSON(w, http.StatusOK, listResponse{
+			Schemas:      []string{SchemaListResponse},
+			TotalResults: len(groups),
+			StartIndex:   startIndex,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		})
+	case req.Method == http.MethodPost && id == "":
+		var group Group
+		if err := json.NewDecoder(req.Body).Decode(&group); err != nil {
+			return ErrInvalidValue
+		}
+		var group2, err = h.provider.CreateGroup(group)
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusCreated, groupResponse(group2))
+	case req.Method == http.MethodGet:
+		var group, err = h.provider.Group(id)
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, groupResponse(group))
+	case req.Method == http.MethodPut:
+		var group Group
+		if err := json.NewDecoder(req.Body).Decode(&group); err != nil {
+			return ErrInvalidValue
+		}
+		var replaced, err = h.provider.ReplaceGroup(id, group)
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, groupResponse(replaced))
+	case req.Method == http.MethodPatch:
+		var patch PatchRequest
+		if err := json.NewDecoder(req.Body).Decode(&patch); err != nil {
+			return ErrInvalidPatch
+		}
+		var group, err = h.provider.Group(id)
+		if err != nil {
+			return err
+		}
+		if err := ApplyGroupPatch(&group, patch.Operations); err != nil {
+			return err
+		}
+		if group, err = h.provider.ReplaceGroup(id, group); err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, groupResponse(group))
+	case req.Method == http.MethodDelete:
+		if err := h.provider.DeleteGroup(id); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		return ErrNotFound
+	}
+	return nil
+}
+
+type supported struct {
+	Supported bool `json:"supported"`
+}
+
+type filterSupported struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type authenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type serviceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 supported              `json:"patch"`
+	Bulk                  supported              `json:"bulk"`
+	Filter                filterSupported        `json:"filter"`
+	ChangePassword        supported              `json:"changePassword"`
+	Sort                  supported              `json:"sort"`
+	ETag                  supported              `json:"etag"`
+	AuthenticationSchemes []authenticationScheme `json:"authenticationSchemes"`
+}
+
+// serveServiceProviderConfig describes the supported features to identity providers
+func (h *Handler) serveServiceProviderConfig(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, serviceProviderConfig{
+		Schemas:        []string{SchemaServiceProviderConfig},
+		Patch:          supported{true},
+		Bulk:           supported{false},
+		Filter:         filterSupported{true, maxResults},
+		ChangePassword: supported{false},
+		Sort:           supported{false},
+		ETag:           supported{false},
+		AuthenticationSchemes: []authenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Provisioning token",
+			Description: "Authentication with the provisioning token configured on the server",
+		}},
+	})
+}
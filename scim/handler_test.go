@@ -0,0 +1,304 @@
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// memoryProvider stores resources in memory, assigning sequential ids
+type memoryProvider struct {
+	users  []User
+	groups []Group
+	nextID map[string]int
+}
+
+func newMemoryProvider() *memoryProvider {
+	return &memoryProvider{nextID: map[string]int{}}
+}
+
+func (p *memoryProvider) id(kind string) string {
+	p.nextID[kind]++
+	return strconv.Itoa(p.nextID[kind])
+}
+
+func (p *memoryProvider) findUser(id string) int {
+	for i, user := range p.users {
+		if user.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *memoryProvider) Users(filter Filter) ([]User, error) {
+	var users = []User{}
+	for _, user := range p.users {
+		if filter.Attribute == "" || (filter.Attribute == "username" && user.UserName == filter.Value) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (p *memoryProvider) User(id string) (User, error) {
+	var i = p.findUser(id)
+	if i == -1 {
+		return User{}, ErrNotFound
+	}
+	return p.users[i], nil
+}
+
+func (p *memoryProvider) CreateUser(user User) (User, error) {
+	if existing, _ := p.Users(Filter{Attribute: "username", Value: user.UserName}); len(existing) > 0 {
+		return User{}, ErrUniqueness
+	}
+	user.ID = p.id("user")
+	p.users = append(p.users, user)
+	return user, nil
+}
+
+func (p *memoryProvider) ReplaceUser(id string, user User) (User, error) {
+	var i = p.findUser(id)
+	if i == -1 {
+		return User{}, ErrNotFound
+	}
+	user.ID = id
+	p.users[i] = user
+	return user, nil
+}
+
+func (p *memoryProvider) DeleteUser(id string) error {
+	var i = p.findUser(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+	p.users = append(p.users[:i], p.users[i+1:]...)
+	return nil
+}
+
+func (p *memoryProvider) findGroup(id string) int {
+	for i, group := range p.groups {
+		if group.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveMembers fills in the display names of the members, rejecting unknown users
+func (p *memoryProvider) resolveMembers(group *Group) error {
+	for i, member := range group.Members {
+		var user, err = p.User(member.Value)
+		if err != nil {
+			return ErrInvalidValue
+		}
+		group.Members[i].Display = user.UserName
+	}
+	return nil
+}
+
+func (p *memoryProvider) Groups(filter Filter) ([]Group, error) {
+	var groups = []Group{}
+	for _, group := range p.groups {
+		if filter.Attribute == "" || (filter.Attribute == "displayname" && group.DisplayName == filter.Value) {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+func (p *memoryProvider) Group(id string) (Group, error) {
+	var i = p.findGroup(id)
+	if i == -1 {
+		return Group{}, ErrNotFound
+	}
+	var group = p.groups[i]
+	group.Members = append([]Member{}, group.Members...)
+	return group, nil
+}
+
+func (p *memoryProvider) CreateGroup(group Group) (Group, error) {
+	if err := p.resolveMembers(&group); err != nil {
+		return Group{}, err
+	}
+	group.ID = p.id("group")
+	p.groups = append(p.groups, group)
+	return group, nil
+}
+
+func (p *memoryProvider) ReplaceGroup(id string, group Group) (Group, error) {
+	var i = p.findGroup(id)
+	if i == -1 {
+		return Group{}, ErrNotFound
+	}
+	if err := p.resolveMembers(&group); err != nil {
+		return Group{}, err
+	}
+	group.ID = id
+	p.groups[i] = group
+	return group, nil
+}
+
+func (p *memoryProvider) DeleteGroup(id string) error {
+	var i = p.findGroup(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+	p.groups = append(p.groups[:i], p.groups[i+1:]...)
+	return nil
+}
+
+// recording is a request sent by an identity provider together with the expected response
+type recording struct {
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Body     json.RawMessage `json:"body"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// normalize decodes JSON so documents can be compared independent of formatting and key order
+func normalize(t *testing.T, data []byte) interface{} {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatalf("Invalid JSON %q: %v", data, err)
+	}
+	return value
+}
+
+func TestHandler_Recordings(t *testing.T) {
+	var files, _ = filepath.Glob(filepath.Join("testdata", "*.json"))
+	if len(files) == 0 {
+		t.Fatal("Expected recordings in testdata")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			var data, err = os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var recordings []recording
+			if err := json.Unmarshal(data, &recordings); err != nil {
+				t.Fatal(err)
+			}
+
+			var handler = NewHandler(newMemoryProvider(), "secret")
+			for i, r := range recordings {
+				var req = httptest.NewRequest(r.Method, r.Path, bytes.NewReader(r.Body))
+				req.Header.Set("Authorization", "Bearer secret")
+				req.Header.Set("Content-Type", "application/scim+json")
+				var w = httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+
+				if w.Code != r.Status {
+					t.Fatalf("#%d %s %s: expected status %d, got %d: %s", i, r.Method, r.Path, r.Status, w.Code, w.Body)
+				}
+				var expected, actual = normalize(t, r.Response), normalize(t, w.Body.Bytes())
+				if !reflect.DeepEqual(expected, actual) {
+					t.Fatalf("#%d %s %s: expected %s, got %s", i, r.Method, r.Path, r.Response, w.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_Authentication(t *testing.T) {
+	var handler = NewHandler(newMemoryProvider(), "secret")
+	for _, header := range []string{"", "Bearer wrong", "secret", "Basic secret"} {
+		var req = httptest.NewRequest("GET", "/Users", nil)
+		req.Header.Set("Authorization", header)
+		var w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %q to be unauthorized, got %d", header, w.Code)
+		}
+	}
+
+	var req = httptest.NewRequest("GET", "/ServiceProviderConfig", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	var w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), SchemaServiceProviderConfig) {
+		t.Errorf("Expected the service provider config, got %d: %s", w.Code, w.Body)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/scim+json" {
+		t.Errorf("Expected application/scim+json, got %q", contentType)
+	}
+}
+
+func TestHandler_Pagination(t *testing.T) {
+	var provider = newMemoryProvider()
+	for _, name := range []string{"a", "b", "c"} {
+		provider.CreateUser(User{UserName: name, Active: true})
+	}
+	var handler = NewHandler(provider, "secret")
+
+	var req = httptest.NewRequest("GET", "/Users?startIndex=2&count=1", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	var w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var response struct {
+		TotalResults int    `json:"totalResults"`
+		StartIndex   int    `json:"startIndex"`
+		ItemsPerPage int    `json:"itemsPerPage"`
+		Resources    []User `json:"Resources"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.TotalResults != 3 || response.StartIndex != 2 || response.ItemsPerPage != 1 || response.Resources[0].UserName != "b" {
+		t.Errorf("Expected the second of three users, got %s", w.Body)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	var tests = []struct {
+		filter   string
+		expected Filter
+		err      error
+	}{
+		{"", Filter{}, nil},
+		{`userName eq "jane@example.com"`, Filter{Attribute: "username", Value: "jane@example.com"}, nil},
+		{`displayName EQ "Team \"A\""`, Filter{Attribute: "displayname", Value: `Team "A"`}, nil},
+		{`userName sw "j"`, Filter{}, ErrInvalidFilter},
+		{`userName eq jane`, Filter{}, ErrInvalidFilter},
+	}
+	for _, test := range tests {
+		var filter, err = ParseFilter(test.filter)
+		if filter != test.expected || err != test.err {
+			t.Errorf("ParseFilter(%q): expected %#v, %v, got %#v, %v", test.filter, test.expected, test.err, filter, err)
+		}
+	}
+}
+
+func TestApplyGroupPatch(t *testing.T) {
+	var group = Group{DisplayName: "a", Members: []Member{{Value: "1"}, {Value: "2"}}}
+	var operations = []Operation{
+		{Op: "remove", Path: `members[value eq "1"]`},
+		{Op: "add", Value: json.RawMessage(`{"displayName":"b","members":[{"value":"3"},{"value":"2"}]}`)},
+	}
+	if err := ApplyGroupPatch(&group, operations); err != nil {
+		t.Fatalf("ApplyGroupPatch errored with: %v", err)
+	}
+	if group.DisplayName != "b" || !reflect.DeepEqual(group.Members, []Member{{Value: "2"}, {Value: "3"}}) {
+		t.Errorf("Unexpected group %#v", group)
+	}
+
+	if err := ApplyGroupPatch(&group, []Operation{{Op: "remove", Path: "members"}}); err != nil || len(group.Members) != 0 {
+		t.Errorf("Expected removing members without value to clear them, got %#v, %v", group.Members, err)
+	}
+	if err := ApplyGroupPatch(&group, []Operation{{Op: "move", Path: "members"}}); err != ErrInvalidPatch {
+		t.Errorf("Expected unknown operations to return %q, got %v", ErrInvalidPatch, err)
+	}
+}
@@ -0,0 +1,200 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPatch is returned for PATCH operations which cannot be applied
+var ErrInvalidPatch = errors.New("Invalid PATCH operation")
+
+// PatchRequest is the body of a PATCH request
+type PatchRequest struct {
+	Schemas    []string    `json:"schemas"`
+	Operations []Operation `json:"Operations"`
+}
+
+// Operation is a single add, remove or replace operation of a PATCH request
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// parseBool accepts booleans as well as the "True" and "False" strings some identity providers send
+func parseBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, ErrInvalidPatch
+	}
+	var parsed, err = strconv.ParseBool(s)
+	if err != nil {
+		return false, ErrInvalidPatch
+	}
+	return parsed, nil
+}
+
+// applyUserAttribute sets a single user attribute. Attributes the server does not store are ignored
+func applyUserAttribute(user *User, path string, value json.RawMessage) error {
+	var attribute = strings.ToLower(path)
+	switch {
+	case attribute == "active":
+		var active, err = parseBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = active
+	case attribute == "username":
+		if err := json.Unmarshal(value, &user.UserName); err != nil {
+			return ErrInvalidPatch
+		}
+	case attribute == "emails":
+		var emails []Email
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return ErrInvalidPatch
+		}
+		user.Emails = emails
+	case strings.HasPrefix(attribute, "emails[") && strings.HasSuffix(attribute, ".value"):
+		var email string
+		if err := json.Unmarshal(value, &email); err != nil {
+			return ErrInvalidPatch
+		}
+		user.Emails = []Email{{Value: email, Primary: true}}
+	case attribute == "password":
+		if err := json.Unmarshal(value, &user.Password); err != nil {
+			return ErrInvalidPatch
+		}
+	}
+	return nil
+}
+
+// ApplyUserPatch applies the operations to the user. Operations without path set all attributes of their value
+func ApplyUserPatch(user *User, operations []Operation) error {
+	for _, operation := range operations {
+		var op = strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" {
+			return ErrInvalidPatch
+		}
+		if operation.Path != "" {
+			if err := applyUserAttribute(user, operation.Path, operation.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return ErrInvalidPatch
+		}
+		for path, value := range attributes {
+			if err := applyUserAttribute(user, path, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// memberFilterValue extracts the id of paths like members[value eq "42"]
+func memberFilterValue(path string) (string, bool) {
+	if !strings.HasPrefix(strings.ToLower(path), "members[") || !strings.HasSuffix(path, "]") {
+		return "", false
+	}
+	var filter, err = ParseFilter(path[len("members[") : len(path)-1])
+	if err != nil || filter.Attribute != "value" {
+		return "", false
+	}
+	return filter.Value, true
+}
+
+// addMembers adds all members which are not part of the group yet
+func addMembers(group *Group, members []Member) {
+	for _, member := range members {
+		var exists = false
+		for _, existing := range group.Members {
+			exists = exists || existing.Value == member.Value
+		}
+		if !exists {
+			group.Members = append(group.Members, member)
+		}
+	}
+}
+
+// removeMembers removes all members whose value is part of values
+func removeMembers(group *Group, values map[string]bool) {
+	var members = make([]Member, 0, len(group.Members))
+	for _, member := range group.Members {
+		if !values[member.Value] {
+			members = append(members, member)
+		}
+	}
+	group.Members = members
+}
+
+// ApplyGroupPatch applies the operations to the group, changing its displayName or members
+func ApplyGroupPatch(group *Group, operations []Operation) error {
+	for _, operation := range operations {
+		var op = strings.ToLower(operation.Op)
+		var path = strings.ToLower(operation.Path)
+
+		if value, ok := memberFilterValue(operation.Path); ok && op == "remove" {
+			removeMembers(group, map[string]bool{value: true})
+			continue
+		}
+
+		switch {
+		case op == "remove" && path == "members":
+			var members []Member
+			if len(operation.Value) == 0 || string(operation.Value) == "null" {
+				group.Members = []Member{}
+				continue
+			}
+			if err := json.Unmarshal(operation.Value, &members); err != nil {
+				return ErrInvalidPatch
+			}
+			var values = map[string]bool{}
+			for _, member := range members {
+				values[member.Value] = true
+			}
+			removeMembers(group, values)
+		case (op == "add" || op == "replace") && path == "members":
+			var members []Member
+			if err := json.Unmarshal(operation.Value, &members); err != nil {
+				return ErrInvalidPatch
+			}
+			if op == "replace" {
+				group.Members = []Member{}
+			}
+			addMembers(group, members)
+		case (op == "add" || op == "replace") && path == "displayname":
+			if err := json.Unmarshal(operation.Value, &group.DisplayName); err != nil {
+				return ErrInvalidPatch
+			}
+		case (op == "add" || op == "replace") && path == "":
+			var attributes struct {
+				DisplayName *string  `json:"displayName"`
+				Members     []Member `json:"members"`
+			}
+			if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+				return ErrInvalidPatch
+			}
+			if attributes.DisplayName != nil {
+				group.DisplayName = *attributes.DisplayName
+			}
+			if attributes.Members != nil {
+				if op == "replace" {
+					group.Members = []Member{}
+				}
+				addMembers(group, attributes.Members)
+			}
+		default:
+			return ErrInvalidPatch
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package scim implements the parts of the SCIM 2.0 protocol (RFC 7643, RFC 7644) identity providers use to
+// provision users and groups. Resources are stored by a Provider; the package takes care of routing,
+// authentication, filtering, pagination, PATCH operations and error responses.
+package scim
+
+import "errors"
+
+const (
+	// SchemaUser is the core schema of user resources
+	SchemaUser = "urn:ietf:params:scim:schemas:core:2.0:User"
+	// SchemaGroup is the core schema of group resources
+	SchemaGroup = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	// SchemaListResponse is the schema of list responses
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	// SchemaPatchOp is the schema of PATCH requests
+	SchemaPatchOp = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	// SchemaError is the schema of error responses
+	SchemaError = "urn:ietf:params:scim:api:messages:2.0:Error"
+	// SchemaServiceProviderConfig is the schema of the service provider configuration
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+var (
+	// ErrNotFound is returned by providers when a resource does not exist
+	ErrNotFound = errors.New("Resource not found")
+	// ErrUniqueness is returned by providers when a userName or displayName is already taken
+	ErrUniqueness = errors.New("A resource with this name already exists")
+	// ErrInvalidValue is returned by providers when a resource contains an unacceptable value
+	ErrInvalidValue = errors.New("Invalid value")
+)
+
+// Email is an email address of a user
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Member references a user belonging to a group
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+// Meta describes a resource
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+}
+
+// User is a SCIM user resource. Password is only accepted when creating or replacing a user and never returned
+type User struct {
+	Schemas  []string `json:"schemas"`
+	ID       string   `json:"id,omitempty"`
+	UserName string   `json:"userName"`
+	Emails   []Email  `json:"emails,omitempty"`
+	Active   bool     `json:"active"`
+	Password string   `json:"password,omitempty"`
+	Meta     *Meta    `json:"meta,omitempty"`
+}
+
+// PrimaryEmail returns the primary email address of the user, or the first one
+func (u User) PrimaryEmail() string {
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// Group is a SCIM group resource
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Filter restricts list requests to resources whose attribute equals the value. Attribute is lower case and
+// empty when no filter was given
+type Filter struct {
+	Attribute string
+	Value     string
+}
+
+// Provider stores the users and groups managed via SCIM. Implementations return ErrNotFound, ErrUniqueness
+// or ErrInvalidValue, possibly wrapped, for errors caused by the request
+type Provider interface {
+	Users(filter Filter) ([]User, error)
+	User(id string) (User, error)
+	CreateUser(user User) (User, error)
+	ReplaceUser(id string, user User) (User, error)
+	DeleteUser(id string) error
+
+	Groups(filter Filter) ([]Group, error)
+	Group(id string) (Group, error)
+	CreateGroup(group Group) (Group, error)
+	ReplaceGroup(id string, group Group) (Group, error)
+	DeleteGroup(id string) error
+}